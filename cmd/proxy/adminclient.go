@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+// adminRequest calls the admin API of the running proxy and decodes the
+// JSON response into out, if given
+func adminRequest(cfg *config.Config, method, path string, out interface{}) error {
+	return apiRequest(cfg, cfg.Admin.Token, method, path, out)
+}
+
+// apiRequest calls the admin API with the given bearer token
+func apiRequest(cfg *config.Config, token, method, path string, out interface{}) error {
+	if !cfg.Admin.Enabled {
+		return fmt.Errorf("the admin API is not enabled in the configuration")
+	}
+	host, port, err := net.SplitHostPort(cfg.Admin.Listen)
+	if err != nil {
+		return fmt.Errorf("invalid admin listen address: %w", err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	url := "http://" + net.JoinHostPort(host, port) + path
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the admin API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read admin API response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("admin API: %s", apiErr.Error)
+		}
+		return fmt.Errorf("admin API returned %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/llm"
+	"github.com/devashar13/ssh-proxy/internal/search"
+)
+
+// runAnalyze (re)summarizes existing session logs
+func runAnalyze(args []string) error {
+	fs, configPath := newFlagSet("analyze")
+	force := fs.Bool("force", false, "Re-summarize logs that already have a summary")
+	concurrency := fs.Int("concurrency", 2, "Maximum number of summaries generated at once")
+	since := fs.String("since", "", "Only logs of sessions started at or after this time (YYYY-MM-DD or RFC 3339)")
+	until := fs.String("until", "", "Only logs of sessions started before this time (YYYY-MM-DD or RFC 3339)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ssh-proxy analyze [flags] [log file or directory ...]\n\n")
+		fmt.Fprintf(os.Stderr, "With no paths, every log in the configured logging directory is considered.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := config.LoadYAML(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if cfg.LLM.APIKey == "" {
+		return fmt.Errorf("llm.api_key is not configured")
+	}
+
+	opts := llm.BatchOptions{Concurrency: *concurrency, Force: *force}
+	if opts.Since, err = parseTimeFlag(*since); err != nil {
+		return fmt.Errorf("invalid -since: %w", err)
+	}
+	if opts.Until, err = parseTimeFlag(*until); err != nil {
+		return fmt.Errorf("invalid -until: %w", err)
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{cfg.Logging.Directory}
+	}
+	logs, err := llm.FindSessionLogs(paths, opts.Since, opts.Until)
+	if err != nil {
+		return err
+	}
+	if len(logs) == 0 {
+		fmt.Println("No session logs found")
+		return nil
+	}
+
+	var index *search.Index
+	if cfg.Search.Enabled {
+		index = search.OpenIndex(search.IndexPath(cfg))
+	}
+
+	var summarized, skipped, failed int
+	llm.NewSummarizer(cfg, nil).SummarizeBatch(logs, opts, func(r llm.BatchResult) {
+		switch {
+		case r.Skipped:
+			skipped++
+			fmt.Printf("skip  %s (already summarized)\n", r.Path)
+		case r.Err != nil:
+			failed++
+			fmt.Printf("fail  %s: %v\n", r.Path, r.Err)
+		default:
+			summarized++
+			fmt.Printf("ok    %s (%s risk)\n", r.Path, r.Level)
+			if index != nil {
+				logName := strings.TrimSuffix(filepath.Base(r.Path), ".gz")
+				if err := index.SetSessionRisk(logName, r.Level.String()); err != nil {
+					fmt.Printf("      failed to update search index: %v\n", err)
+				}
+			}
+		}
+	})
+
+	fmt.Printf("\n%d summarized, %d skipped, %d failed\n", summarized, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d logs could not be summarized", failed)
+	}
+	return nil
+}
+
+// parseTimeFlag accepts a date in local time or a full RFC 3339 timestamp
+func parseTimeFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
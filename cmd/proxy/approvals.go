@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/proxy"
+)
+
+// runApprovals lists the sessions waiting for approval on the running
+// proxy, or approves or rejects one of them
+func runApprovals(args []string) error {
+	fs, configPath := newFlagSet("approvals")
+	approve := fs.String("approve", "", "ID of the request to approve")
+	reject := fs.String("reject", "", "ID of the request to reject")
+	reason := fs.String("reason", "", "Reason shown to the user when rejecting")
+	token := fs.String("token", "", "Your approver token from approval.approvers, which identifies you as the approver (default $SSH_PROXY_APPROVER_TOKEN)")
+	fs.Parse(args)
+	if *token == "" {
+		*token = os.Getenv("SSH_PROXY_APPROVER_TOKEN")
+	}
+
+	cfg, err := config.LoadYAML(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	switch {
+	case *approve != "" && *reject != "":
+		return fmt.Errorf("-approve and -reject cannot be combined")
+	case *approve != "" || *reject != "":
+		return decideApproval(cfg, *approve, *reject, *token, *reason)
+	}
+
+	listToken := cfg.Admin.Token
+	if *token != "" {
+		listToken = *token
+	}
+	var reqs []proxy.ApprovalRequest
+	if err := apiRequest(cfg, listToken, "GET", "/api/approvals", &reqs); err != nil {
+		return err
+	}
+	if len(reqs) == 0 {
+		fmt.Println("No sessions waiting for approval")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUSER\tCLIENT\tTARGET\tWAITING\tEXPIRES IN")
+	for _, req := range reqs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", req.ID, req.Username, req.ClientIP, req.Target,
+			time.Since(req.Requested).Round(time.Second), time.Until(req.Expires).Round(time.Second))
+	}
+	return tw.Flush()
+}
+
+func decideApproval(cfg *config.Config, approveID, rejectID, token, reason string) error {
+	if token == "" {
+		return fmt.Errorf("an approver token is needed: pass -token or set SSH_PROXY_APPROVER_TOKEN")
+	}
+	query := url.Values{}
+	id, action, done := approveID, "approve", "approved"
+	if rejectID != "" {
+		id, action, done = rejectID, "reject", "rejected"
+		if reason != "" {
+			query.Set("reason", reason)
+		}
+	}
+	path := "/api/approvals/" + url.PathEscape(id) + "/" + action
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var result struct {
+		Approver string `json:"approver"`
+	}
+	if err := apiRequest(cfg, token, "POST", path, &result); err != nil {
+		return err
+	}
+	fmt.Printf("Request %s %s by %s\n", id, done, result.Approver)
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/proxy"
+)
+
+// runBans lists the login bans held by the running proxy, or lifts them
+func runBans(args []string) error {
+	fs, configPath := newFlagSet("bans")
+	clear := fs.String("clear", "", "Lift a ban: ip:<address>, user:<name> or all")
+	fs.Parse(args)
+
+	cfg, err := config.LoadYAML(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if *clear != "" {
+		return clearBans(cfg, *clear)
+	}
+
+	var bans []proxy.Ban
+	if err := adminRequest(cfg, "GET", "/api/bans", &bans); err != nil {
+		return err
+	}
+	if len(bans) == 0 {
+		fmt.Println("No active bans")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tVALUE\tFAILURES\tBANNED\tEXPIRES")
+	for _, ban := range bans {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s (in %s)\n", ban.Kind, ban.Value, ban.Failures,
+			ban.Created.Local().Format(time.DateTime), ban.Expires.Local().Format(time.DateTime),
+			time.Until(ban.Expires).Round(time.Second))
+	}
+	return tw.Flush()
+}
+
+func clearBans(cfg *config.Config, target string) error {
+	var resp struct {
+		Cleared int `json:"cleared"`
+	}
+	if target == "all" {
+		if err := adminRequest(cfg, "DELETE", "/api/bans", &resp); err != nil {
+			return err
+		}
+		fmt.Printf("Cleared %d bans\n", resp.Cleared)
+		return nil
+	}
+
+	kind, value, ok := strings.Cut(target, ":")
+	if !ok || (kind != proxy.BanKindIP && kind != proxy.BanKindUser) || value == "" {
+		return fmt.Errorf("invalid -clear %q: expected ip:<address>, user:<name> or all", target)
+	}
+	path := "/api/bans/" + kind + "/" + url.PathEscape(value)
+	if err := adminRequest(cfg, "DELETE", path, &resp); err != nil {
+		return err
+	}
+	fmt.Printf("Cleared ban on %s %s\n", kind, value)
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"analyze":   {"(re)summarize session logs, a directory or a time range", runAnalyze},
+	"approvals": {"list, approve or reject sessions waiting for approval", runApprovals},
+	"bans":      {"list or clear login bans on the running proxy", runBans},
+	"decrypt":   {"decrypt encrypted session logs and summaries", runDecrypt},
+	"history":   {"list recorded sessions, or show one in full", runHistory},
+	"keygen":    {"create a key pair for encrypting session logs", runKeygen},
+	"prompt":    {"render the analysis prompt for a session log without calling the API", runPrompt},
+	"retention": {"compress, delete or archive old session logs now", runRetention},
+	"search":    {"find commands in session history", runSearch},
+	"usage":     {"report LLM token usage and estimated cost", runUsage},
+	"verify":    {"check session logs against their hash chains", runVerify},
+}
+
+func runCommand(name string, args []string) error {
+	if name == "help" {
+		printUsage()
+		return nil
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		printUsage()
+		return fmt.Errorf("unknown command")
+	}
+	return cmd.run(args)
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  ssh-proxy %-22s %s\n", "[-config path]", "run the proxy server")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  ssh-proxy %-22s %s\n", name+" [flags]", commands[name].usage)
+	}
+}
+
+// newFlagSet returns a flag set with the -config flag every command shares
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	configPath := fs.String("config", "configs/config.yaml", "Path to configuration file")
+	return fs, configPath
+}
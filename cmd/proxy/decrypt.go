@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/devashar13/ssh-proxy/internal/logger"
+)
+
+// runKeygen creates a key pair for encrypting logs
+func runKeygen(args []string) error {
+	fs, _ := newFlagSet("keygen")
+	out := fs.String("out", "", "File to write the private key to (required)")
+	fs.Parse(args)
+	if *out == "" {
+		fs.Usage()
+		return fmt.Errorf("-out is required")
+	}
+
+	key, err := logger.GenerateKey()
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+	public := logger.EncodeKey(key.PublicKey())
+	data := fmt.Sprintf("# public key: %s\n%s\n", public, logger.EncodeKey(key))
+
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create key file: %w", err)
+	}
+	if _, err := f.WriteString(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Private key written to %s; keep it off the proxy host.\n", *out)
+	fmt.Fprintf(os.Stderr, "Set logging.encryption.public_key to:\n")
+	fmt.Println(public)
+	return nil
+}
+
+// runDecrypt decrypts session logs and summaries with the private key
+func runDecrypt(args []string) error {
+	fs, _ := newFlagSet("decrypt")
+	keyPath := fs.String("key", "", "Private key file from \"ssh-proxy keygen\" (required)")
+	outDir := fs.String("out", "", "Directory to write decrypted copies to; with a single file, it is printed if unset")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ssh-proxy decrypt -key path [-out dir] <file or directory ...>\n\n")
+		fmt.Fprintf(os.Stderr, "Directories are searched for encrypted logs and summaries.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *keyPath == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("a key and at least one file are required")
+	}
+
+	data, err := os.ReadFile(*keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read key: %w", err)
+	}
+	key, err := logger.ParsePrivateKey(data)
+	if err != nil {
+		return err
+	}
+
+	files, err := encryptedFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "No encrypted files found")
+		return nil
+	}
+
+	if *outDir == "" {
+		if len(files) > 1 {
+			return fmt.Errorf("-out is required to decrypt more than one file")
+		}
+		err := decryptFile(files[0], os.Stdout, key)
+		if errors.Is(err, logger.ErrIncomplete) {
+			fmt.Fprintf(os.Stderr, "Warning: %s was not closed properly and may be cut short\n", files[0])
+			return nil
+		}
+		return err
+	}
+
+	if err := os.MkdirAll(*outDir, 0700); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	var failed int
+	for _, path := range files {
+		dest := filepath.Join(*outDir, filepath.Base(path))
+		out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", dest, err)
+		}
+		err = decryptFile(path, out, key)
+		out.Close()
+		switch {
+		case errors.Is(err, logger.ErrIncomplete):
+			fmt.Printf("partial  %s -> %s (not closed properly, may be cut short)\n", path, dest)
+		case err != nil:
+			fmt.Printf("failed   %s: %v\n", path, err)
+			os.Remove(dest)
+			failed++
+		default:
+			fmt.Printf("ok       %s -> %s\n", path, dest)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be decrypted", failed, len(files))
+	}
+	return nil
+}
+
+func decryptFile(path string, w io.Writer, key *ecdh.PrivateKey) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return logger.Decrypt(f, w, key)
+}
+
+// encryptedFiles expands directories into the encrypted files below them
+func encryptedFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if ok, err := logger.IsEncrypted(p); err == nil && ok {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", path, err)
+		}
+	}
+	return files, nil
+}
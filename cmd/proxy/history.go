@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/history"
+)
+
+// runHistory lists recorded sessions, or shows one in full
+func runHistory(args []string) error {
+	fs, configPath := newFlagSet("history")
+	user := fs.String("user", "", "Only sessions of this user")
+	since := fs.String("since", "", "Only sessions started at or after this time (YYYY-MM-DD or RFC 3339)")
+	until := fs.String("until", "", "Only sessions started before this time (YYYY-MM-DD or RFC 3339)")
+	limit := fs.Int("limit", 50, "Show at most this many sessions, newest first (0 for all)")
+	asJSON := fs.Bool("json", false, "Print sessions as JSON lines")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ssh-proxy history [flags] [session id]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := config.LoadYAML(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	store := history.OpenStore(history.StorePath(cfg))
+
+	if id := fs.Arg(0); id != "" {
+		rec, ok, err := store.Get(id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("session %s not found", id)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(rec)
+	}
+
+	f := history.Filter{User: *user, Limit: *limit}
+	if f.Since, err = parseTimeFlag(*since); err != nil {
+		return fmt.Errorf("invalid -since: %w", err)
+	}
+	if f.Until, err = parseTimeFlag(*until); err != nil {
+		return fmt.Errorf("invalid -until: %w", err)
+	}
+	records, err := store.List(f)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		for _, rec := range records {
+			enc.Encode(rec)
+		}
+		return nil
+	}
+	if len(records) == 0 {
+		fmt.Println("No sessions recorded")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUSER\tCLIENT\tAUTH\tTARGET\tSTARTED\tDURATION\tEXIT\tBYTES IN/OUT")
+	for _, rec := range records {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d/%d\n", rec.ID, rec.Username, rec.ClientAddr,
+			rec.AuthMethod, rec.Target, rec.Started.Local().Format(time.DateTime), duration(rec), exitColumn(rec),
+			rec.BytesIn, rec.BytesOut)
+	}
+	return tw.Flush()
+}
+
+func duration(rec history.Record) string {
+	if rec.Ended == nil {
+		return "-"
+	}
+	return rec.Ended.Sub(rec.Started).Round(time.Second).String()
+}
+
+func exitColumn(rec history.Record) string {
+	switch {
+	case rec.ExitStatus != nil:
+		return strconv.Itoa(*rec.ExitStatus)
+	case rec.ExitSignal != "":
+		return "signal " + rec.ExitSignal
+	case rec.EndReason != "":
+		return "ended: " + rec.EndReason
+	case rec.Ended == nil:
+		return "unfinished"
+	}
+	return "-"
+}
@@ -3,18 +3,31 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
+	"github.com/devashar13/ssh-proxy/internal/admin"
 	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/metrics"
 	"github.com/devashar13/ssh-proxy/internal/proxy"
 )
 
 func main() {
+	// Subcommands are dispatched before the server flags are parsed
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("%s: %v", os.Args[1], err)
+		}
+		return
+	}
+
 	configPath := flag.String("config", "configs/config.yaml", "Path to configuration file")
 	flag.Parse()
 
@@ -44,20 +57,78 @@ func main() {
 	fmt.Println("\nLogging:")
 	fmt.Printf("  - Directory: %s\n", cfg.Logging.Directory)
 
+	if cfg.Admin.Enabled {
+		fmt.Println("\nAdmin API:")
+		fmt.Printf("  - Listen: %s\n", cfg.Admin.Listen)
+	}
+	if cfg.Metrics.Enabled {
+		fmt.Println("\nMetrics:")
+		fmt.Printf("  - Listen: %s/metrics\n", cfg.Metrics.Listen)
+	}
+
 	// Create and start SSH proxy server
 	server, err := proxy.NewServer(cfg)
 	if err != nil {
 		log.Fatalf("Failed to create server: %v", err)
 	}
 
-	// Handle graceful shutdown
-	signalCh := make(chan os.Signal, 1)
+	var adminServer *admin.Server
+	if cfg.Admin.Enabled {
+		adminServer = admin.NewServer(cfg, *configPath, server)
+		go func() {
+			if err := adminServer.ListenAndServe(); err != nil {
+				log.Fatalf("Admin API error: %v", err)
+			}
+		}()
+	}
+
+	if cfg.Metrics.Enabled {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		go func() {
+			log.Printf("Metrics listening on %s", cfg.Metrics.Listen)
+			if err := http.ListenAndServe(cfg.Metrics.Listen, mux); err != nil {
+				log.Fatalf("Metrics server error: %v", err)
+			}
+		}()
+	}
+
+	// Reload configuration for new connections on SIGHUP
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+	go func() {
+		for range reloadCh {
+			fmt.Println("\nReloading configuration...")
+			server.Reload(*configPath)
+		}
+	}()
+
+	// Handle graceful shutdown; a second signal skips the drain period
+	signalCh := make(chan os.Signal, 2)
 	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
-	
+	shutdownDone := make(chan struct{})
+
 	go func() {
 		<-signalCh
-		fmt.Println("\nShutting down SSH proxy server...")
-		server.Shutdown()
+		fmt.Printf("\nShutting down SSH proxy server (waiting up to %s for sessions)...\n", cfg.Server.ShutdownTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		go func() {
+			select {
+			case <-signalCh:
+				fmt.Println("\nClosing remaining sessions now...")
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		if adminServer != nil {
+			adminServer.Shutdown(ctx)
+		}
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Sessions were force-closed: %v", err)
+		}
+		close(shutdownDone)
 	}()
 
 	// Start the server (this will block until server is shut down)
@@ -65,4 +136,5 @@ func main() {
 	if err := server.ListenAndServe(); err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
+	<-shutdownDone
 }
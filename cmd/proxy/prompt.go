@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/llm"
+)
+
+// runPrompt prints the system and user prompts that would be sent for a log
+func runPrompt(args []string) error {
+	fs, configPath := newFlagSet("prompt")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ssh-proxy prompt [-config path] <session.log>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly one log file")
+	}
+
+	cfg, err := config.LoadYAML(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	prompt, err := llm.NewSummarizer(cfg, nil).BuildPrompt(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("=== system ===\n%s\n\n=== user ===\n%s\n", prompt.System, prompt.User)
+	return nil
+}
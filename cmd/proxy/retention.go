@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/retention"
+)
+
+// runRetention applies the retention policy once, or shows what it would do
+func runRetention(args []string) error {
+	fs, configPath := newFlagSet("retention")
+	dryRun := fs.Bool("dry-run", false, "Only list what would be compressed, deleted or archived")
+	fs.Parse(args)
+
+	cfg, err := config.LoadYAML(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if !cfg.Logging.Retention.Enabled {
+		fmt.Fprintf(os.Stderr, "Note: logging.retention is not enabled; the running proxy won't apply this policy\n")
+	}
+
+	// open sessions are unknown here, but their logs are recent enough to
+	// be safe unless compress_after or max_age is very short
+	actions, err := retention.Apply(cfg, nil, time.Now(), *dryRun)
+	for _, a := range actions {
+		prefix := ""
+		if *dryRun {
+			prefix = "would "
+		}
+		fmt.Printf("%s%-8s %s (%s, %s)\n", prefix, a.Kind, filepath.Base(a.Log), a.Reason, config.ByteSize(a.Bytes))
+	}
+	if err != nil {
+		return err
+	}
+	if len(actions) == 0 {
+		fmt.Println("Nothing to do")
+	}
+	return nil
+}
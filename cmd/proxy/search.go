@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/llm"
+	"github.com/devashar13/ssh-proxy/internal/search"
+)
+
+// runSearch queries the command index, e.g.
+//
+//	ssh-proxy search -since 2025-02-01 iptables -F
+func runSearch(args []string) error {
+	fs, configPath := newFlagSet("search")
+	user := fs.String("user", "", "Only commands run by this user")
+	target := fs.String("target", "", "Only commands run on targets containing this text")
+	risk := fs.String("risk", "", "Only commands rated at least this risk (low, medium or high), or from sessions rated so")
+	since := fs.String("since", "", "Only commands run at or after this time (YYYY-MM-DD or RFC 3339)")
+	until := fs.String("until", "", "Only commands run before this time (YYYY-MM-DD or RFC 3339)")
+	limit := fs.Int("limit", 50, "Show at most this many commands, newest first (0 for all)")
+	asJSON := fs.Bool("json", false, "Print results as JSON lines")
+	fs.Parse(args)
+
+	cfg, err := config.LoadYAML(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	q := search.Query{
+		Text:   strings.Join(fs.Args(), " "),
+		User:   *user,
+		Target: *target,
+		Limit:  *limit,
+	}
+	if *risk != "" {
+		if q.Risk, err = llm.ParseRiskLevel(*risk); err != nil {
+			return err
+		}
+	}
+	if q.Since, err = parseTimeFlag(*since); err != nil {
+		return fmt.Errorf("invalid -since: %w", err)
+	}
+	if q.Until, err = parseTimeFlag(*until); err != nil {
+		return fmt.Errorf("invalid -until: %w", err)
+	}
+
+	path := search.IndexPath(cfg)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if !cfg.Search.Enabled {
+			return fmt.Errorf("no search index at %s: set search.enabled to index sessions", path)
+		}
+		fmt.Println("No matching commands")
+		return nil
+	}
+	results, err := search.OpenIndex(path).Search(q)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		for _, rec := range results {
+			enc.Encode(rec)
+		}
+		return nil
+	}
+	if len(results) == 0 {
+		fmt.Println("No matching commands")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tUSER\tCLIENT\tTARGET\tRISK\tLOG\tCOMMAND")
+	for _, rec := range results {
+		command := rec.Command
+		if rec.TypedBy != "" {
+			command += " (typed by " + rec.TypedBy + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", rec.Time.Local().Format(time.DateTime),
+			rec.Username, rec.ClientIP, rec.Target, riskColumn(rec), rec.Log, command)
+	}
+	return tw.Flush()
+}
+
+// riskColumn shows the command's own rating, then the session's
+func riskColumn(rec search.Record) string {
+	switch {
+	case rec.Risk != "" && rec.SessionRisk != "":
+		return rec.Risk + " (session " + rec.SessionRisk + ")"
+	case rec.Risk != "":
+		return rec.Risk
+	case rec.SessionRisk != "":
+		return "session " + rec.SessionRisk
+	}
+	return "-"
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/llm"
+)
+
+// runUsage prints token and cost totals from the usage ledger
+func runUsage(args []string) error {
+	fs, configPath := newFlagSet("usage")
+	since := fs.String("since", "", "Only include requests at or after this time (YYYY-MM-DD or RFC 3339)")
+	by := fs.String("by", "day", "Group totals by day, month, session, model or kind")
+	fs.Parse(args)
+
+	cfg, err := config.LoadYAML(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	start, err := parseTimeFlag(*since)
+	if err != nil {
+		return fmt.Errorf("invalid -since: %w", err)
+	}
+
+	keyFn, err := usageGrouping(*by)
+	if err != nil {
+		return err
+	}
+
+	type total struct {
+		requests   int
+		prompt     int
+		completion int
+		cost       float64
+	}
+	totals := make(map[string]*total)
+	var grand total
+	ledger := llm.OpenLedger(llm.LedgerPath(cfg))
+	err = ledger.Records(start, func(rec llm.UsageRecord) {
+		key := keyFn(rec)
+		t, ok := totals[key]
+		if !ok {
+			t = &total{}
+			totals[key] = t
+		}
+		for _, t := range []*total{t, &grand} {
+			t.requests++
+			t.prompt += rec.PromptTokens
+			t.completion += rec.CompletionTokens
+			t.cost += rec.Cost
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(totals))
+	for k := range totals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tREQUESTS\tPROMPT TOKENS\tCOMPLETION TOKENS\tCOST (USD)\n", strings.ToUpper(*by))
+	for _, k := range keys {
+		t := totals[k]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.4f\n", k, t.requests, t.prompt, t.completion, t.cost)
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t%d\t%d\t%.4f\n", grand.requests, grand.prompt, grand.completion, grand.cost)
+	w.Flush()
+
+	now := time.Now()
+	day, month, _ := ledger.Spent(now)
+	if budget := cfg.LLM.Usage.DailyBudget; budget > 0 {
+		fmt.Printf("\nToday:      $%.4f of $%.2f daily budget\n", day, budget)
+	}
+	if budget := cfg.LLM.Usage.MonthlyBudget; budget > 0 {
+		fmt.Printf("This month: $%.4f of $%.2f monthly budget\n", month, budget)
+	}
+	if err := llm.CheckBudget(cfg, ledger, now); err != nil {
+		fmt.Printf("\n%v\n", err)
+	}
+	return nil
+}
+
+func usageGrouping(by string) (func(llm.UsageRecord) string, error) {
+	switch by {
+	case "day":
+		return func(r llm.UsageRecord) string { return r.Time.Local().Format("2006-01-02") }, nil
+	case "month":
+		return func(r llm.UsageRecord) string { return r.Time.Local().Format("2006-01") }, nil
+	case "session":
+		return func(r llm.UsageRecord) string { return r.Session }, nil
+	case "model":
+		return func(r llm.UsageRecord) string { return r.Provider + "/" + r.Model }, nil
+	case "kind":
+		return func(r llm.UsageRecord) string { return r.Kind }, nil
+	default:
+		return nil, fmt.Errorf("invalid -by value: %s", by)
+	}
+}
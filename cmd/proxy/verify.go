@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/history"
+	"github.com/devashar13/ssh-proxy/internal/llm"
+	"github.com/devashar13/ssh-proxy/internal/logger"
+)
+
+// runVerify checks session logs against their hash chains
+func runVerify(args []string) error {
+	fs, configPath := newFlagSet("verify")
+	pubkey := fs.String("pubkey", "", "Public key the trailers are signed with (authorized_keys format); defaults to the proxy's host key")
+	allowUnchained := fs.Bool("allow-unchained", false, "Do not fail on logs that have no hash chain")
+	allowIncomplete := fs.Bool("allow-incomplete", false, "Do not fail on logs without a trailer, even if their session is recorded as ended")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ssh-proxy verify [flags] [log file or directory ...]\n\n")
+		fmt.Fprintf(os.Stderr, "With no paths, every log in the configured logging directory is checked.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := config.LoadYAML(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	opts := logger.VerifyOptions{HMACKey: []byte(cfg.Logging.Integrity.HMACKey)}
+	if opts.PublicKey, err = verifyKey(cfg, *pubkey); err != nil {
+		return err
+	}
+	if opts.PublicKey == nil {
+		fmt.Fprintf(os.Stderr, "Warning: no public key available, trailer signatures are not checked\n")
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{cfg.Logging.Directory}
+	}
+	logs, err := llm.FindSessionLogs(paths, time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	if len(logs) == 0 {
+		fmt.Println("No session logs found")
+		return nil
+	}
+
+	store := history.OpenStore(history.StorePath(cfg))
+	var failed int
+	for _, path := range logs {
+		v, err := logger.Verify(path, opts)
+		switch {
+		case errors.Is(err, logger.ErrNoChain):
+			fmt.Printf("MISSING     %s: no hash chain\n", path)
+			if !*allowUnchained {
+				failed++
+			}
+		case err != nil:
+			fmt.Printf("FAILED      %s: %v\n", path, err)
+			failed++
+		case !v.Complete && sessionOpen(store, path):
+			fmt.Printf("INCOMPLETE  %s: %d records intact, no trailer (session still open or proxy stopped)\n", path, v.Records)
+		case !v.Complete:
+			// a log cut short together with its trailer looks just like this
+			fmt.Printf("INCOMPLETE  %s: %d records intact, no trailer, but the session is not recorded as open (truncated?)\n", path, v.Records)
+			if !*allowIncomplete {
+				failed++
+			}
+		default:
+			signed := "unsigned"
+			if v.Signed {
+				signed = "signed"
+			}
+			fmt.Printf("OK          %s: %d records, %d bytes, %s %s\n", path, v.Records, v.Size, v.Algorithm, signed)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d logs failed verification", failed, len(logs))
+	}
+	return nil
+}
+
+// sessionOpen reports whether the session store has the log's session as
+// not yet ended. Logs are named <user>_<time>_<session id>.log.
+func sessionOpen(store *history.Store, path string) bool {
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".gz"), ".log")
+	i := strings.LastIndex(name, "_")
+	if i < 0 {
+		return false
+	}
+	rec, ok, err := store.Get(name[i+1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return false
+	}
+	return ok && rec.Ended == nil
+}
+
+// verifyKey returns the key trailers must be signed with: the one given on
+// the command line, or else the proxy's host key if it can be read
+func verifyKey(cfg *config.Config, path string) (ssh.PublicKey, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key: %w", err)
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		return key, nil
+	}
+
+	data, err := os.ReadFile(cfg.Server.HostKeyPath)
+	if err != nil {
+		return nil, nil
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, nil
+	}
+	return signer.PublicKey(), nil
+}
@@ -0,0 +1,393 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/history"
+	"github.com/devashar13/ssh-proxy/internal/llm"
+	"github.com/devashar13/ssh-proxy/internal/proxy"
+	"github.com/devashar13/ssh-proxy/internal/search"
+)
+
+// Server exposes live connection and session management over HTTP/JSON.
+// Every request must carry "Authorization: Bearer <admin.token>", except
+// that approvers use their own token for the approval endpoints.
+type Server struct {
+	config     *config.Config
+	configPath string
+	proxy      *proxy.Server
+	httpServer *http.Server
+}
+
+func NewServer(cfg *config.Config, configPath string, p *proxy.Server) *Server {
+	s := &Server{
+		config:     cfg,
+		configPath: configPath,
+		proxy:      p,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/connections", s.handleListConnections)
+	mux.HandleFunc("GET /api/sessions", s.handleListSessions)
+	mux.HandleFunc("GET /api/sessions/{id}", s.handleGetSession)
+	mux.HandleFunc("GET /api/sessions/{id}/stream", s.handleStreamSession)
+	mux.HandleFunc("DELETE /api/sessions/{id}", s.handleTerminateSession)
+	mux.HandleFunc("DELETE /api/users/{username}/sessions", s.handleTerminateUser)
+	mux.HandleFunc("POST /api/reload", s.handleReload)
+	mux.HandleFunc("GET /api/approvals", s.handleListApprovals)
+	mux.HandleFunc("POST /api/approvals/{id}/approve", s.handleApprove)
+	mux.HandleFunc("POST /api/approvals/{id}/reject", s.handleReject)
+	mux.HandleFunc("GET /api/bans", s.handleListBans)
+	mux.HandleFunc("DELETE /api/bans", s.handleClearBans)
+	mux.HandleFunc("DELETE /api/bans/{kind}/{value}", s.handleClearBan)
+	mux.HandleFunc("GET /api/search", s.handleSearch)
+	mux.HandleFunc("GET /api/history", s.handleListHistory)
+	mux.HandleFunc("GET /api/history/{id}", s.handleGetHistory)
+
+	s.httpServer = &http.Server{
+		Addr:    cfg.Admin.Listen,
+		Handler: s.authenticate(mux),
+	}
+	return s
+}
+
+func (s *Server) ListenAndServe() error {
+	log.Printf("Admin API listening on %s", s.config.Admin.Listen)
+	if err := s.httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
+
+// approverKey holds the name of the approver who made a request
+type approverKey struct{}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Admin.Token)) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// approvers are part of the reloadable configuration
+		if ok && isApprovalPath(r.URL.Path) {
+			if approver := s.proxy.Config().FindApprover(token); approver != nil {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), approverKey{}, approver.Name)))
+				return
+			}
+		}
+		log.Printf("Rejected admin API request from %s", r.RemoteAddr)
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+	})
+}
+
+func isApprovalPath(path string) bool {
+	return path == "/api/approvals" || strings.HasPrefix(path, "/api/approvals/")
+}
+
+func (s *Server) handleListConnections(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.proxy.Connections())
+}
+
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions := s.proxy.Sessions()
+	if user := r.URL.Query().Get("user"); user != "" {
+		filtered := sessions[:0]
+		for _, sess := range sessions {
+			if sess.Username == user {
+				filtered = append(filtered, sess)
+			}
+		}
+		sessions = filtered
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+func (s *Server) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	info, ok := s.proxy.Session(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// handleStreamSession shadows a live session read-only, streaming its raw
+// terminal output until the session ends or the client goes away
+func (s *Server) handleStreamSession(w http.ResponseWriter, r *http.Request) {
+	// shadowing can be turned off by a reload, unlike the admin settings
+	if !s.proxy.Config().Shadow.Enabled {
+		writeError(w, http.StatusForbidden, "session shadowing is not enabled")
+		return
+	}
+	watcher := r.URL.Query().Get("watcher")
+	if watcher == "" {
+		watcher = "admin API"
+	}
+	// attach before answering, so a session that has already ended is a 404
+	stream, ok := s.proxy.WatchSession(r.PathValue("id"), watcher)
+	if !ok {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	stream(flushWriter{w}, r.Context().Done())
+}
+
+func (s *Server) handleTerminateSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !s.proxy.TerminateSession(id, terminateReason(r)) {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	log.Printf("Admin API terminated session %s", id)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"terminated": 1})
+}
+
+func (s *Server) handleTerminateUser(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	n := s.proxy.TerminateUser(username, terminateReason(r))
+	log.Printf("Admin API terminated %d sessions of user %s", n, username)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"terminated": n})
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	changes, err := s.proxy.Reload(s.configPath)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if changes == nil {
+		changes = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"changes": changes})
+}
+
+func (s *Server) handleListApprovals(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.proxy.PendingApprovals())
+}
+
+// handleApprove and handleReject record the approver whose token was used;
+// the shared admin token cannot decide requests
+func (s *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
+	approver, ok := r.Context().Value(approverKey{}).(string)
+	if !ok {
+		writeError(w, http.StatusForbidden, "requests can only be approved with an approver token")
+		return
+	}
+	if err := s.proxy.Approve(r.PathValue("id"), approver); err != nil {
+		writeApprovalError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"approved": true, "approver": approver})
+}
+
+func (s *Server) handleReject(w http.ResponseWriter, r *http.Request) {
+	approver, ok := r.Context().Value(approverKey{}).(string)
+	if !ok {
+		writeError(w, http.StatusForbidden, "requests can only be rejected with an approver token")
+		return
+	}
+	if err := s.proxy.Reject(r.PathValue("id"), approver, r.URL.Query().Get("reason")); err != nil {
+		writeApprovalError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"approved": false, "approver": approver})
+}
+
+func writeApprovalError(w http.ResponseWriter, err error) {
+	switch err {
+	case proxy.ErrApprovalNotFound:
+		writeError(w, http.StatusNotFound, err.Error())
+	case proxy.ErrSelfApproval:
+		writeError(w, http.StatusForbidden, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (s *Server) handleListBans(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.proxy.Bans())
+}
+
+func (s *Server) handleClearBans(w http.ResponseWriter, r *http.Request) {
+	n, err := s.proxy.ClearBans()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"cleared": n})
+}
+
+func (s *Server) handleClearBan(w http.ResponseWriter, r *http.Request) {
+	kind, value := r.PathValue("kind"), r.PathValue("value")
+	if kind != proxy.BanKindIP && kind != proxy.BanKindUser {
+		writeError(w, http.StatusBadRequest, "ban kind must be ip or user")
+		return
+	}
+	found, err := s.proxy.ClearBan(kind, value)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "ban not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"cleared": 1})
+}
+
+// handleSearch queries the command index. Parameters: q (words that must
+// all appear), user, target, risk (minimum), since, until and limit.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := search.Query{
+		Text:   params.Get("q"),
+		User:   params.Get("user"),
+		Target: params.Get("target"),
+		Limit:  defaultSearchLimit,
+	}
+	var err error
+	if risk := params.Get("risk"); risk != "" {
+		if q.Risk, err = llm.ParseRiskLevel(risk); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if q.Since, err = parseTimeParam(params.Get("since")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid since: "+err.Error())
+		return
+	}
+	if q.Until, err = parseTimeParam(params.Get("until")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid until: "+err.Error())
+		return
+	}
+	if limit := params.Get("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit <= 0 || q.Limit > maxSearchLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit))
+			return
+		}
+	}
+
+	results, err := s.proxy.Search(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if results == nil {
+		results = []search.Record{}
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// handleListHistory lists recorded sessions. Parameters: user, since,
+// until and limit.
+func (s *Server) handleListHistory(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	f := history.Filter{User: params.Get("user"), Limit: defaultSearchLimit}
+	var err error
+	if f.Since, err = parseTimeParam(params.Get("since")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid since: "+err.Error())
+		return
+	}
+	if f.Until, err = parseTimeParam(params.Get("until")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid until: "+err.Error())
+		return
+	}
+	if limit := params.Get("limit"); limit != "" {
+		if f.Limit, err = strconv.Atoi(limit); err != nil || f.Limit <= 0 || f.Limit > maxSearchLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit))
+			return
+		}
+	}
+
+	records, err := s.proxy.History(f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if records == nil {
+		records = []history.Record{}
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+func (s *Server) handleGetHistory(w http.ResponseWriter, r *http.Request) {
+	rec, ok, err := s.proxy.HistoryRecord(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 1000
+)
+
+// parseTimeParam accepts a date (YYYY-MM-DD, local time) or RFC 3339
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// terminateReason is shown to the disconnected user
+func terminateReason(r *http.Request) string {
+	if reason := r.URL.Query().Get("reason"); reason != "" {
+		return reason
+	}
+	return "Session terminated by an administrator."
+}
+
+// flushWriter pushes every write to the client straight away
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		log.Printf("Failed to write admin API response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,300 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/proxy"
+)
+
+const testToken = "admin-secret"
+
+func newTestServer(t *testing.T, setup func(cfg *config.Config)) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Server.HostKeyPath = filepath.Join(dir, "host_key")
+	cfg.Logging.Directory = filepath.Join(dir, "logs")
+	cfg.Admin.Enabled = true
+	cfg.Admin.Token = testToken
+	if setup != nil {
+		setup(cfg)
+	}
+	p, err := proxy.NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	return NewServer(cfg, filepath.Join(dir, "missing.yaml"), p)
+}
+
+// do sends a request with the given bearer token and decodes the response
+func do(t *testing.T, s *Server, method, target, token string) (int, interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, req)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s Content-Type = %q", method, target, ct)
+	}
+	var body interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s %s returned invalid JSON %q: %v", method, target, rec.Body.String(), err)
+	}
+	return rec.Code, body
+}
+
+func TestAuthenticate(t *testing.T) {
+	s := newTestServer(t, nil)
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"no header", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer nope", http.StatusUnauthorized},
+		{"not a bearer token", "Basic " + testToken, http.StatusUnauthorized},
+		{"admin token", "Bearer " + testToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/sessions", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			s.httpServer.Handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	s := newTestServer(t, nil)
+	tests := []struct {
+		method string
+		target string
+		want   int
+		body   string
+	}{
+		{"GET", "/api/connections", http.StatusOK, "[]"},
+		{"GET", "/api/sessions", http.StatusOK, "[]"},
+		{"GET", "/api/sessions?user=alice", http.StatusOK, "[]"},
+		{"GET", "/api/sessions/s_1", http.StatusNotFound, `{"error":"session not found"}`},
+		{"DELETE", "/api/sessions/s_1", http.StatusNotFound, `{"error":"session not found"}`},
+		{"DELETE", "/api/users/alice/sessions", http.StatusOK, `{"terminated":0}`},
+		{"GET", "/api/sessions/s_1/stream", http.StatusForbidden, `{"error":"session shadowing is not enabled"}`},
+		{"POST", "/api/reload", http.StatusUnprocessableEntity, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			code, body := do(t, s, tt.method, tt.target, testToken)
+			if code != tt.want {
+				t.Errorf("status = %d, want %d (%v)", code, tt.want, body)
+			}
+			if tt.body != "" {
+				got, _ := json.Marshal(body)
+				if string(got) != tt.body {
+					t.Errorf("body = %s, want %s", got, tt.body)
+				}
+			}
+		})
+	}
+}
+
+func TestTerminateReason(t *testing.T) {
+	req := httptest.NewRequest("DELETE", "/api/sessions/s_1", nil)
+	if got := terminateReason(req); !strings.Contains(got, "administrator") {
+		t.Errorf("terminateReason() = %q, want the default", got)
+	}
+	req = httptest.NewRequest("DELETE", "/api/sessions/s_1?reason=maintenance", nil)
+	if got := terminateReason(req); got != "maintenance" {
+		t.Errorf("terminateReason() = %q, want maintenance", got)
+	}
+}
+
+func TestBanEndpoints(t *testing.T) {
+	s := newTestServer(t, nil)
+	tests := []struct {
+		method string
+		target string
+		want   int
+		body   string
+	}{
+		{"GET", "/api/bans", http.StatusOK, "[]"},
+		{"DELETE", "/api/bans", http.StatusOK, `{"cleared":0}`},
+		{"DELETE", "/api/bans/ip/10.0.0.1", http.StatusNotFound, `{"error":"ban not found"}`},
+		{"DELETE", "/api/bans/host/example", http.StatusBadRequest, `{"error":"ban kind must be ip or user"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			code, body := do(t, s, tt.method, tt.target, testToken)
+			got, _ := json.Marshal(body)
+			if code != tt.want || string(got) != tt.body {
+				t.Errorf("response = %d %s, want %d %s", code, got, tt.want, tt.body)
+			}
+		})
+	}
+}
+
+func TestApprovalEndpoints(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Approval.Approvers = []config.Approver{{Name: "carol", Token: "carol-token"}}
+	})
+	tests := []struct {
+		name   string
+		method string
+		target string
+		token  string
+		want   int
+	}{
+		{"admin lists approvals", "GET", "/api/approvals", testToken, http.StatusOK},
+		{"approver lists approvals", "GET", "/api/approvals", "carol-token", http.StatusOK},
+		{"approver token elsewhere", "GET", "/api/sessions", "carol-token", http.StatusUnauthorized},
+		{"unknown approver", "GET", "/api/approvals", "mallory-token", http.StatusUnauthorized},
+		{"admin cannot approve", "POST", "/api/approvals/a_1/approve", testToken, http.StatusForbidden},
+		{"admin cannot reject", "POST", "/api/approvals/a_1/reject", testToken, http.StatusForbidden},
+		{"approve unknown request", "POST", "/api/approvals/a_1/approve", "carol-token", http.StatusNotFound},
+		{"reject unknown request", "POST", "/api/approvals/a_1/reject", "carol-token", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, body := do(t, s, tt.method, tt.target, tt.token); code != tt.want {
+				t.Errorf("status = %d, want %d (%v)", code, tt.want, body)
+			}
+		})
+	}
+}
+
+func TestStreamUnknownSession(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) { cfg.Shadow.Enabled = true })
+	code, body := do(t, s, "GET", "/api/sessions/s_1/stream", testToken)
+	if code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 (%v)", code, body)
+	}
+}
+
+func TestStreamAfterReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	write := func(shadow bool) {
+		t.Helper()
+		data := fmt.Sprintf(`
+server:
+  port: 2222
+  host_key_path: %q
+upstream:
+  host: "localhost"
+  port: 22
+  username: "admin"
+  auth: {type: "password", password: "secret"}
+users:
+  - username: "user1"
+    auth: {type: "password", password: "user1pass"}
+logging:
+  directory: %q
+admin:
+  enabled: true
+  listen: "127.0.0.1:0"
+  token: %q
+shadow:
+  enabled: %t
+`, filepath.Join(dir, "host_key"), filepath.Join(dir, "logs"), testToken, shadow)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(true)
+	cfg, err := config.LoadYAML(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := proxy.NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	s := NewServer(cfg, path, p)
+
+	write(false)
+	if code, body := do(t, s, "POST", "/api/reload", testToken); code != http.StatusOK {
+		t.Fatalf("reload status = %d (%v)", code, body)
+	}
+	code, body := do(t, s, "GET", "/api/sessions/s_1/stream", testToken)
+	if code != http.StatusForbidden {
+		t.Errorf("status after disabling shadowing = %d, want 403 (%v)", code, body)
+	}
+}
+
+func TestSearchEndpoint(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) { cfg.Search.Enabled = true })
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/api/search?q=rm", http.StatusOK},
+		{"/api/search?user=alice&risk=medium&since=2026-03-01&until=2026-03-15T12:00:00Z&limit=10", http.StatusOK},
+		{"/api/search?risk=critical", http.StatusBadRequest},
+		{"/api/search?since=yesterday", http.StatusBadRequest},
+		{"/api/search?until=03/15/2026", http.StatusBadRequest},
+		{"/api/search?limit=0", http.StatusBadRequest},
+		{"/api/search?limit=1001", http.StatusBadRequest},
+		{"/api/search?limit=ten", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			if code, body := do(t, s, "GET", tt.target, testToken); code != tt.want {
+				t.Errorf("status = %d, want %d (%v)", code, tt.want, body)
+			}
+		})
+	}
+}
+
+func TestHistoryEndpoints(t *testing.T) {
+	s := newTestServer(t, nil)
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/api/history", http.StatusOK},
+		{"/api/history?user=alice&since=2026-03-01&limit=5", http.StatusOK},
+		{"/api/history?since=yesterday", http.StatusBadRequest},
+		{"/api/history?limit=-1", http.StatusBadRequest},
+		{"/api/history/s_1", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			if code, body := do(t, s, "GET", tt.target, testToken); code != tt.want {
+				t.Errorf("status = %d, want %d (%v)", code, tt.want, body)
+			}
+		})
+	}
+}
+
+func TestParseTimeParam(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{"", false},
+		{"2026-03-15", false},
+		{"2026-03-15T12:00:00Z", false},
+		{"2026-03-15T12:00:00+02:00", false},
+		{"15/03/2026", true},
+	}
+	for _, tt := range tests {
+		if _, err := parseTimeParam(tt.value); (err != nil) != tt.wantErr {
+			t.Errorf("parseTimeParam(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+		}
+	}
+}
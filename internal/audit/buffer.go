@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/devashar13/ssh-proxy/internal/notify"
+)
+
+// diskBuffer keeps events for one collector in a JSON lines file until
+// they can be delivered. It is only used by the destination's goroutine.
+type diskBuffer struct {
+	path    string
+	maxSize int64
+}
+
+func newDiskBuffer(dir, name string, maxSize int64) *diskBuffer {
+	return &diskBuffer{path: filepath.Join(dir, name+".jsonl"), maxSize: maxSize}
+}
+
+func (b *diskBuffer) pending() bool {
+	info, err := os.Stat(b.path)
+	return err == nil && info.Size() > 0
+}
+
+// append adds events until the buffer is full and returns how many fit
+func (b *diskBuffer) append(events []notify.Event) (int, error) {
+	var size int64
+	if info, err := os.Stat(b.path); err == nil {
+		size = info.Size()
+	}
+
+	var data bytes.Buffer
+	stored := 0
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		if size+int64(data.Len()+len(line)+1) > b.maxSize {
+			break
+		}
+		data.Write(line)
+		data.WriteByte('\n')
+		stored++
+	}
+	if stored == 0 {
+		return 0, nil
+	}
+
+	f, err := os.OpenFile(b.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Write(data.Bytes()); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return stored, f.Close()
+}
+
+// drain sends the buffered events in batches, oldest first, and returns how
+// many were delivered. Events that could not be sent stay buffered.
+func (b *diskBuffer) drain(send func([]notify.Event) error, batchSize int) (int, error) {
+	f, err := os.Open(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var events []notify.Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var event notify.Event
+		if json.Unmarshal(scanner.Bytes(), &event) == nil {
+			events = append(events, event)
+		}
+	}
+	f.Close()
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read shipping buffer: %w", err)
+	}
+
+	sent := 0
+	for sent < len(events) {
+		n := min(batchSize, len(events)-sent)
+		if err := send(events[sent : sent+n]); err != nil {
+			if rerr := b.rewrite(events[sent:]); rerr != nil {
+				return sent, rerr
+			}
+			return sent, err
+		}
+		sent += n
+	}
+	return sent, os.Remove(b.path)
+}
+
+// rewrite replaces the buffer with the events still to be sent
+func (b *diskBuffer) rewrite(events []notify.Event) error {
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	for _, event := range events {
+		enc.Encode(event)
+	}
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write shipping buffer: %w", err)
+	}
+	return os.Rename(tmp, b.path)
+}
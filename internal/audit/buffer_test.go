@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/devashar13/ssh-proxy/internal/notify"
+)
+
+func messages(events []notify.Event) []string {
+	var out []string
+	for _, e := range events {
+		out = append(out, e.Message)
+	}
+	return out
+}
+
+func testEvents(msgs ...string) []notify.Event {
+	var events []notify.Event
+	for _, m := range msgs {
+		events = append(events, notify.Event{Type: notify.EventSessionStart, Time: testTime, Message: m})
+	}
+	return events
+}
+
+func TestDiskBufferAppend(t *testing.T) {
+	b := newDiskBuffer(t.TempDir(), "http", 1<<20)
+	if b.pending() {
+		t.Fatal("new buffer is pending")
+	}
+	if n, err := b.append(testEvents("a", "b")); n != 2 || err != nil {
+		t.Fatalf("append() = %d, %v", n, err)
+	}
+	if !b.pending() {
+		t.Error("buffer with events is not pending")
+	}
+	info, _ := os.Stat(b.path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("buffer mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// stops at the size limit
+	b.maxSize = info.Size() + info.Size()/2
+	if n, err := b.append(testEvents("c", "d")); n != 1 || err != nil {
+		t.Errorf("append() to a nearly full buffer = %d, %v, want 1", n, err)
+	}
+	if n, _ := b.append(testEvents("e")); n != 0 {
+		t.Errorf("append() to a full buffer stored %d", n)
+	}
+}
+
+func TestDiskBufferDrain(t *testing.T) {
+	b := newDiskBuffer(t.TempDir(), "syslog", 1<<20)
+	if n, err := b.drain(func([]notify.Event) error { return nil }, 2); n != 0 || err != nil {
+		t.Errorf("drain() of a missing buffer = %d, %v", n, err)
+	}
+
+	b.append(testEvents("a", "b", "c", "d", "e"))
+	// lines that do not parse are skipped
+	f, _ := os.OpenFile(b.path, os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString("not json\n")
+	f.Close()
+
+	// the second batch fails: the first stays delivered, the rest stays buffered
+	var batches [][]string
+	fail := errors.New("collector down")
+	n, err := b.drain(func(events []notify.Event) error {
+		batches = append(batches, messages(events))
+		if len(batches) == 2 {
+			return fail
+		}
+		return nil
+	}, 2)
+	if n != 2 || !errors.Is(err, fail) {
+		t.Fatalf("drain() = %d, %v, want 2 and the send error", n, err)
+	}
+
+	var rest []string
+	n, err = b.drain(func(events []notify.Event) error {
+		rest = append(rest, messages(events)...)
+		return nil
+	}, 10)
+	if n != 3 || err != nil {
+		t.Fatalf("second drain() = %d, %v", n, err)
+	}
+	if got := len(rest); got != 3 || rest[0] != "c" || rest[2] != "e" {
+		t.Errorf("second drain sent %q, want c d e", rest)
+	}
+	if b.pending() {
+		t.Error("buffer still pending after it was drained")
+	}
+	if _, err := os.Stat(b.path); !os.IsNotExist(err) {
+		t.Errorf("drained buffer file still exists: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/notify"
+)
+
+// httpTransport posts batches of events to a bulk endpoint, as newline
+// delimited JSON, an Elasticsearch _bulk request or a Loki push
+type httpTransport struct {
+	url     string
+	format  string
+	index   string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newHTTPTransport(cfg *config.Config) *httpTransport {
+	settings := cfg.Shipping.HTTP
+	return &httpTransport{
+		url:     settings.URL,
+		format:  settings.Format,
+		index:   settings.Index,
+		headers: settings.Headers,
+		client:  &http.Client{},
+	}
+}
+
+func (t *httpTransport) Name() string {
+	return "http"
+}
+
+func (t *httpTransport) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+func (t *httpTransport) Send(ctx context.Context, events []notify.Event) error {
+	var (
+		body        []byte
+		contentType = "application/x-ndjson"
+		err         error
+	)
+	switch t.format {
+	case "elasticsearch":
+		body, err = t.elasticsearchBody(events)
+	case "loki":
+		body, err = lokiBody(events)
+		contentType = "application/json"
+	default:
+		body, err = ndjsonBody(events)
+	}
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s: %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+
+	if t.format == "elasticsearch" {
+		// _bulk reports failed documents in a 200 response
+		var result struct {
+			Errors bool `json:"errors"`
+		}
+		if json.Unmarshal(respBody, &result) == nil && result.Errors {
+			return fmt.Errorf("elasticsearch rejected some documents")
+		}
+	}
+	return nil
+}
+
+func ndjsonBody(events []notify.Event) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return nil, err
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// elasticsearchDoc adds the timestamp field Kibana and data streams expect
+type elasticsearchDoc struct {
+	Timestamp string `json:"@timestamp"`
+	notify.Event
+}
+
+func (t *httpTransport) elasticsearchBody(events []notify.Event) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	// "create" works for both indices and data streams
+	action := map[string]map[string]string{"create": {"_index": t.index}}
+	for _, event := range events {
+		if err := enc.Encode(action); err != nil {
+			return nil, err
+		}
+		doc := elasticsearchDoc{Timestamp: event.Time.UTC().Format("2006-01-02T15:04:05.000Z"), Event: event}
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	return b.Bytes(), nil
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// lokiBody groups events into one stream per event type; the other fields
+// stay in the JSON log line to keep label cardinality low
+func lokiBody(events []notify.Event) ([]byte, error) {
+	var streams []*lokiStream
+	byType := make(map[string]*lokiStream)
+	for _, event := range events {
+		stream := byType[event.Type]
+		if stream == nil {
+			stream = &lokiStream{Stream: map[string]string{"app": "ssh-proxy", "type": event.Type}}
+			byType[event.Type] = stream
+			streams = append(streams, stream)
+		}
+		line, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(event.Time.UnixNano(), 10), string(line)})
+	}
+	return json.Marshal(map[string][]*lokiStream{"streams": streams})
+}
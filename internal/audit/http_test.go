@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/devashar13/ssh-proxy/internal/notify"
+)
+
+type capturedRequest struct {
+	contentType string
+	header      string
+	body        string
+}
+
+// collector records requests and answers with status and body
+func collector(t *testing.T, status int, body string) (*httptest.Server, <-chan capturedRequest) {
+	t.Helper()
+	requests := make(chan capturedRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		requests <- capturedRequest{r.Header.Get("Content-Type"), r.Header.Get("X-Scope-OrgID"), string(data)}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func TestHTTPTransportFormats(t *testing.T) {
+	events := []notify.Event{
+		{Type: notify.EventSessionStart, Time: testTime, Username: "alice", Message: "started"},
+		{Type: notify.EventTranscript, Time: testTime, Message: "$ ls"},
+		{Type: notify.EventSessionStart, Time: testTime, Username: "bob", Message: "started"},
+	}
+	tests := []struct {
+		format      string
+		contentType string
+		check       func(t *testing.T, body string)
+	}{
+		{
+			format:      "ndjson",
+			contentType: "application/x-ndjson",
+			check: func(t *testing.T, body string) {
+				lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+				var e notify.Event
+				if len(lines) != 3 || json.Unmarshal([]byte(lines[2]), &e) != nil || e.Username != "bob" {
+					t.Errorf("body = %q", body)
+				}
+			},
+		},
+		{
+			format:      "elasticsearch",
+			contentType: "application/x-ndjson",
+			check: func(t *testing.T, body string) {
+				lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+				if len(lines) != 6 || lines[0] != `{"create":{"_index":"ssh-proxy-audit"}}` {
+					t.Fatalf("body = %q", body)
+				}
+				var doc map[string]interface{}
+				json.Unmarshal([]byte(lines[1]), &doc)
+				if doc["@timestamp"] != "2026-03-15T12:00:00.123Z" || doc["username"] != "alice" {
+					t.Errorf("document = %v", doc)
+				}
+			},
+		},
+		{
+			format:      "loki",
+			contentType: "application/json",
+			check: func(t *testing.T, body string) {
+				var push struct {
+					Streams []lokiStream `json:"streams"`
+				}
+				if err := json.Unmarshal([]byte(body), &push); err != nil {
+					t.Fatal(err)
+				}
+				if len(push.Streams) != 2 || push.Streams[0].Stream["type"] != notify.EventSessionStart ||
+					len(push.Streams[0].Values) != 2 || len(push.Streams[1].Values) != 1 {
+					t.Fatalf("push = %+v", push)
+				}
+				if push.Streams[0].Values[0][0] != "1773576000123456000" {
+					t.Errorf("timestamp = %s", push.Streams[0].Values[0][0])
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			srv, requests := collector(t, http.StatusOK, `{"errors":false}`)
+			tr := &httpTransport{
+				url:     srv.URL,
+				format:  tt.format,
+				index:   "ssh-proxy-audit",
+				headers: map[string]string{"X-Scope-OrgID": "tenant"},
+				client:  srv.Client(),
+			}
+			if err := tr.Send(context.Background(), events); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			req := <-requests
+			if req.contentType != tt.contentType || req.header != "tenant" {
+				t.Errorf("Content-Type = %q, header = %q", req.contentType, req.header)
+			}
+			tt.check(t, req.body)
+		})
+	}
+}
+
+func TestHTTPTransportErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"server error", "ndjson", http.StatusServiceUnavailable, "overloaded\n", "503 Service Unavailable: overloaded"},
+		{"rejected documents", "elasticsearch", http.StatusOK, `{"errors":true}`, "elasticsearch rejected some documents"},
+		{"accepted", "loki", http.StatusNoContent, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := collector(t, tt.status, tt.body)
+			tr := &httpTransport{url: srv.URL, format: tt.format, client: srv.Client()}
+			err := tr.Send(context.Background(), []notify.Event{{Type: notify.EventSessionEnd, Time: testTime}})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Send() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Send() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+// Package audit forwards audit events and session transcripts to remote
+// collectors, buffering them on disk while a collector is unreachable.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/metrics"
+	"github.com/devashar13/ssh-proxy/internal/notify"
+)
+
+const (
+	// events waiting in memory for a destination before they are dropped
+	queueSize = 4096
+	// how long a single delivery attempt may take
+	sendTimeout = 30 * time.Second
+	// longest wait between attempts to reach a collector that is down
+	maxRetryDelay = 5 * time.Minute
+	// how long Close waits for the last events to go out
+	closeTimeout = 10 * time.Second
+)
+
+// transport delivers a batch of events to one collector
+type transport interface {
+	Name() string
+	Send(ctx context.Context, events []notify.Event) error
+	Close() error
+}
+
+// Shipper fans events out to the configured collectors. A nil Shipper
+// ships nothing.
+type Shipper struct {
+	destinations []*destination
+}
+
+// New returns a Shipper for the collectors enabled in cfg, or nil if there
+// are none
+func New(cfg *config.Config) (*Shipper, error) {
+	var transports []transport
+	if cfg.Shipping.Syslog.Enabled {
+		t, err := newSyslogTransport(cfg)
+		if err != nil {
+			return nil, err
+		}
+		transports = append(transports, t)
+	}
+	if cfg.Shipping.HTTP.Enabled {
+		transports = append(transports, newHTTPTransport(cfg))
+	}
+	if len(transports) == 0 {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(cfg.Shipping.BufferDirectory, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create shipping buffer directory: %w", err)
+	}
+	s := &Shipper{}
+	for _, t := range transports {
+		batchSize, flushInterval := 1, time.Second
+		if t.Name() == "http" {
+			batchSize, flushInterval = cfg.Shipping.HTTP.BatchSize, cfg.Shipping.HTTP.FlushInterval
+		}
+		d := &destination{
+			transport:     t,
+			queue:         make(chan notify.Event, queueSize),
+			buffer:        newDiskBuffer(cfg.Shipping.BufferDirectory, t.Name(), int64(cfg.Shipping.BufferMaxSize)),
+			batchSize:     batchSize,
+			flushInterval: flushInterval,
+			done:          make(chan struct{}),
+		}
+		go d.run()
+		s.destinations = append(s.destinations, d)
+	}
+	return s, nil
+}
+
+// Ship queues an event for every collector without blocking. If a
+// collector has fallen too far behind, the event is dropped for it.
+func (s *Shipper) Ship(event notify.Event) {
+	if s == nil {
+		return
+	}
+	for _, d := range s.destinations {
+		select {
+		case d.queue <- event:
+		default:
+			metrics.ShippedEvents.WithLabelValues(d.transport.Name(), "dropped").Inc()
+		}
+	}
+}
+
+// Close delivers or buffers the queued events and disconnects
+func (s *Shipper) Close() {
+	if s == nil {
+		return
+	}
+	for _, d := range s.destinations {
+		close(d.queue)
+	}
+	timeout := time.After(closeTimeout)
+	for _, d := range s.destinations {
+		select {
+		case <-d.done:
+		case <-timeout:
+			log.Printf("Gave up waiting for audit events to be shipped to %s", d.transport.Name())
+		}
+	}
+}
+
+// destination is one collector with its queue and disk buffer
+type destination struct {
+	transport     transport
+	queue         chan notify.Event
+	buffer        *diskBuffer
+	batchSize     int
+	flushInterval time.Duration
+	done          chan struct{}
+
+	failures  int
+	nextRetry time.Time
+}
+
+func (d *destination) run() {
+	defer close(d.done)
+	defer d.transport.Close()
+
+	ticker := time.NewTicker(d.flushInterval)
+	defer ticker.Stop()
+
+	var batch []notify.Event
+	for {
+		select {
+		case event, ok := <-d.queue:
+			if !ok {
+				// on shutdown, try once more and keep whatever fails on disk
+				d.nextRetry = time.Time{}
+				d.flush(batch)
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) < d.batchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		d.flush(batch)
+		batch = nil
+	}
+}
+
+// flush sends a batch, after anything still buffered on disk so that the
+// collector sees events in order. What can't be sent is buffered.
+func (d *destination) flush(batch []notify.Event) {
+	name := d.transport.Name()
+	if d.buffer.pending() {
+		if time.Now().Before(d.nextRetry) {
+			d.spill(batch)
+			return
+		}
+		sent, err := d.buffer.drain(func(events []notify.Event) error {
+			return d.send(events)
+		}, max(d.batchSize, 100))
+		metrics.ShippedEvents.WithLabelValues(name, "sent").Add(float64(sent))
+		if err != nil {
+			d.failed(err)
+			d.spill(batch)
+			return
+		}
+		log.Printf("Delivered %d buffered audit events to %s", sent, name)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := d.send(batch); err != nil {
+		d.failed(err)
+		d.spill(batch)
+		return
+	}
+	d.failures = 0
+	metrics.ShippedEvents.WithLabelValues(name, "sent").Add(float64(len(batch)))
+}
+
+func (d *destination) send(events []notify.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	return d.transport.Send(ctx, events)
+}
+
+// failed backs off exponentially before the next attempt
+func (d *destination) failed(err error) {
+	if d.failures == 0 {
+		log.Printf("Failed to ship audit events to %s, buffering them on disk: %v", d.transport.Name(), err)
+	}
+	d.failures++
+	delay := time.Second << min(d.failures, 10)
+	d.nextRetry = time.Now().Add(min(delay, maxRetryDelay))
+}
+
+func (d *destination) spill(batch []notify.Event) {
+	if len(batch) == 0 {
+		return
+	}
+	name := d.transport.Name()
+	stored, err := d.buffer.append(batch)
+	metrics.ShippedEvents.WithLabelValues(name, "buffered").Add(float64(stored))
+	if dropped := len(batch) - stored; dropped > 0 {
+		metrics.ShippedEvents.WithLabelValues(name, "dropped").Add(float64(dropped))
+		log.Printf("Dropped %d audit events for %s: buffer is full", dropped, name)
+	}
+	if err != nil {
+		log.Printf("Failed to buffer audit events for %s: %v", name, err)
+	}
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/notify"
+)
+
+func shippingConfig(dir, url string) *config.Config {
+	cfg := &config.Config{}
+	cfg.Shipping.BufferDirectory = filepath.Join(dir, "shipping")
+	cfg.Shipping.BufferMaxSize = 1 << 20
+	cfg.Shipping.HTTP.Enabled = true
+	cfg.Shipping.HTTP.URL = url
+	cfg.Shipping.HTTP.Format = "ndjson"
+	cfg.Shipping.HTTP.BatchSize = 2
+	cfg.Shipping.HTTP.FlushInterval = time.Hour
+	return cfg
+}
+
+func TestNewWithoutCollectors(t *testing.T) {
+	s, err := New(&config.Config{})
+	if s != nil || err != nil {
+		t.Fatalf("New() = %v, %v, want nil", s, err)
+	}
+	// a nil Shipper ships nothing
+	s.Ship(notify.Event{Type: notify.EventSessionStart})
+	s.Close()
+}
+
+func TestShipperBuffersUntilCollectorIsBack(t *testing.T) {
+	dir := t.TempDir()
+
+	down, _ := collector(t, http.StatusServiceUnavailable, "")
+	s, err := New(shippingConfig(dir, down.URL))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for _, e := range testEvents("a", "b", "c") {
+		s.Ship(e)
+	}
+	s.Close()
+	buffer := newDiskBuffer(filepath.Join(dir, "shipping"), "http", 1<<20)
+	if !buffer.pending() {
+		t.Fatal("events for an unreachable collector were not buffered")
+	}
+
+	// buffered events go out first, in order
+	up, requests := collector(t, http.StatusOK, "")
+	s, err = New(shippingConfig(dir, up.URL))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for _, e := range testEvents("d", "e") {
+		s.Ship(e)
+	}
+	s.Close()
+
+	var got []string
+	for len(requests) > 0 {
+		for _, line := range strings.Split(strings.TrimSpace((<-requests).body), "\n") {
+			var e notify.Event
+			json.Unmarshal([]byte(line), &e)
+			got = append(got, e.Message)
+		}
+	}
+	if strings.Join(got, "") != "abcde" {
+		t.Errorf("collector received %q, want a to e in order", got)
+	}
+	if buffer.pending() {
+		t.Error("buffer still pending after delivery")
+	}
+}
@@ -0,0 +1,217 @@
+package audit
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/notify"
+)
+
+// structured data ID; 32473 is the enterprise number reserved for
+// documentation and examples (RFC 5612)
+const sdID = "ssh-proxy@32473"
+
+// longest message sent in one UDP datagram
+const maxDatagram = 8192
+
+const (
+	severityCritical = 2
+	severityWarning  = 4
+	severityNotice   = 5
+	severityInfo     = 6
+)
+
+// syslogTransport sends RFC 5424 messages over UDP, or over TCP or TLS with
+// octet-counted framing (RFC 6587)
+type syslogTransport struct {
+	network   string
+	address   string
+	facility  int
+	appName   string
+	hostname  string
+	tlsConfig *tls.Config
+	conn      net.Conn
+}
+
+func newSyslogTransport(cfg *config.Config) (*syslogTransport, error) {
+	settings := cfg.Shipping.Syslog
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	t := &syslogTransport{
+		network:  settings.Network,
+		address:  settings.Address,
+		facility: config.SyslogFacilities[settings.Facility],
+		appName:  settings.AppName,
+		hostname: hostname,
+	}
+	if settings.Network == "tls" {
+		host, _, _ := net.SplitHostPort(settings.Address)
+		t.tlsConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+		if settings.CAFile != "" {
+			pem, err := os.ReadFile(settings.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read syslog CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in syslog CA file %s", settings.CAFile)
+			}
+			t.tlsConfig.RootCAs = pool
+		}
+	}
+	return t, nil
+}
+
+func (t *syslogTransport) Name() string {
+	return "syslog"
+}
+
+func (t *syslogTransport) Send(ctx context.Context, events []notify.Event) error {
+	if t.conn == nil {
+		if err := t.dial(ctx); err != nil {
+			return err
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		t.conn.SetWriteDeadline(deadline)
+	}
+
+	for _, event := range events {
+		msg := t.format(event)
+		var err error
+		if t.network == "udp" {
+			if len(msg) > maxDatagram {
+				msg = msg[:maxDatagram]
+			}
+			_, err = t.conn.Write(msg)
+		} else {
+			_, err = fmt.Fprintf(t.conn, "%d %s", len(msg), msg)
+		}
+		if err != nil {
+			t.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *syslogTransport) dial(ctx context.Context) error {
+	var err error
+	if t.network == "tls" {
+		dialer := &tls.Dialer{Config: t.tlsConfig}
+		t.conn, err = dialer.DialContext(ctx, "tcp", t.address)
+	} else {
+		var dialer net.Dialer
+		t.conn, err = dialer.DialContext(ctx, t.network, t.address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", t.address, err)
+	}
+	return nil
+}
+
+func (t *syslogTransport) Close() error {
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+// format renders an event as
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD-ELEMENT] MSG
+func (t *syslogTransport) format(event notify.Event) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d %s ",
+		t.facility*8+severity(event),
+		event.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		headerField(t.hostname, 255),
+		headerField(t.appName, 48),
+		os.Getpid(),
+		headerField(event.Type, 32))
+
+	params := map[string]string{
+		"user":      event.Username,
+		"client_ip": event.ClientIP,
+		"risk":      event.Risk,
+	}
+	for k, v := range event.Details {
+		params[k] = v
+	}
+	keys := make([]string, 0, len(params))
+	for k, v := range params {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	b.WriteString("[" + sdID)
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=\"%s\"", paramName(k), sdEscaper.Replace(params[k]))
+	}
+	b.WriteString("] ")
+	b.WriteString(event.Message)
+	return []byte(b.String())
+}
+
+func severity(event notify.Event) int {
+	switch event.Type {
+	case notify.EventTranscript:
+		return severityInfo
+	case notify.EventAuthFailure, notify.EventPolicyDenied:
+		return severityWarning
+	case notify.EventLiveRisk, notify.EventSummaryRisk:
+		switch strings.ToLower(event.Risk) {
+		case "high":
+			return severityCritical
+		case "medium":
+			return severityWarning
+		}
+	}
+	return severityNotice
+}
+
+// headerField makes a value fit a header field: printable ASCII without
+// spaces, "-" if empty
+func headerField(s string, maxLen int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "-"
+	}
+	if len(s) > maxLen {
+		s = s[:maxLen]
+	}
+	return s
+}
+
+// paramName makes a key a valid SD-NAME
+func paramName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > 32 {
+		s = s[:32]
+	}
+	return s
+}
+
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
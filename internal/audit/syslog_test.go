@@ -0,0 +1,177 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/notify"
+)
+
+var testTime = time.Date(2026, 3, 15, 12, 0, 0, 123456000, time.UTC)
+
+func TestSyslogFormat(t *testing.T) {
+	tr := &syslogTransport{facility: 10, appName: "ssh-proxy", hostname: "bastion"}
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		name  string
+		event notify.Event
+		want  string
+	}{
+		{
+			name:  "auth failure",
+			event: notify.Event{Type: notify.EventAuthFailure, Time: testTime, Username: "alice", ClientIP: "10.0.0.1", Message: "authentication failed with password"},
+			want:  `<84>1 2026-03-15T12:00:00.123456Z bastion ssh-proxy ` + pid + ` auth_failure [ssh-proxy@32473 client_ip="10.0.0.1" user="alice"] authentication failed with password`,
+		},
+		{
+			name:  "high risk with details",
+			event: notify.Event{Type: notify.EventLiveRisk, Time: testTime, Username: "bob", Risk: "HIGH", Message: "rm -rf /", Details: map[string]string{"session": "s_1"}},
+			want:  `<82>1 2026-03-15T12:00:00.123456Z bastion ssh-proxy ` + pid + ` live_risk [ssh-proxy@32473 risk="HIGH" session="s_1" user="bob"] rm -rf /`,
+		},
+		{
+			name:  "escaped values and names",
+			event: notify.Event{Type: notify.EventTranscript, Time: testTime, Message: "x", Details: map[string]string{"a b=c]": `say "hi" \ [ok]`}},
+			want:  `<86>1 2026-03-15T12:00:00.123456Z bastion ssh-proxy ` + pid + ` transcript [ssh-proxy@32473 a_b_c_="say \"hi\" \\ [ok\]"] x`,
+		},
+		{
+			name:  "no parameters",
+			event: notify.Event{Type: notify.EventSessionStart, Time: testTime, Message: "started"},
+			want:  `<85>1 2026-03-15T12:00:00.123456Z bastion ssh-proxy ` + pid + ` session_start [ssh-proxy@32473] started`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(tr.format(tt.event)); got != tt.want {
+				t.Errorf("format() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	tests := []struct {
+		event notify.Event
+		want  int
+	}{
+		{notify.Event{Type: notify.EventTranscript}, severityInfo},
+		{notify.Event{Type: notify.EventAuthFailure}, severityWarning},
+		{notify.Event{Type: notify.EventPolicyDenied}, severityWarning},
+		{notify.Event{Type: notify.EventSummaryRisk, Risk: "high"}, severityCritical},
+		{notify.Event{Type: notify.EventLiveRisk, Risk: "medium"}, severityWarning},
+		{notify.Event{Type: notify.EventLiveRisk, Risk: "low"}, severityNotice},
+		{notify.Event{Type: notify.EventSessionEnd}, severityNotice},
+	}
+	for _, tt := range tests {
+		if got := severity(tt.event); got != tt.want {
+			t.Errorf("severity(%s %s) = %d, want %d", tt.event.Type, tt.event.Risk, got, tt.want)
+		}
+	}
+}
+
+func TestHeaderField(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"bastion", 255, "bastion"},
+		{"", 255, "-"},
+		{"two words\n", 255, "twowords"},
+		{"héllo", 255, "hllo"},
+		{"abcdef", 4, "abcd"},
+	}
+	for _, tt := range tests {
+		if got := headerField(tt.in, tt.max); got != tt.want {
+			t.Errorf("headerField(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if got := paramName(strings.Repeat("k", 40)); len(got) != 32 {
+		t.Errorf("paramName() kept %d characters", len(got))
+	}
+}
+
+func TestSyslogSendTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		var msgs []string
+		for len(msgs) < 2 {
+			// octet counting: "<length> <message>"
+			var n int
+			if _, err := fmt.Fscanf(r, "%d ", &n); err != nil {
+				break
+			}
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				break
+			}
+			msgs = append(msgs, string(msg))
+		}
+		received <- msgs
+	}()
+
+	tr := &syslogTransport{network: "tcp", address: ln.Addr().String(), facility: 10, appName: "ssh-proxy", hostname: "bastion"}
+	defer tr.Close()
+	events := []notify.Event{
+		{Type: notify.EventSessionStart, Time: testTime, Message: "first\nline"},
+		{Type: notify.EventSessionEnd, Time: testTime, Message: "second"},
+	}
+	if err := tr.Send(context.Background(), events); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	msgs := <-received
+	if len(msgs) != 2 || !strings.HasSuffix(msgs[0], "] first\nline") || !strings.HasSuffix(msgs[1], "] second") {
+		t.Errorf("received %q", msgs)
+	}
+}
+
+func TestSyslogSendUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	tr := &syslogTransport{network: "udp", address: pc.LocalAddr().String(), appName: "ssh-proxy", hostname: "bastion"}
+	defer tr.Close()
+	long := strings.Repeat("x", 2*maxDatagram)
+	if err := tr.Send(context.Background(), []notify.Event{{Type: notify.EventTranscript, Time: testTime, Message: long}}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	buf := make([]byte, 4*maxDatagram)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != maxDatagram || !strings.HasPrefix(string(buf[:n]), "<6>1 ") {
+		t.Errorf("received %d bytes starting %q, want a truncated datagram", n, buf[:10])
+	}
+}
+
+func TestSyslogDialFailure(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+	tr := &syslogTransport{network: "tcp", address: addr}
+	if err := tr.Send(context.Background(), []notify.Event{{Type: "x"}}); err == nil || !strings.Contains(err.Error(), "failed to connect") {
+		t.Errorf("Send() error = %v, want a connection error", err)
+	}
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	// the runtime image has no zoneinfo database
+	_ "time/tzdata"
+)
+
+// AccessRules restrict when and from where a user may log in. Every rule
+// is optional; a user without rules may log in at any time from anywhere.
+type AccessRules struct {
+	// Timezone the weekdays and hours are in, e.g. "Europe/Berlin"; UTC
+	// if empty
+	Timezone string   `yaml:"timezone,omitempty"`
+	Weekdays []string `yaml:"weekdays,omitempty"`
+	// Daily window such as "09:00-18:00"; it may wrap past midnight
+	Hours       string    `yaml:"hours,omitempty"`
+	SourceCIDRs []string  `yaml:"source_cidrs,omitempty"`
+	Expires     time.Time `yaml:"expires,omitempty"`
+	// Close open sessions when the allowed window ends
+	TerminateOutsideWindow bool `yaml:"terminate_outside_window,omitempty"`
+
+	// parsed by compile
+	location *time.Location
+	days     [7]bool
+	start    int
+	end      int
+	sources  []netip.Prefix
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func (a *AccessRules) compile() error {
+	a.location = time.UTC
+	if a.Timezone != "" {
+		loc, err := time.LoadLocation(a.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
+		a.location = loc
+	}
+
+	a.days = [7]bool{}
+	for _, name := range a.Weekdays {
+		key := strings.ToLower(name)
+		if len(key) > 3 {
+			key = key[:3]
+		}
+		day, ok := weekdayNames[key]
+		if !ok {
+			return fmt.Errorf("invalid weekday: %s", name)
+		}
+		a.days[day] = true
+	}
+
+	a.start, a.end = 0, 0
+	if a.Hours != "" {
+		from, to, ok := strings.Cut(a.Hours, "-")
+		if !ok {
+			return fmt.Errorf("invalid hours %q: expected HH:MM-HH:MM", a.Hours)
+		}
+		var err error
+		if a.start, err = parseClock(from); err != nil {
+			return fmt.Errorf("invalid hours %q: %w", a.Hours, err)
+		}
+		if a.end, err = parseClock(to); err != nil {
+			return fmt.Errorf("invalid hours %q: %w", a.Hours, err)
+		}
+		if a.start == a.end {
+			return fmt.Errorf("invalid hours %q: empty window", a.Hours)
+		}
+	}
+
+	sources, err := ParsePrefixes(a.SourceCIDRs)
+	if err != nil {
+		return fmt.Errorf("invalid source_cidrs: %w", err)
+	}
+	a.sources = sources
+	return nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight; "24:00" is allowed
+// as the end of a window
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d", &h, &m); err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return h*60 + m, nil
+}
+
+// HasWindow reports whether logins are limited to certain days or hours
+func (a *AccessRules) HasWindow() bool {
+	return len(a.Weekdays) > 0 || a.Hours != ""
+}
+
+// Check returns a short reason and a description if the rules deny a login
+// from ip at now, or empty strings if they allow it
+func (a *AccessRules) Check(now time.Time, ip netip.Addr) (string, string) {
+	if a.Expired(now) {
+		return "account_expired", fmt.Sprintf("account expired on %s", a.Expires.Format(time.DateOnly))
+	}
+	if len(a.sources) > 0 {
+		allowed := false
+		for _, p := range a.sources {
+			if p.Contains(ip.Unmap()) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "source_not_allowed", fmt.Sprintf("logins are not allowed from %s", ip)
+		}
+	}
+	if !a.InWindow(now) {
+		return "outside_access_window", fmt.Sprintf("logins are only allowed %s", a.describeWindow())
+	}
+	return "", ""
+}
+
+// Expired reports whether the account has passed its expiry time
+func (a *AccessRules) Expired(now time.Time) bool {
+	return !a.Expires.IsZero() && !now.Before(a.Expires)
+}
+
+// InWindow reports whether now falls on an allowed day and inside the
+// allowed hours. A window that wraps past midnight belongs to the day it
+// starts on.
+func (a *AccessRules) InWindow(now time.Time) bool {
+	if !a.HasWindow() {
+		return true
+	}
+	loc := a.location
+	if loc == nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	day := local.Weekday()
+	minute := local.Hour()*60 + local.Minute()
+
+	if a.Hours != "" {
+		switch {
+		case a.start < a.end:
+			if minute < a.start || minute >= a.end {
+				return false
+			}
+		case minute < a.end:
+			// early morning part of a window that started the day before
+			day = (day + 6) % 7
+		case minute < a.start:
+			return false
+		}
+	}
+	return len(a.Weekdays) == 0 || a.days[day]
+}
+
+func (a *AccessRules) describeWindow() string {
+	var parts []string
+	if len(a.Weekdays) > 0 {
+		parts = append(parts, "on "+strings.Join(a.Weekdays, ", "))
+	}
+	if a.Hours != "" {
+		parts = append(parts, "between "+strings.Replace(a.Hours, "-", " and ", 1))
+	}
+	zone := a.Timezone
+	if zone == "" {
+		zone = "UTC"
+	}
+	return strings.Join(parts, " ") + " (" + zone + ")"
+}
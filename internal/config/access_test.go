@@ -0,0 +1,189 @@
+package config
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   AccessRules
+		wantErr string
+	}{
+		{name: "no rules"},
+		{name: "full weekday names", rules: AccessRules{Weekdays: []string{"Monday", "fri"}}},
+		{name: "window past midnight", rules: AccessRules{Hours: "22:00-06:00"}},
+		{name: "window until midnight", rules: AccessRules{Hours: "18:00-24:00"}},
+		{name: "timezone", rules: AccessRules{Timezone: "Europe/Berlin"}},
+		{name: "unknown timezone", rules: AccessRules{Timezone: "Mars/Olympus"}, wantErr: "invalid timezone"},
+		{name: "unknown weekday", rules: AccessRules{Weekdays: []string{"someday"}}, wantErr: "invalid weekday"},
+		{name: "hours without range", rules: AccessRules{Hours: "09:00"}, wantErr: "expected HH:MM-HH:MM"},
+		{name: "hours out of range", rules: AccessRules{Hours: "09:00-25:00"}, wantErr: "invalid time"},
+		{name: "minutes out of range", rules: AccessRules{Hours: "09:60-17:00"}, wantErr: "invalid time"},
+		{name: "empty window", rules: AccessRules{Hours: "09:00-09:00"}, wantErr: "empty window"},
+		{name: "bad cidr", rules: AccessRules{SourceCIDRs: []string{"10.0.0.0/33"}}, wantErr: "invalid source_cidrs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rules.compile()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("compile() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("compile() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAccessCheck(t *testing.T) {
+	// a Monday
+	monday := func(clock string) time.Time {
+		t, _ := time.Parse(time.RFC3339, "2026-03-16T"+clock+":00Z")
+		return t
+	}
+	office := netip.MustParseAddr("10.1.2.3")
+
+	tests := []struct {
+		name  string
+		rules AccessRules
+		now   time.Time
+		ip    netip.Addr
+		want  string
+	}{
+		{name: "no rules", now: monday("03:00"), ip: office},
+		{name: "inside hours", rules: AccessRules{Hours: "09:00-18:00"}, now: monday("09:00"), ip: office},
+		{name: "end of hours", rules: AccessRules{Hours: "09:00-18:00"}, now: monday("18:00"), ip: office, want: "outside_access_window"},
+		{name: "allowed weekday", rules: AccessRules{Weekdays: []string{"mon"}}, now: monday("12:00"), ip: office},
+		{name: "other weekday", rules: AccessRules{Weekdays: []string{"tue"}}, now: monday("12:00"), ip: office, want: "outside_access_window"},
+		{
+			name:  "night shift after midnight belongs to the day before",
+			rules: AccessRules{Weekdays: []string{"sun"}, Hours: "22:00-06:00"},
+			now:   monday("05:59"), ip: office,
+		},
+		{
+			name:  "night shift started on a day not allowed",
+			rules: AccessRules{Weekdays: []string{"mon"}, Hours: "22:00-06:00"},
+			now:   monday("05:59"), ip: office, want: "outside_access_window",
+		},
+		{
+			name:  "hours in another timezone",
+			rules: AccessRules{Timezone: "Asia/Tokyo", Hours: "09:00-18:00"},
+			now:   monday("01:00"), ip: office,
+		},
+		{name: "allowed source", rules: AccessRules{SourceCIDRs: []string{"10.1.0.0/16"}}, now: monday("12:00"), ip: office},
+		{name: "single address source", rules: AccessRules{SourceCIDRs: []string{"10.1.2.3"}}, now: monday("12:00"), ip: office},
+		{
+			name:  "mapped ipv4 address",
+			rules: AccessRules{SourceCIDRs: []string{"10.1.0.0/16"}},
+			now:   monday("12:00"), ip: netip.MustParseAddr("::ffff:10.1.2.3"),
+		},
+		{name: "other source", rules: AccessRules{SourceCIDRs: []string{"192.168.0.0/24"}}, now: monday("12:00"), ip: office, want: "source_not_allowed"},
+		{name: "before expiry", rules: AccessRules{Expires: monday("12:00")}, now: monday("11:59"), ip: office},
+		{name: "expired", rules: AccessRules{Expires: monday("12:00")}, now: monday("12:00"), ip: office, want: "account_expired"},
+		{
+			name:  "expiry is checked first",
+			rules: AccessRules{Expires: monday("12:00"), SourceCIDRs: []string{"192.168.0.0/24"}},
+			now:   monday("13:00"), ip: office, want: "account_expired",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rules.compile(); err != nil {
+				t.Fatal(err)
+			}
+			reason, message := tt.rules.Check(tt.now, tt.ip)
+			if reason != tt.want {
+				t.Errorf("Check() = %q (%s), want %q", reason, message, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeWindow(t *testing.T) {
+	rules := AccessRules{Weekdays: []string{"mon", "tue"}, Hours: "09:00-17:00", Timezone: "Europe/Berlin"}
+	want := "on mon, tue between 09:00 and 17:00 (Europe/Berlin)"
+	if got := rules.describeWindow(); got != want {
+		t.Errorf("describeWindow() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateAccess(t *testing.T) {
+	tests := []struct {
+		name    string
+		users   string
+		extra   string
+		wantErr string
+	}{
+		{
+			name: "user rules",
+			users: `  - username: "contractor"
+    auth:
+      type: "password"
+      password: "pass"
+    access:
+      weekdays: [mon, tue, wed, thu, fri]
+      hours: "09:00-18:00"
+      source_cidrs: ["10.0.0.0/8"]
+      expires: 2026-12-31T00:00:00Z
+`,
+		},
+		{
+			name: "invalid user rules",
+			users: `  - username: "contractor"
+    auth:
+      type: "password"
+      password: "pass"
+    access:
+      hours: "nine to five"
+`,
+			wantErr: "contractor",
+		},
+		{
+			name: "global cidr lists",
+			extra: `
+security:
+  allow_cidrs: ["10.0.0.0/8", "192.168.1.10"]
+  deny_cidrs: ["10.66.0.0/16"]
+`,
+		},
+		{
+			name: "invalid global cidr",
+			extra: `
+security:
+  deny_cidrs: ["10.66.0.0/99"]
+`,
+			wantErr: "deny_cidrs",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.users != "" {
+				// extra users go at the end of the base user list
+				path := filepath.Join(t.TempDir(), "config.yaml")
+				os.WriteFile(path, []byte(strings.Replace(baseConfig, "logging:", tt.users+"logging:", 1)), 0644)
+				_, err = LoadYAML(path)
+			} else {
+				_, err = loadConfig(t, tt.extra)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("LoadYAML() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadYAML() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
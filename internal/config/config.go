@@ -1,9 +1,18 @@
 package config
 
 import (
+	"crypto/ecdh"
+	"crypto/subtle"
 	"fmt"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
 	"gopkg.in/yaml.v3"
+
+	"github.com/devashar13/ssh-proxy/internal/logger"
 )
 
 
@@ -21,18 +30,104 @@ type Config struct {
 	} `yaml:"upstream"`
 
 	// Users allowed 
-	Users []struct {
-		Username string `yaml:"username"`
-		Auth     struct {
-			Type     string `yaml:"type,omitempty"`
-			Password string `yaml:"password,omitempty"`
-			KeyPath  string `yaml:"key_path,omitempty"`
-		} `yaml:"auth"`
-	} `yaml:"users"`
+	Users []User `yaml:"users"`
+
+	// Session limits for every user, unless overridden per user
+	Session struct {
+		IdleTimeout time.Duration `yaml:"idle_timeout"`
+		MaxDuration time.Duration `yaml:"max_duration"`
+		// How long before a limit is enforced the user is warned
+		WarningPeriod time.Duration `yaml:"warning_period"`
+	} `yaml:"session"`
+
+	// Just-in-time approval of sessions for users with require_approval
+	Approval struct {
+		Timeout time.Duration `yaml:"timeout"`
+		Message string        `yaml:"message"`
+		// Who may decide requests through the admin API, each with their
+		// own token
+		Approvers []Approver `yaml:"approvers"`
+	} `yaml:"approval"`
+
+	// Live viewing of other users' sessions by administrators
+	Shadow struct {
+		Enabled bool `yaml:"enabled"`
+		// Users who may run the shadow commands over SSH
+		Admins []string `yaml:"admins"`
+		// Tell the watched user when someone attaches or leaves
+		NotifyUser bool `yaml:"notify_user"`
+		// Allow "join", where the administrator may also type
+		AllowJoin bool `yaml:"allow_join"`
+	} `yaml:"shadow"`
+
+	// Caps on concurrent use of the proxy; zero means unlimited
+	Limits struct {
+		MaxConnections           int `yaml:"max_connections"`
+		MaxConnectionsPerIP      int `yaml:"max_connections_per_ip"`
+		MaxSessionsPerUser       int `yaml:"max_sessions_per_user"`
+		MaxChannelsPerConnection int `yaml:"max_channels_per_connection"`
+	} `yaml:"limits"`
+
+	// Connection filtering and brute-force protection
+	Security struct {
+		// Source addresses or CIDR ranges checked before the SSH handshake.
+		// Deny entries win; a non-empty allow list rejects everything else.
+		AllowCIDRs []string `yaml:"allow_cidrs,omitempty"`
+		DenyCIDRs  []string `yaml:"deny_cidrs,omitempty"`
+
+		Lockout struct {
+			Enabled bool `yaml:"enabled"`
+			// Failures counted within Window; zero disables that kind of ban
+			Window             time.Duration `yaml:"window"`
+			MaxFailuresPerIP   int           `yaml:"max_failures_per_ip"`
+			MaxFailuresPerUser int           `yaml:"max_failures_per_user"`
+			BanDuration        time.Duration `yaml:"ban_duration"`
+			// Failed attempts are delayed by BackoffBase, doubling per recent
+			// failure up to BackoffMax
+			BackoffBase time.Duration `yaml:"backoff_base"`
+			BackoffMax  time.Duration `yaml:"backoff_max"`
+			BanFile     string        `yaml:"ban_file,omitempty"`
+		} `yaml:"lockout"`
+	} `yaml:"security"`
 
 	// Logging configuration
 	Logging struct {
 		Directory string `yaml:"directory"`
+		// JSON lines file of session metadata (default <directory>/sessions.jsonl)
+		SessionStore string `yaml:"session_store,omitempty"`
+
+		// Hash-chain every log so that later edits can be detected
+		Integrity struct {
+			Enabled bool `yaml:"enabled"`
+			// Use HMAC-SHA256 with this key instead of plain SHA-256
+			HMACKey string `yaml:"hmac_key,omitempty"`
+		} `yaml:"integrity"`
+
+		// Encrypt logs and summaries so that the proxy can write but not
+		// read them
+		Encryption struct {
+			Enabled bool `yaml:"enabled"`
+			// Base64 X25519 public key, from "ssh-proxy keygen"
+			PublicKey string `yaml:"public_key"`
+		} `yaml:"encryption"`
+
+		// Compress, delete or archive finished logs
+		Retention struct {
+			Enabled bool `yaml:"enabled"`
+			// How often the logs are checked (default 1h)
+			Interval time.Duration `yaml:"interval"`
+			// "gzip" (default) or "none"
+			Compression string `yaml:"compression"`
+			// Compress logs once they are this old (default 1h)
+			CompressAfter time.Duration `yaml:"compress_after"`
+			// Remove logs older than this; zero keeps them forever
+			MaxAge time.Duration `yaml:"max_age"`
+			// Remove the oldest logs once the directory is larger; zero
+			// means no limit
+			MaxTotalSize ByteSize `yaml:"max_total_size"`
+			// Move removed logs here instead of deleting them
+			ArchiveDirectory string `yaml:"archive_directory"`
+		} `yaml:"retention"`
 	} `yaml:"logging"`
 
 	// LLM
@@ -41,15 +136,214 @@ type Config struct {
 		APIKey   string `yaml:"api_key"`
 		Provider string `yaml:"provider"`
 		Model    string `yaml:"model"`
+
+		// Optional text/template file for the session analysis prompt
+		PromptTemplate string `yaml:"prompt_template,omitempty"`
+		SystemPrompt   string `yaml:"system_prompt,omitempty"`
+
+		// Token accounting and spend caps
+		Usage struct {
+			Ledger        string                `yaml:"ledger,omitempty"`
+			Prices        map[string]ModelPrice `yaml:"prices,omitempty"`
+			DailyBudget   float64               `yaml:"daily_budget,omitempty"`
+			MonthlyBudget float64               `yaml:"monthly_budget,omitempty"`
+		} `yaml:"usage"`
+
+		// Live analysis of commands while the session is still open
+		Live struct {
+			Enabled        bool   `yaml:"enabled"`
+			Threshold      string `yaml:"threshold"`
+			Action         string `yaml:"action"`
+			WarningMessage string `yaml:"warning_message,omitempty"`
+		} `yaml:"live"`
 	} `yaml:"llm"`
 
+	// Alert notifications
+	Alerts struct {
+		Enabled  bool `yaml:"enabled"`
+		Triggers struct {
+			AuthFailures      int           `yaml:"auth_failures"`
+			AuthFailureWindow time.Duration `yaml:"auth_failure_window"`
+			PolicyDenials     bool          `yaml:"policy_denials"`
+			SummaryRisk       string        `yaml:"summary_risk"`
+			LiveRisk          bool          `yaml:"live_risk"`
+		} `yaml:"triggers"`
+		Sinks []AlertSink `yaml:"sinks"`
+	} `yaml:"alerts"`
+
+	// Index commands of finished sessions for "ssh-proxy search"
+	Search struct {
+		Enabled bool `yaml:"enabled"`
+		// JSON lines file (default <logging directory>/search_index.jsonl)
+		Index string `yaml:"index,omitempty"`
+	} `yaml:"search"`
+
+	// Forward audit events, and optionally transcripts, to collectors
+	Shipping struct {
+		// Also ship what is written to session logs, line by line
+		Transcripts bool `yaml:"transcripts"`
+		// Where events wait while a collector is unreachable (default
+		// <logging directory>/shipping) and how large that may grow
+		BufferDirectory string   `yaml:"buffer_directory"`
+		BufferMaxSize   ByteSize `yaml:"buffer_max_size"`
+
+		// RFC 5424 syslog
+		Syslog struct {
+			Enabled bool `yaml:"enabled"`
+			// "udp", "tcp" or "tls"
+			Network  string `yaml:"network"`
+			Address  string `yaml:"address"`
+			Facility string `yaml:"facility"`
+			AppName  string `yaml:"app_name"`
+			// CA bundle to verify the collector with, for "tls"
+			CAFile string `yaml:"ca_file"`
+		} `yaml:"syslog"`
+
+		// HTTP bulk endpoint
+		HTTP struct {
+			Enabled bool   `yaml:"enabled"`
+			URL     string `yaml:"url"`
+			// "ndjson", "elasticsearch" (_bulk API) or "loki" (push API)
+			Format string `yaml:"format"`
+			// Elasticsearch index or data stream
+			Index         string            `yaml:"index"`
+			Headers       map[string]string `yaml:"headers"`
+			BatchSize     int               `yaml:"batch_size"`
+			FlushInterval time.Duration     `yaml:"flush_interval"`
+		} `yaml:"http"`
+	} `yaml:"shipping"`
+
+	// Admin HTTP API
+	Admin struct {
+		Enabled bool   `yaml:"enabled"`
+		Listen  string `yaml:"listen"`
+		Token   string `yaml:"token"`
+	} `yaml:"admin"`
+
+	// Prometheus metrics endpoint
+	Metrics struct {
+		Enabled bool   `yaml:"enabled"`
+		Listen  string `yaml:"listen"`
+	} `yaml:"metrics"`
+
 	// ssh server config
 	Server struct {
 		HostKeyPath string `yaml:"host_key_path"`
 		Port        int    `yaml:"port"`
+
+		// How long open sessions get to finish on shutdown, and what they are told
+		ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+		ShutdownMessage string        `yaml:"shutdown_message"`
 	} `yaml:"server"`
 }
 
+// User is a client allowed to connect to the proxy
+type User struct {
+	Username string `yaml:"username"`
+	Auth     struct {
+		Type     string `yaml:"type,omitempty"`
+		Password string `yaml:"password,omitempty"`
+		KeyPath  string `yaml:"key_path,omitempty"`
+	} `yaml:"auth"`
+
+	// Override the global session limits; zero keeps the global value
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty"`
+	MaxDuration time.Duration `yaml:"max_duration,omitempty"`
+
+	Access AccessRules `yaml:"access,omitempty"`
+
+	// Hold every session until an approver accepts it
+	RequireApproval bool `yaml:"require_approval,omitempty"`
+
+	// Let "ssh -A" forward the user's agent to the upstream
+	ForwardAgent bool `yaml:"forward_agent,omitempty"`
+
+	// Let "ssh -X" forward X11 from the upstream to the user's display
+	ForwardX11 bool `yaml:"forward_x11,omitempty"`
+}
+
+// Approver may accept or reject held sessions. The name is recorded as the
+// approver and should be their SSH username, so that they cannot approve
+// their own sessions.
+type Approver struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+}
+
+// FindApprover returns the approver the token belongs to
+func (c *Config) FindApprover(token string) *Approver {
+	for i := range c.Approval.Approvers {
+		if subtle.ConstantTimeCompare([]byte(c.Approval.Approvers[i].Token), []byte(token)) == 1 {
+			return &c.Approval.Approvers[i]
+		}
+	}
+	return nil
+}
+
+// FindUser returns the first user entry with the given name
+func (c *Config) FindUser(username string) *User {
+	for i := range c.Users {
+		if c.Users[i].Username == username {
+			return &c.Users[i]
+		}
+	}
+	return nil
+}
+
+// SessionLimits returns the idle timeout and maximum session duration that
+// apply to username; zero means no limit
+func (c *Config) SessionLimits(username string) (idle, max time.Duration) {
+	idle, max = c.Session.IdleTimeout, c.Session.MaxDuration
+	if user := c.FindUser(username); user != nil {
+		if user.IdleTimeout != 0 {
+			idle = user.IdleTimeout
+		}
+		if user.MaxDuration != 0 {
+			max = user.MaxDuration
+		}
+	}
+	return idle, max
+}
+
+// LogRecipient returns the key logs and summaries are encrypted to, or nil
+// if they are written in the clear
+func (c *Config) LogRecipient() *ecdh.PublicKey {
+	if !c.Logging.Encryption.Enabled {
+		return nil
+	}
+	// the key was validated when the configuration was loaded
+	key, _ := logger.ParsePublicKey(c.Logging.Encryption.PublicKey)
+	return key
+}
+
+// ModelPrice is the cost in USD per 1,000 tokens for one model
+type ModelPrice struct {
+	Prompt     float64 `yaml:"prompt"`
+	Completion float64 `yaml:"completion"`
+}
+
+// AlertSink is one destination for alert notifications. Which fields are
+// used depends on Type: webhook, slack, email or exec.
+type AlertSink struct {
+	Type   string   `yaml:"type"`
+	Events []string `yaml:"events,omitempty"`
+
+	// webhook and slack
+	URL    string `yaml:"url,omitempty"`
+	Secret string `yaml:"secret,omitempty"`
+
+	// email
+	SMTPHost string   `yaml:"smtp_host,omitempty"`
+	SMTPPort int      `yaml:"smtp_port,omitempty"`
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"`
+	From     string   `yaml:"from,omitempty"`
+	To       []string `yaml:"to,omitempty"`
+
+	// exec
+	Command []string `yaml:"command,omitempty"`
+}
+
 func LoadYAML(path string) (*Config,error){
 	data,err := os.ReadFile(path)
 	if err != nil {
@@ -60,6 +354,41 @@ func LoadYAML(path string) (*Config,error){
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 	// TODO: add default port
+	if cfg.LLM.Live.Threshold == "" {
+		cfg.LLM.Live.Threshold = "high"
+	}
+	if cfg.LLM.Live.Action == "" {
+		cfg.LLM.Live.Action = "alert"
+	}
+	if cfg.Session.WarningPeriod == 0 {
+		cfg.Session.WarningPeriod = time.Minute
+	}
+	if cfg.Server.ShutdownTimeout == 0 {
+		cfg.Server.ShutdownTimeout = 30 * time.Second
+	}
+	if cfg.Server.ShutdownMessage == "" {
+		cfg.Server.ShutdownMessage = "The SSH proxy is shutting down. Please save your work; this session will be closed shortly."
+	}
+	if cfg.Alerts.Triggers.AuthFailureWindow == 0 {
+		cfg.Alerts.Triggers.AuthFailureWindow = 10 * time.Minute
+	}
+	if cfg.Approval.Timeout == 0 {
+		cfg.Approval.Timeout = 5 * time.Minute
+	}
+	if cfg.Approval.Message == "" {
+		cfg.Approval.Message = "This session requires approval. Waiting for an approver..."
+	}
+	if cfg.Logging.Retention.Interval == 0 {
+		cfg.Logging.Retention.Interval = time.Hour
+	}
+	if cfg.Logging.Retention.Compression == "" {
+		cfg.Logging.Retention.Compression = "gzip"
+	}
+	if cfg.Logging.Retention.CompressAfter == 0 {
+		cfg.Logging.Retention.CompressAfter = time.Hour
+	}
+	setLockoutDefaults(&cfg)
+	setShippingDefaults(&cfg)
 
 	if err := validate(&cfg); err != nil {
 		return nil, err
@@ -93,9 +422,252 @@ func validate(cfg *Config) error{
 	if len(cfg.Users) == 0 {
 		return fmt.Errorf("no users specified")
 	}
+	for i := range cfg.Users {
+		if err := cfg.Users[i].Access.compile(); err != nil {
+			return fmt.Errorf("user %s: access: %w", cfg.Users[i].Username, err)
+		}
+	}
 	if cfg.Logging.Directory == "" {
 		return fmt.Errorf("log directory not specified")
 	}
+	switch cfg.Logging.Retention.Compression {
+	case "gzip", "none":
+	default:
+		return fmt.Errorf("invalid logging retention compression: %s (expected gzip or none)", cfg.Logging.Retention.Compression)
+	}
+	if cfg.Logging.Retention.Interval < 0 || cfg.Logging.Retention.CompressAfter < 0 || cfg.Logging.Retention.MaxAge < 0 {
+		return fmt.Errorf("logging retention durations must not be negative")
+	}
+	if archive := cfg.Logging.Retention.ArchiveDirectory; archive != "" && filepath.Clean(archive) == filepath.Clean(cfg.Logging.Directory) {
+		return fmt.Errorf("logging retention archive_directory must differ from the logging directory")
+	}
+	if cfg.Logging.Encryption.Enabled {
+		if _, err := logger.ParsePublicKey(cfg.Logging.Encryption.PublicKey); err != nil {
+			return fmt.Errorf("logging encryption: %w", err)
+		}
+		// the index would keep every command readable on the proxy host
+		if cfg.Search.Enabled {
+			return fmt.Errorf("search cannot be enabled with logging encryption: the search index is not encrypted")
+		}
+		// shipped transcripts would carry the session contents in the clear
+		if cfg.Shipping.Transcripts {
+			return fmt.Errorf("shipping transcripts cannot be enabled with logging encryption: transcripts are shipped in plaintext")
+		}
+	}
+	if usage := cfg.LLM.Usage; cfg.LLM.Enabled && (usage.DailyBudget > 0 || usage.MonthlyBudget > 0) {
+		// without a price every request would cost nothing and the budget
+		// would never be reached
+		if _, ok := usage.Prices[cfg.LLM.Model]; !ok {
+			return fmt.Errorf("llm usage budgets need a price for model %q in llm.usage.prices", cfg.LLM.Model)
+		}
+	}
+	if cfg.LLM.Live.Enabled {
+		switch cfg.LLM.Live.Threshold {
+		case "low", "medium", "high":
+		default:
+			return fmt.Errorf("invalid live analysis threshold: %s", cfg.LLM.Live.Threshold)
+		}
+		switch cfg.LLM.Live.Action {
+		case "alert", "warn", "terminate":
+		default:
+			return fmt.Errorf("invalid live analysis action: %s", cfg.LLM.Live.Action)
+		}
+	}
+	if _, err := ParsePrefixes(cfg.Security.AllowCIDRs); err != nil {
+		return fmt.Errorf("invalid security allow_cidrs: %w", err)
+	}
+	if _, err := ParsePrefixes(cfg.Security.DenyCIDRs); err != nil {
+		return fmt.Errorf("invalid security deny_cidrs: %w", err)
+	}
+	if cfg.Admin.Enabled {
+		if cfg.Admin.Listen == "" {
+			return fmt.Errorf("admin listen address not specified")
+		}
+		if cfg.Admin.Token == "" {
+			return fmt.Errorf("admin token not specified")
+		}
+	}
+	if err := validateApproval(cfg); err != nil {
+		return err
+	}
+	if cfg.Metrics.Enabled && cfg.Metrics.Listen == "" {
+		return fmt.Errorf("metrics listen address not specified")
+	}
+	if cfg.Alerts.Enabled {
+		if err := validateAlerts(cfg); err != nil {
+			return err
+		}
+	}
+	if err := validateShipping(cfg); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateAlerts(cfg *Config) error {
+	switch cfg.Alerts.Triggers.SummaryRisk {
+	case "", "low", "medium", "high":
+	default:
+		return fmt.Errorf("invalid alert summary risk: %s", cfg.Alerts.Triggers.SummaryRisk)
+	}
+	for i, sink := range cfg.Alerts.Sinks {
+		switch sink.Type {
+		case "webhook", "slack":
+			if sink.URL == "" {
+				return fmt.Errorf("alert sink #%d: url not specified", i+1)
+			}
+		case "email":
+			if sink.SMTPHost == "" || sink.From == "" || len(sink.To) == 0 {
+				return fmt.Errorf("alert sink #%d: smtp_host, from and to are required", i+1)
+			}
+		case "exec":
+			if len(sink.Command) == 0 {
+				return fmt.Errorf("alert sink #%d: command not specified", i+1)
+			}
+		default:
+			return fmt.Errorf("alert sink #%d: invalid type: %s", i+1, sink.Type)
+		}
+	}
 	return nil
 }
 
+func setShippingDefaults(cfg *Config) {
+	shipping := &cfg.Shipping
+	if shipping.BufferDirectory == "" && cfg.Logging.Directory != "" {
+		shipping.BufferDirectory = filepath.Join(cfg.Logging.Directory, "shipping")
+	}
+	if shipping.BufferMaxSize == 0 {
+		shipping.BufferMaxSize = 100 << 20
+	}
+	if shipping.Syslog.Network == "" {
+		shipping.Syslog.Network = "udp"
+	}
+	if shipping.Syslog.Facility == "" {
+		shipping.Syslog.Facility = "authpriv"
+	}
+	if shipping.Syslog.AppName == "" {
+		shipping.Syslog.AppName = "ssh-proxy"
+	}
+	if shipping.HTTP.Format == "" {
+		shipping.HTTP.Format = "ndjson"
+	}
+	if shipping.HTTP.Index == "" {
+		shipping.HTTP.Index = "ssh-proxy"
+	}
+	if shipping.HTTP.BatchSize == 0 {
+		shipping.HTTP.BatchSize = 100
+	}
+	if shipping.HTTP.FlushInterval == 0 {
+		shipping.HTTP.FlushInterval = 5 * time.Second
+	}
+}
+
+func validateApproval(cfg *Config) error {
+	tokens := make(map[string]bool)
+	for _, a := range cfg.Approval.Approvers {
+		if a.Name == "" || a.Token == "" {
+			return fmt.Errorf("approval approvers need a name and a token")
+		}
+		if tokens[a.Token] || a.Token == cfg.Admin.Token {
+			return fmt.Errorf("approver %s: token must be unique and differ from the admin token", a.Name)
+		}
+		tokens[a.Token] = true
+	}
+	for _, user := range cfg.Users {
+		if !user.RequireApproval {
+			continue
+		}
+		if len(cfg.Approval.Approvers) == 0 {
+			return fmt.Errorf("user %s requires approval but no approval approvers are configured", user.Username)
+		}
+		// approvers decide through the admin API
+		if !cfg.Admin.Enabled {
+			return fmt.Errorf("user %s requires approval but the admin API is not enabled", user.Username)
+		}
+	}
+	return nil
+}
+
+func validateShipping(cfg *Config) error {
+	syslog := cfg.Shipping.Syslog
+	if syslog.Enabled {
+		switch syslog.Network {
+		case "udp", "tcp", "tls":
+		default:
+			return fmt.Errorf("invalid syslog network: %s (expected udp, tcp or tls)", syslog.Network)
+		}
+		if syslog.Address == "" {
+			return fmt.Errorf("syslog address not specified")
+		}
+		if _, ok := SyslogFacilities[syslog.Facility]; !ok {
+			return fmt.Errorf("invalid syslog facility: %s", syslog.Facility)
+		}
+	}
+	http := cfg.Shipping.HTTP
+	if http.Enabled {
+		switch http.Format {
+		case "ndjson", "elasticsearch", "loki":
+		default:
+			return fmt.Errorf("invalid shipping http format: %s (expected ndjson, elasticsearch or loki)", http.Format)
+		}
+		if http.URL == "" {
+			return fmt.Errorf("shipping http url not specified")
+		}
+		if http.BatchSize < 0 || http.FlushInterval < 0 {
+			return fmt.Errorf("shipping http batch_size and flush_interval must not be negative")
+		}
+	}
+	return nil
+}
+
+// SyslogFacilities maps facility names to their RFC 5424 codes
+var SyslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+func setLockoutDefaults(cfg *Config) {
+	lockout := &cfg.Security.Lockout
+	if lockout.Window == 0 {
+		lockout.Window = 10 * time.Minute
+	}
+	if lockout.MaxFailuresPerIP == 0 {
+		lockout.MaxFailuresPerIP = 5
+	}
+	if lockout.BanDuration == 0 {
+		lockout.BanDuration = 15 * time.Minute
+	}
+	if lockout.BackoffBase == 0 {
+		lockout.BackoffBase = time.Second
+	}
+	if lockout.BackoffMax == 0 {
+		lockout.BackoffMax = 30 * time.Second
+	}
+	if lockout.BanFile == "" && cfg.Logging.Directory != "" {
+		lockout.BanFile = filepath.Join(cfg.Logging.Directory, "bans.json")
+	}
+}
+
+// ParsePrefixes parses a list of CIDR ranges; a bare address is taken as
+// a range holding just that address
+func ParsePrefixes(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, entry := range list {
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
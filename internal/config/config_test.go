@@ -0,0 +1,493 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/logger"
+)
+
+const baseConfig = `
+upstream:
+  host: "localhost"
+  port: 22
+  username: "admin"
+  auth:
+    type: "password"
+    password: "secret"
+users:
+  - username: "user1"
+    auth:
+      type: "password"
+      password: "user1pass"
+logging:
+  directory: "./logs"
+`
+
+// loadConfig loads the base config with extra YAML appended
+func loadConfig(t *testing.T, extra string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(baseConfig+extra), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return LoadYAML(path)
+}
+
+func TestParsePrefixes(t *testing.T) {
+	got, err := ParsePrefixes([]string{"10.1.2.3/8", "203.0.113.5", "::ffff:10.0.0.1", "2001:db8::1/32"})
+	if err != nil {
+		t.Fatalf("ParsePrefixes() error = %v", err)
+	}
+	var names []string
+	for _, p := range got {
+		names = append(names, p.String())
+	}
+	if want := "10.0.0.0/8 203.0.113.5/32 10.0.0.1/32 2001:db8::/32"; strings.Join(names, " ") != want {
+		t.Errorf("ParsePrefixes() = %v, want %s", names, want)
+	}
+
+	for _, bad := range []string{"10.0.0.0/33", "example.com", ""} {
+		if _, err := ParsePrefixes([]string{bad}); err == nil {
+			t.Errorf("ParsePrefixes(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestValidateSecurity(t *testing.T) {
+	tests := []struct {
+		name     string
+		security string
+		wantErr  string
+	}{
+		{
+			name: "valid lists",
+			security: `
+security:
+  allow_cidrs: ["10.0.0.0/8", "192.0.2.7"]
+  deny_cidrs: ["10.66.0.0/16"]
+`,
+		},
+		{
+			name: "invalid allow entry",
+			security: `
+security:
+  allow_cidrs: ["10.0.0.0/8", "office"]
+`,
+			wantErr: "invalid security allow_cidrs",
+		},
+		{
+			name: "invalid deny entry",
+			security: `
+security:
+  deny_cidrs: ["203.0.113.0/40"]
+`,
+			wantErr: "invalid security deny_cidrs",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadConfig(t, tt.security)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadYAML() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadYAML() error = %v", err)
+			}
+			lockout := cfg.Security.Lockout
+			if lockout.Window != 10*time.Minute || lockout.MaxFailuresPerIP != 5 || lockout.BanFile != filepath.Join("logs", "bans.json") {
+				t.Errorf("lockout defaults = %+v", lockout)
+			}
+		})
+	}
+}
+
+func TestValidateEncryption(t *testing.T) {
+	key, err := logger.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := logger.EncodeKey(key.PublicKey())
+	tests := []struct {
+		name    string
+		logging string
+		wantErr string
+	}{
+		{
+			name:    "valid key",
+			logging: "  encryption:\n    enabled: true\n    public_key: \"" + publicKey + "\"\n",
+		},
+		{
+			name:    "missing key",
+			logging: "  encryption:\n    enabled: true\n",
+			wantErr: "logging encryption",
+		},
+		{
+			name:    "invalid key",
+			logging: "  encryption:\n    enabled: true\n    public_key: \"bm90IGEga2V5\"\n",
+			wantErr: "logging encryption",
+		},
+		{
+			name:    "disabled",
+			logging: "  encryption:\n    enabled: false\n    public_key: \"bm90IGEga2V5\"\n",
+		},
+		{
+			name:    "search index",
+			logging: "  encryption:\n    enabled: true\n    public_key: \"" + publicKey + "\"\nsearch:\n  enabled: true\n",
+			wantErr: "search cannot be enabled with logging encryption",
+		},
+		{
+			name:    "shipped transcripts",
+			logging: "  encryption:\n    enabled: true\n    public_key: \"" + publicKey + "\"\nshipping:\n  transcripts: true\n",
+			wantErr: "shipping transcripts cannot be enabled with logging encryption",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadConfig(t, tt.logging)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadYAML() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadYAML() error = %v", err)
+			}
+			if (cfg.LogRecipient() != nil) != cfg.Logging.Encryption.Enabled {
+				t.Errorf("LogRecipient() = %v with encryption enabled %v", cfg.LogRecipient(), cfg.Logging.Encryption.Enabled)
+			}
+		})
+	}
+}
+
+func TestValidateRetention(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention string
+		wantErr   string
+	}{
+		{name: "defaults", retention: "{enabled: true}"},
+		{name: "archive elsewhere", retention: "{enabled: true, max_age: 720h, max_total_size: 10GiB, archive_directory: ./archive}"},
+		{name: "unknown compression", retention: "{compression: zstd}", wantErr: "invalid logging retention compression: zstd"},
+		{name: "negative age", retention: "{max_age: -1h}", wantErr: "must not be negative"},
+		{name: "archive is the log directory", retention: "{archive_directory: ./logs/}", wantErr: "must differ from the logging directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadConfig(t, "  retention: "+tt.retention+"\n")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadYAML() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadYAML() error = %v", err)
+			}
+			retention := cfg.Logging.Retention
+			if retention.Interval != time.Hour || retention.Compression != "gzip" || retention.CompressAfter != time.Hour {
+				t.Errorf("retention defaults = %+v", retention)
+			}
+		})
+	}
+}
+
+func TestValidateBudgetPrices(t *testing.T) {
+	tests := []struct {
+		name    string
+		llm     string
+		wantErr string
+	}{
+		{
+			name: "budget with price",
+			llm: `
+llm:
+  enabled: true
+  model: "gpt-4o"
+  usage:
+    daily_budget: 5
+    prices:
+      gpt-4o: {prompt: 0.005, completion: 0.015}
+`,
+		},
+		{
+			name: "daily budget without price",
+			llm: `
+llm:
+  enabled: true
+  model: "gpt-4o"
+  usage:
+    daily_budget: 5
+    prices:
+      other: {prompt: 0.005, completion: 0.015}
+`,
+			wantErr: `need a price for model "gpt-4o"`,
+		},
+		{
+			name: "monthly budget without prices",
+			llm: `
+llm:
+  enabled: true
+  model: "gpt-4o"
+  usage:
+    monthly_budget: 50
+`,
+			wantErr: `need a price for model "gpt-4o"`,
+		},
+		{
+			name: "no budget without prices",
+			llm: `
+llm:
+  enabled: true
+  model: "gpt-4o"
+`,
+		},
+		{
+			name: "budget with llm disabled",
+			llm: `
+llm:
+  enabled: false
+  model: "gpt-4o"
+  usage:
+    daily_budget: 5
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfig(t, tt.llm)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadYAML() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadYAML() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateApproval(t *testing.T) {
+	tests := []struct {
+		name      string
+		approvers []Approver
+		admin     string
+		noAPI     bool
+		required  bool
+		wantErr   string
+	}{
+		{
+			name:      "approvers with distinct tokens",
+			approvers: []Approver{{Name: "alice", Token: "a"}, {Name: "carol", Token: "c"}},
+			admin:     "admin",
+			required:  true,
+		},
+		{
+			name: "no approvers and nobody requires approval",
+		},
+		{
+			name:     "approval required without approvers",
+			required: true,
+			wantErr:  "no approval approvers",
+		},
+		{
+			name:      "approval required without the admin API",
+			approvers: []Approver{{Name: "alice", Token: "a"}},
+			noAPI:     true,
+			required:  true,
+			wantErr:   "user bob requires approval but the admin API is not enabled",
+		},
+		{
+			name:      "approvers without the admin API",
+			approvers: []Approver{{Name: "alice", Token: "a"}},
+			noAPI:     true,
+		},
+		{
+			name:      "approver without token",
+			approvers: []Approver{{Name: "alice"}},
+			wantErr:   "need a name and a token",
+		},
+		{
+			name:      "approver without name",
+			approvers: []Approver{{Token: "a"}},
+			wantErr:   "need a name and a token",
+		},
+		{
+			name:      "shared approver token",
+			approvers: []Approver{{Name: "alice", Token: "a"}, {Name: "carol", Token: "a"}},
+			wantErr:   "approver carol: token must be unique",
+		},
+		{
+			name:      "approver token equal to the admin token",
+			approvers: []Approver{{Name: "alice", Token: "admin"}},
+			admin:     "admin",
+			wantErr:   "approver alice: token must be unique",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{}
+			cfg.Admin.Enabled = !tt.noAPI
+			cfg.Admin.Token = tt.admin
+			cfg.Approval.Approvers = tt.approvers
+			cfg.Users = []User{{Username: "bob", RequireApproval: tt.required}}
+
+			err := validateApproval(cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateApproval() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validateApproval() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFindApprover(t *testing.T) {
+	cfg := &Config{}
+	cfg.Approval.Approvers = []Approver{{Name: "alice", Token: "a-token"}, {Name: "carol", Token: "c-token"}}
+
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{"a-token", "alice"},
+		{"c-token", "carol"},
+		{"a-tok", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if a := cfg.FindApprover(tt.token); a != nil {
+			got = a.Name
+		}
+		if got != tt.want {
+			t.Errorf("FindApprover(%q) = %q, want %q", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestValidateShipping(t *testing.T) {
+	tests := []struct {
+		name     string
+		shipping string
+		wantErr  string
+	}{
+		{
+			name: "syslog and http",
+			shipping: `
+shipping:
+  syslog:
+    enabled: true
+    network: "tls"
+    address: "logs.internal:6514"
+    facility: "local3"
+  http:
+    enabled: true
+    url: "http://loki.internal:3100/loki/api/v1/push"
+    format: "loki"
+`,
+		},
+		{
+			name: "syslog without address",
+			shipping: `
+shipping:
+  syslog:
+    enabled: true
+`,
+			wantErr: "syslog address not specified",
+		},
+		{
+			name: "unknown syslog network",
+			shipping: `
+shipping:
+  syslog:
+    enabled: true
+    network: "sctp"
+    address: "logs.internal:514"
+`,
+			wantErr: "invalid syslog network",
+		},
+		{
+			name: "unknown syslog facility",
+			shipping: `
+shipping:
+  syslog:
+    enabled: true
+    address: "logs.internal:514"
+    facility: "local9"
+`,
+			wantErr: "invalid syslog facility",
+		},
+		{
+			name: "http without url",
+			shipping: `
+shipping:
+  http:
+    enabled: true
+`,
+			wantErr: "shipping http url not specified",
+		},
+		{
+			name: "unknown http format",
+			shipping: `
+shipping:
+  http:
+    enabled: true
+    url: "http://collector.internal/"
+    format: "splunk"
+`,
+			wantErr: "invalid shipping http format",
+		},
+		{
+			name: "negative batch size",
+			shipping: `
+shipping:
+  http:
+    enabled: true
+    url: "http://collector.internal/"
+    batch_size: -1
+`,
+			wantErr: "must not be negative",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfig(t, tt.shipping)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadYAML() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadYAML() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShippingDefaults(t *testing.T) {
+	cfg, err := loadConfig(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cfg.Shipping
+	if s.BufferDirectory != filepath.Join("./logs", "shipping") || s.BufferMaxSize != 100<<20 ||
+		s.Syslog.Network != "udp" || s.Syslog.Facility != "authpriv" || s.HTTP.Format != "ndjson" ||
+		s.HTTP.BatchSize != 100 || s.HTTP.FlushInterval != 5*time.Second {
+		t.Errorf("defaults = %+v", s)
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// restartOnly lists settings that are read once at startup; changing them
+// in a reload is reported but has no effect until the proxy restarts
+var restartOnly = []string{"server", "admin", "metrics", "security.lockout.ban_file", "shipping"}
+
+// secret settings are reported as changed without showing their values
+var secretFields = map[string]bool{"password": true, "api_key": true, "token": true, "secret": true, "hmac_key": true}
+
+// Diff describes every setting that differs between old and new, one
+// human-readable line per change
+func Diff(old, new *Config) []string {
+	var changes []string
+	diffValue(&changes, "", reflect.ValueOf(*old), reflect.ValueOf(*new))
+	return changes
+}
+
+// RequiresRestart reports whether a Diff line refers to a startup-only setting
+func RequiresRestart(change string) bool {
+	for _, prefix := range restartOnly {
+		if strings.HasPrefix(change, prefix+".") || strings.HasPrefix(change, prefix+":") {
+			return true
+		}
+	}
+	return false
+}
+
+func diffValue(changes *[]string, path string, old, new reflect.Value) {
+	if path == "users" {
+		diffUsers(changes, old, new)
+		return
+	}
+
+	if old.Kind() == reflect.Struct && old.Type() != reflect.TypeOf(time.Time{}) {
+		t := old.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name := yamlName(t.Field(i))
+			if name == "-" || !t.Field(i).IsExported() {
+				continue
+			}
+			diffValue(changes, joinPath(path, name), old.Field(i), new.Field(i))
+		}
+		return
+	}
+
+	if reflect.DeepEqual(old.Interface(), new.Interface()) {
+		return
+	}
+	switch old.Kind() {
+	case reflect.Slice, reflect.Map:
+		// lists such as alert sinks may hold credentials, so don't print them
+		*changes = append(*changes, fmt.Sprintf("%s: changed", path))
+	default:
+		*changes = append(*changes, fmt.Sprintf("%s: %s -> %s", path, display(path, old), display(path, new)))
+	}
+}
+
+// diffUsers reports users by name rather than by position in the list
+func diffUsers(changes *[]string, old, new reflect.Value) {
+	oldUsers := make(map[string]reflect.Value)
+	for i := 0; i < old.Len(); i++ {
+		oldUsers[old.Index(i).FieldByName("Username").String()] = old.Index(i)
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < new.Len(); i++ {
+		user := new.Index(i)
+		name := user.FieldByName("Username").String()
+		seen[name] = true
+		prev, ok := oldUsers[name]
+		if !ok {
+			*changes = append(*changes, fmt.Sprintf("users: added %s", name))
+			continue
+		}
+		diffValue(changes, "users["+name+"]", prev, user)
+	}
+	for name := range oldUsers {
+		if !seen[name] {
+			*changes = append(*changes, fmt.Sprintf("users: removed %s", name))
+		}
+	}
+}
+
+func display(path string, v reflect.Value) string {
+	if secretFields[path[strings.LastIndex(path, ".")+1:]] {
+		return "(redacted)"
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+func yamlName(f reflect.StructField) string {
+	tag := f.Tag.Get("yaml")
+	if tag == "" {
+		return strings.ToLower(f.Name)
+	}
+	return strings.Split(tag, ",")[0]
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(cfg *Config)
+		want   []string
+	}{
+		{
+			name:   "no changes",
+			change: func(cfg *Config) {},
+		},
+		{
+			name:   "scalar setting",
+			change: func(cfg *Config) { cfg.Upstream.Port = 2222 },
+			want:   []string{"upstream.port: 22 -> 2222"},
+		},
+		{
+			name:   "duration",
+			change: func(cfg *Config) { cfg.Alerts.Triggers.AuthFailureWindow = time.Minute },
+			want:   []string{"alerts.triggers.auth_failure_window: 10m0s -> 1m0s"},
+		},
+		{
+			name:   "secret is redacted",
+			change: func(cfg *Config) { cfg.Upstream.Auth.Password = "hunter2" },
+			want:   []string{"upstream.auth.password: (redacted) -> (redacted)"},
+		},
+		{
+			name: "user changed",
+			change: func(cfg *Config) {
+				cfg.Users[0].Auth.Password = "new"
+			},
+			want: []string{"users[user1].auth.password: (redacted) -> (redacted)"},
+		},
+		{
+			name: "users added and removed",
+			change: func(cfg *Config) {
+				cfg.Users[0].Username = "user2"
+			},
+			want: []string{"users: added user2", "users: removed user1"},
+		},
+		{
+			name: "list setting",
+			change: func(cfg *Config) {
+				cfg.Alerts.Sinks = []AlertSink{{Type: "webhook", URL: "http://localhost/hook"}}
+			},
+			want: []string{"alerts.sinks: changed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, err := loadConfig(t, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			new, err := loadConfig(t, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(new)
+			got := Diff(old, new)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Diff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequiresRestart(t *testing.T) {
+	tests := []struct {
+		change string
+		want   bool
+	}{
+		{"server.port: 2222 -> 2223", true},
+		{"admin.token: (redacted) -> (redacted)", true},
+		{"metrics.enabled: false -> true", true},
+		{"security.lockout.ban_file: a -> b", true},
+		{"security.lockout.max_failures: 5 -> 3", false},
+		{"shipping.destinations: changed", true},
+		{"upstream.port: 22 -> 2222", false},
+		{"users: added alice", false},
+		{"serverless.mode: a -> b", false},
+	}
+	for _, tt := range tests {
+		if got := RequiresRestart(tt.change); got != tt.want {
+			t.Errorf("RequiresRestart(%q) = %v, want %v", tt.change, got, tt.want)
+		}
+	}
+}
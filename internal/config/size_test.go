@@ -0,0 +1,45 @@
+package config
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ByteSize
+		wantErr bool
+	}{
+		{"1024", 1024, false},
+		{"500MB", 500e6, false},
+		{"10GiB", 10 << 30, false},
+		{"1.5 KiB", 1536, false},
+		{"2m", 2 << 20, false},
+		{"64B", 64, false},
+		{" 1 tb ", 1e12, false},
+		{"MB", 0, true},
+		{"-1GB", 0, true},
+		{"ten", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseByteSize(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestByteSizeYAML(t *testing.T) {
+	var v struct {
+		Size ByteSize `yaml:"size"`
+	}
+	if err := yaml.Unmarshal([]byte("size: 100MiB"), &v); err != nil || v.Size != 100<<20 {
+		t.Errorf("Unmarshal() = %d, %v", v.Size, err)
+	}
+	if err := yaml.Unmarshal([]byte("size: lots"), &v); err == nil {
+		t.Error("Unmarshal() of an invalid size succeeded")
+	}
+}
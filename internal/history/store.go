@@ -0,0 +1,206 @@
+// Package history keeps a persistent record of every session: who opened
+// it, from where and how they authenticated, what it connected to, how it
+// ended and which files it produced.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+// Record describes one session channel
+type Record struct {
+	ID             string `json:"id"`
+	ConnectionID   string `json:"connection_id"`
+	Username       string `json:"username"`
+	ClientAddr     string `json:"client_addr"`
+	ClientVersion  string `json:"client_version"`
+	AuthMethod     string `json:"auth_method"`
+	KeyFingerprint string `json:"key_fingerprint,omitempty"`
+	Target         string `json:"target"`
+	Mode           string `json:"mode,omitempty"`
+	ApprovedBy     string `json:"approved_by,omitempty"`
+
+	Started time.Time `json:"started"`
+	// unset while the session is open, or if the proxy stopped abruptly
+	Ended *time.Time `json:"ended,omitempty"`
+	// exit status of the remote command or shell, if it reported one
+	ExitStatus *int `json:"exit_status,omitempty"`
+	// signal that killed the remote command, if any
+	ExitSignal string `json:"exit_signal,omitempty"`
+	// why the session ended if not by the remote side, e.g. a limit
+	EndReason string `json:"end_reason,omitempty"`
+	BytesIn   int64  `json:"bytes_in"`
+	BytesOut  int64  `json:"bytes_out"`
+
+	Artifacts Artifacts `json:"artifacts"`
+}
+
+// Artifacts are the files written for a session. Retention may since have
+// compressed (.gz) or archived them.
+type Artifacts struct {
+	Log     string `json:"log"`
+	Chain   string `json:"chain,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+// Store is an append-only JSON lines file of session records. A session is
+// written when it starts and again when it ends; the last record for an ID
+// wins.
+type Store struct {
+	path    string
+	records map[string]*Record
+	order   []string
+	loaded  bool
+	mu      sync.Mutex
+}
+
+var (
+	stores   = make(map[string]*Store)
+	storesMu sync.Mutex
+)
+
+// OpenStore returns the shared store for path
+func OpenStore(path string) *Store {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if s, ok := stores[path]; ok {
+		return s
+	}
+	s := &Store{path: path}
+	stores[path] = s
+	return s
+}
+
+// StorePath is the configured store file, defaulting to the log directory
+func StorePath(cfg *config.Config) string {
+	if cfg.Logging.SessionStore != "" {
+		return cfg.Logging.SessionStore
+	}
+	return filepath.Join(cfg.Logging.Directory, "sessions.jsonl")
+}
+
+func (s *Store) load() error {
+	if s.loaded {
+		return nil
+	}
+	s.records = make(map[string]*Record)
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		s.loaded = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open session store: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.ID == "" {
+			continue
+		}
+		s.put(rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read session store: %w", err)
+	}
+	s.loaded = true
+	return nil
+}
+
+func (s *Store) put(rec Record) {
+	if _, ok := s.records[rec.ID]; !ok {
+		s.order = append(s.order, rec.ID)
+	}
+	s.records[rec.ID] = &rec
+}
+
+// Save writes the current state of a session
+func (s *Store) Save(rec Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session record: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create session store directory: %w", err)
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open session store: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write session record: %w", err)
+	}
+	// records are only kept in memory once the store has been read
+	if s.loaded {
+		s.put(rec)
+	}
+	return nil
+}
+
+// Get returns the session with the given ID
+func (s *Store) Get(id string) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return Record{}, false, err
+	}
+	rec, ok := s.records[id]
+	if !ok {
+		return Record{}, false, nil
+	}
+	return *rec, true, nil
+}
+
+// Filter selects sessions; zero fields match everything
+type Filter struct {
+	User string
+	// sessions started in [Since, Until)
+	Since time.Time
+	Until time.Time
+	// most sessions to return, newest first; 0 means all
+	Limit int
+}
+
+// List returns the sessions matching f, newest first
+func (s *Store) List(f Filter) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	var out []Record
+	for _, id := range s.order {
+		rec := s.records[id]
+		if f.User != "" && rec.Username != f.User {
+			continue
+		}
+		if !f.Since.IsZero() && rec.Started.Before(f.Since) {
+			continue
+		}
+		if !f.Until.IsZero() && !rec.Started.Before(f.Until) {
+			continue
+		}
+		out = append(out, *rec)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Started.After(out[j].Started) })
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+	return out, nil
+}
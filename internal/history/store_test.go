@@ -0,0 +1,120 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.jsonl")
+	s := &Store{path: path}
+	started := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	ended := started.Add(5 * time.Minute)
+	status := 130
+
+	open := Record{
+		ID: "s_1", ConnectionID: "c_1", Username: "alice", ClientAddr: "10.0.0.1:40000",
+		ClientVersion: "SSH-2.0-OpenSSH_9.6", AuthMethod: "publickey", KeyFingerprint: "SHA256:abc",
+		Target: "db.internal:22", Mode: "interactive", ApprovedBy: "carol", Started: started,
+		Artifacts: Artifacts{Log: "logs/alice/s_1.log", Chain: "logs/alice/s_1.log.chain"},
+	}
+	if err := s.Save(open); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	closed := open
+	closed.Ended = &ended
+	closed.ExitStatus = &status
+	closed.ExitSignal = "INT"
+	closed.EndReason = "Idle timeout of 5m0s reached."
+	closed.BytesIn, closed.BytesOut = 120, 4096
+	closed.Artifacts.Summary = "logs/alice/s_1.log.summary"
+	if err := s.Save(closed); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("store mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// the last record for a session wins, in memory and when read back
+	for _, store := range []*Store{s, {path: path}} {
+		got, ok, err := store.Get("s_1")
+		if err != nil || !ok {
+			t.Fatalf("Get() = %v, %v", ok, err)
+		}
+		if !reflect.DeepEqual(got, closed) {
+			t.Errorf("Get() = %+v, want %+v", got, closed)
+		}
+		if list, _ := store.List(Filter{}); len(list) != 1 {
+			t.Errorf("List() returned %d records, want 1", len(list))
+		}
+	}
+
+	if _, ok, err := s.Get("s_2"); ok || err != nil {
+		t.Errorf("Get() of an unknown session = %v, %v", ok, err)
+	}
+}
+
+func TestStoreList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.jsonl")
+	start := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	s := &Store{path: path}
+	for i, user := range []string{"alice", "bob", "alice", "carol"} {
+		s.Save(Record{ID: "s_" + strconv.Itoa(i+1), Username: user, Started: start.Add(time.Duration(i) * time.Hour)})
+	}
+	// lines that do not parse, or have no ID, are skipped
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString("garbage\n{\"username\":\"mallory\"}\n")
+	f.Close()
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"all, newest first", Filter{}, "s_4 s_3 s_2 s_1"},
+		{"user", Filter{User: "alice"}, "s_3 s_1"},
+		{"since", Filter{Since: start.Add(2 * time.Hour)}, "s_4 s_3"},
+		{"until", Filter{Until: start.Add(time.Hour)}, "s_1"},
+		{"limit", Filter{Limit: 2}, "s_4 s_3"},
+		{"nothing", Filter{User: "mallory"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := (&Store{path: path}).List(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, rec := range list {
+				ids = append(ids, rec.ID)
+			}
+			if got := strings.Join(ids, " "); got != tt.want {
+				t.Errorf("List() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStorePath(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Logging.Directory = "logs"
+	if got := StorePath(cfg); got != filepath.Join("logs", "sessions.jsonl") {
+		t.Errorf("StorePath() = %q", got)
+	}
+	cfg.Logging.SessionStore = "/var/lib/ssh-proxy/sessions.jsonl"
+	if got := StorePath(cfg); got != cfg.Logging.SessionStore {
+		t.Errorf("StorePath() = %q, want the configured path", got)
+	}
+	if OpenStore(cfg.Logging.SessionStore) != OpenStore(cfg.Logging.SessionStore) {
+		t.Error("OpenStore() returned different stores for one path")
+	}
+}
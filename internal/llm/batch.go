@@ -0,0 +1,158 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/logger"
+)
+
+// BatchOptions controls a bulk (re)summarization run
+type BatchOptions struct {
+	Concurrency int
+	Force       bool
+	Since       time.Time
+	Until       time.Time
+}
+
+// BatchResult is the outcome for one log in a bulk run
+type BatchResult struct {
+	Path    string
+	Level   RiskLevel
+	Skipped bool
+	Err     error
+}
+
+// SummaryPath returns where the summary of a log is written; a log that
+// was compressed keeps the summary of the original
+func SummaryPath(logPath string) string {
+	return strings.TrimSuffix(logPath, ".gz") + ".summary"
+}
+
+// FindSessionLogs expands files and directories into the session logs they
+// contain, compressed or not, keeping those that started inside the [since, until) range
+func FindSessionLogs(paths []string, since, until time.Time) ([]string, error) {
+	var logs []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			logs = append(logs, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && (strings.HasSuffix(d.Name(), ".log") || strings.HasSuffix(d.Name(), ".log.gz")) {
+				logs = append(logs, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", path, err)
+		}
+	}
+
+	if since.IsZero() && until.IsZero() {
+		sort.Strings(logs)
+		return logs, nil
+	}
+
+	var filtered []string
+	for _, p := range logs {
+		started, err := sessionStart(p)
+		if err != nil {
+			return nil, err
+		}
+		if !since.IsZero() && started.Before(since) {
+			continue
+		}
+		if !until.IsZero() && !started.Before(until) {
+			continue
+		}
+		filtered = append(filtered, p)
+	}
+	sort.Strings(filtered)
+	return filtered, nil
+}
+
+// sessionStart reads the start time from a log header, falling back to the
+// file's modification time for logs without one or encrypted logs
+func sessionStart(path string) (time.Time, error) {
+	content, err := logger.ReadFile(path)
+	if err != nil && !errors.Is(err, logger.ErrEncrypted) {
+		return time.Time{}, fmt.Errorf("failed to read log file: %w", err)
+	}
+	if started := ParseSessionInfo(string(content)).Started; !started.IsZero() {
+		return started, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// SummarizeBatch summarizes logs with at most opts.Concurrency requests in
+// flight. Logs that already have a summary are skipped unless opts.Force is
+// set, and the run stops early once the budget is exhausted. progress is
+// called once per log as it finishes.
+func (s *Summarizer) SummarizeBatch(logs []string, opts BatchOptions, progress func(BatchResult)) {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		stopped bool
+	)
+	sem := make(chan struct{}, concurrency)
+	report := func(r BatchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		if errors.Is(r.Err, ErrBudgetExceeded) {
+			stopped = true
+		}
+		progress(r)
+	}
+
+	for _, path := range logs {
+		if !opts.Force {
+			if _, err := os.Stat(SummaryPath(path)); err == nil {
+				report(BatchResult{Path: path, Skipped: true})
+				continue
+			}
+		}
+
+		sem <- struct{}{}
+		mu.Lock()
+		halt := stopped
+		mu.Unlock()
+		if halt {
+			<-sem
+			report(BatchResult{Path: path, Err: ErrBudgetExceeded})
+			continue
+		}
+
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			level, err := s.SummarizeSession(path)
+			report(BatchResult{Path: path, Level: level, Err: err})
+		}(path)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,172 @@
+package llm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+func writeSessionLog(t *testing.T, path string, started time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := "--- SSH Session Log for alice ---\n"
+	if !started.IsZero() {
+		content += "Started: " + started.Format(time.RFC3339) + "\n"
+	}
+	content += "------------------------------\n\n$ id\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindSessionLogs(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+	writeSessionLog(t, filepath.Join(dir, "a.log"), day.Add(-24*time.Hour))
+	writeSessionLog(t, filepath.Join(dir, "b.log"), day.Add(time.Hour))
+	writeSessionLog(t, filepath.Join(dir, "sub", "c.log"), day.Add(2*time.Hour))
+	writeSessionLog(t, filepath.Join(dir, "d.log"), day.Add(24*time.Hour))
+	// without a header the modification time counts
+	writeSessionLog(t, filepath.Join(dir, "e.log"), time.Time{})
+	os.Chtimes(filepath.Join(dir, "e.log"), day.Add(3*time.Hour), day.Add(3*time.Hour))
+	os.WriteFile(filepath.Join(dir, "a.log.summary"), []byte("RISK: low"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0644)
+
+	tests := []struct {
+		name  string
+		paths []string
+		since time.Time
+		until time.Time
+		want  []string
+	}{
+		{
+			name:  "whole directory",
+			paths: []string{dir},
+			want:  []string{"a.log", "b.log", "d.log", "e.log", "sub/c.log"},
+		},
+		{
+			name:  "single file",
+			paths: []string{filepath.Join(dir, "b.log")},
+			want:  []string{"b.log"},
+		},
+		{
+			name:  "one day",
+			paths: []string{dir},
+			since: day,
+			until: day.Add(24 * time.Hour),
+			want:  []string{"b.log", "e.log", "sub/c.log"},
+		},
+		{
+			name:  "since only",
+			paths: []string{dir},
+			since: day.Add(150 * time.Minute),
+			want:  []string{"d.log", "e.log"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs, err := FindSessionLogs(tt.paths, tt.since, tt.until)
+			if err != nil {
+				t.Fatalf("FindSessionLogs() error = %v", err)
+			}
+			var got []string
+			for _, l := range logs {
+				rel, _ := filepath.Rel(dir, l)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("FindSessionLogs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := FindSessionLogs([]string{filepath.Join(dir, "missing")}, time.Time{}, time.Time{}); err == nil {
+		t.Error("FindSessionLogs() of a missing path succeeded")
+	}
+}
+
+func TestSummaryPath(t *testing.T) {
+	tests := map[string]string{
+		"logs/a.log":    "logs/a.log.summary",
+		"logs/a.log.gz": "logs/a.log.summary",
+	}
+	for in, want := range tests {
+		if got := SummaryPath(in); got != want {
+			t.Errorf("SummaryPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSummarizeBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		force   bool
+		spent   float64
+		skipped int
+		budget  int
+		failed  int
+	}{
+		{name: "existing summaries are skipped", skipped: 1, failed: 2},
+		{name: "force redoes every log", force: true, failed: 3},
+		{name: "budget exhausted", spent: 10, skipped: 1, budget: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var logs []string
+			for _, name := range []string{"a.log", "b.log", "c.log"} {
+				path := filepath.Join(dir, name)
+				writeSessionLog(t, path, time.Now())
+				logs = append(logs, path)
+			}
+			os.WriteFile(SummaryPath(logs[0]), []byte("RISK: low"), 0644)
+
+			cfg := &config.Config{}
+			cfg.LLM.Enabled = true
+			// no provider is configured, so every request fails without
+			// reaching the network
+			cfg.LLM.Provider = "none"
+			cfg.LLM.Usage.Ledger = filepath.Join(dir, "usage.jsonl")
+			cfg.LLM.Usage.DailyBudget = 5
+			s := NewSummarizer(cfg, nil)
+			if tt.spent > 0 {
+				s.ledger.Record(UsageRecord{Time: time.Now(), Cost: tt.spent})
+			}
+
+			var (
+				mu      sync.Mutex
+				results []BatchResult
+			)
+			s.SummarizeBatch(logs, BatchOptions{Concurrency: 2, Force: tt.force}, func(r BatchResult) {
+				mu.Lock()
+				results = append(results, r)
+				mu.Unlock()
+			})
+
+			sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+			var skipped, budget, failed int
+			for _, r := range results {
+				switch {
+				case r.Skipped:
+					skipped++
+				case errors.Is(r.Err, ErrBudgetExceeded):
+					budget++
+				case r.Err != nil:
+					failed++
+				}
+			}
+			if len(results) != len(logs) || skipped != tt.skipped || budget != tt.budget || failed != tt.failed {
+				t.Errorf("results = %+v, want %d skipped, %d over budget, %d failed", results, tt.skipped, tt.budget, tt.failed)
+			}
+		})
+	}
+}
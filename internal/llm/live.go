@@ -0,0 +1,154 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+const (
+	// commands queued beyond this are dropped rather than blocking the session
+	liveQueueSize = 64
+	// number of previous commands sent along as context
+	liveHistorySize = 10
+)
+
+// Assessment is the analyzer's verdict on a single command
+type Assessment struct {
+	Command string
+	Level   RiskLevel
+	Reason  string
+}
+
+// LiveAnalyzer rates commands one at a time while a session is running and
+// reports the ones at or above the configured threshold
+type LiveAnalyzer struct {
+	summarizer *Summarizer
+	username   string
+	session    string
+	threshold  RiskLevel
+	onRisk     func(Assessment)
+	commands   chan string
+	history    []string
+	paused     bool
+	closeOnce  sync.Once
+	done       chan struct{}
+}
+
+func NewLiveAnalyzer(cfg *config.Config, username, session string, onRisk func(Assessment)) (*LiveAnalyzer, error) {
+	threshold, err := ParseRiskLevel(cfg.LLM.Live.Threshold)
+	if err != nil {
+		return nil, err
+	}
+	a := &LiveAnalyzer{
+		summarizer: NewSummarizer(cfg, nil),
+		username:   username,
+		session:    session,
+		threshold:  threshold,
+		onRisk:     onRisk,
+		commands:   make(chan string, liveQueueSize),
+		done:       make(chan struct{}),
+	}
+	go a.run()
+	return a, nil
+}
+
+// Submit queues a reconstructed command for analysis without blocking
+func (a *LiveAnalyzer) Submit(command string) {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return
+	}
+	select {
+	case <-a.done:
+	case a.commands <- command:
+	default:
+		log.Printf("Live analysis queue full for user %s, dropping command", a.username)
+	}
+}
+
+// Close stops the analyzer, abandoning any commands still queued
+func (a *LiveAnalyzer) Close() {
+	a.closeOnce.Do(func() {
+		close(a.done)
+	})
+}
+
+func (a *LiveAnalyzer) run() {
+	for {
+		select {
+		case <-a.done:
+			return
+		case command := <-a.commands:
+			assessment, err := a.assess(command)
+			if errors.Is(err, ErrBudgetExceeded) {
+				if !a.paused {
+					log.Printf("Live analysis paused for user %s: %v", a.username, err)
+					a.paused = true
+				}
+				continue
+			}
+			if err != nil {
+				log.Printf("Live analysis failed for user %s: %v", a.username, err)
+				continue
+			}
+			if assessment.Level >= a.threshold {
+				select {
+				case <-a.done:
+					return
+				default:
+				}
+				a.onRisk(assessment)
+			}
+		}
+	}
+}
+
+func (a *LiveAnalyzer) assess(command string) (Assessment, error) {
+	prompt := fmt.Sprintf(`
+Rate the security risk of the latest command run by user %q in an SSH session.
+
+Previous commands (oldest first):
+%s
+
+Latest command:
+%s
+
+Answer with exactly two lines:
+RISK: <low|medium|high>
+REASON: <one sentence>
+`, a.username, formatHistory(a.history), command)
+
+	a.history = append(a.history, command)
+	if len(a.history) > liveHistorySize {
+		a.history = a.history[len(a.history)-liveHistorySize:]
+	}
+
+	response, err := a.summarizer.complete(a.session, "live", analystSystemPrompt, prompt)
+	if err != nil {
+		return Assessment{}, err
+	}
+	return parseAssessment(command, response), nil
+}
+
+func formatHistory(history []string) string {
+	if len(history) == 0 {
+		return "(none)"
+	}
+	return strings.Join(history, "\n")
+}
+
+func parseAssessment(command, response string) Assessment {
+	assessment := Assessment{Command: command, Level: ExtractRiskLevel(response)}
+	for _, line := range strings.Split(response, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(strings.ToUpper(line), "REASON:") {
+			assessment.Reason = strings.TrimSpace(line[len("REASON:"):])
+		}
+	}
+	return assessment
+}
@@ -3,79 +3,184 @@ package llm
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
 	"path/filepath"
 	"regexp"
+	"sync"
 	"time"
 
 	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/logger"
+	"github.com/devashar13/ssh-proxy/internal/metrics"
+	"github.com/devashar13/ssh-proxy/internal/notify"
 )
 
 
+// pendingSummaries tracks asynchronous summaries so shutdown can wait for them
+var pendingSummaries sync.WaitGroup
+
+// WaitForSummaries blocks until every asynchronous summary has finished
+func WaitForSummaries() {
+	pendingSummaries.Wait()
+}
+
+const analystSystemPrompt = "You are a security analyst specializing in SSH session analysis."
+
 type Summarizer struct {
-	config *config.Config
+	config   *config.Config
+	notifier *notify.Notifier
+	ledger   *Ledger
 }
 
 
-func NewSummarizer(cfg *config.Config) *Summarizer {
+func NewSummarizer(cfg *config.Config, notifier *notify.Notifier) *Summarizer {
 	return &Summarizer{
-		config: cfg,
+		config:   cfg,
+		notifier: notifier,
+		ledger:   OpenLedger(LedgerPath(cfg)),
 	}
 }
 
 
-func (s *Summarizer) SummarizeSessionAsync(logFilePath string) {
+// SummarizeSessionAsync summarizes a finished session in the background.
+// transcript, if not nil, is used in place of the log's contents, for logs
+// that are encrypted on disk.
+func (s *Summarizer) SummarizeSessionAsync(logFilePath string, transcript []byte) {
 	if !s.config.LLM.Enabled || s.config.LLM.APIKey == "" {
 		log.Printf("LLM summarization is disabled or API key is missing")
 		return
 	}
 
+	pendingSummaries.Add(1)
 	go func() {
+		defer pendingSummaries.Done()
 		log.Printf("Starting asynchronous security analysis of session: %s", filepath.Base(logFilePath))
-		if err := s.SummarizeSession(logFilePath); err != nil {
+		if _, err := s.summarize(logFilePath, transcript); errors.Is(err, ErrBudgetExceeded) {
+			metrics.SummarizerJobs.WithLabelValues("budget_exceeded").Inc()
+			log.Printf("Skipping security analysis of %s: %v", filepath.Base(logFilePath), err)
+		} else if err != nil {
+			metrics.SummarizerJobs.WithLabelValues("failure").Inc()
 			log.Printf("Error summarizing session: %v", err)
 		} else {
+			metrics.SummarizerJobs.WithLabelValues("success").Inc()
 			log.Printf("Security analysis completed for %s", filepath.Base(logFilePath))
 		}
 	}()
 }
 
 
-func (s *Summarizer) SummarizeSession(logFilePath string) error {
-	
-	logContent, err := os.ReadFile(logFilePath)
+// SummarizeSession writes <log>.summary and returns the risk level the
+// summary reports
+func (s *Summarizer) SummarizeSession(logFilePath string) (RiskLevel, error) {
+	return s.summarize(logFilePath, nil)
+}
+
+func (s *Summarizer) summarize(logFilePath string, transcript []byte) (RiskLevel, error) {
+	var prompt *Prompt
+	var err error
+	if transcript != nil {
+		prompt, err = s.promptFor(transcript)
+	} else {
+		prompt, err = s.BuildPrompt(logFilePath)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to read log file: %w", err)
+		return RiskUnknown, err
 	}
 
-	
-	cleanedContent := cleanLogContent(string(logContent))
+	summary, err := s.complete(filepath.Base(logFilePath), "summary", prompt.System, prompt.User)
+	if err != nil {
+		return RiskUnknown, fmt.Errorf("failed to generate summary: %w", err)
+	}
 
 	
-	var summary string
-	switch s.config.LLM.Provider {
-	case "openai":
-		summary, err = s.callOpenAI(cleanedContent)
-	default:
-		return fmt.Errorf("unsupported LLM provider: %s", s.config.LLM.Provider)
+	summaryFilePath := SummaryPath(logFilePath)
+	err = logger.WriteFile(summaryFilePath, []byte(summary), s.config.LogRecipient())
+	if err != nil {
+		return RiskUnknown, fmt.Errorf("failed to write summary file: %w", err)
 	}
 
+	level := ExtractRiskLevel(summary)
+	log.Printf("Session %s rated %s risk", filepath.Base(logFilePath), level)
+	s.notifier.Notify(notify.Event{
+		Type:     notify.EventSummaryRisk,
+		Username: prompt.Info.User,
+		ClientIP: prompt.Info.ClientIP,
+		Risk:     level.String(),
+		Message:  fmt.Sprintf("session %s rated %s risk", filepath.Base(logFilePath), level),
+		Details: map[string]string{
+			"log":     logFilePath,
+			"summary": summaryFilePath,
+			"target":  prompt.Info.Target,
+		},
+	})
+
+	return level, nil
+}
+
+
+// BuildPrompt reads a session log and renders the prompts that would be
+// sent to the provider for it
+func (s *Summarizer) BuildPrompt(logFilePath string) (*Prompt, error) {
+	logContent, err := logger.ReadFile(logFilePath)
+	if errors.Is(err, logger.ErrEncrypted) {
+		return nil, fmt.Errorf("log is encrypted, decrypt it first with \"ssh-proxy decrypt\"")
+	}
 	if err != nil {
-		return fmt.Errorf("failed to generate summary: %w", err)
+		return nil, fmt.Errorf("failed to read log file: %w", err)
 	}
+	return s.promptFor(logContent)
+}
 
-	
-	summaryFilePath := logFilePath + ".summary"
-	err = os.WriteFile(summaryFilePath, []byte(summary), 0644)
+func (s *Summarizer) promptFor(logContent []byte) (*Prompt, error) {
+	info := ParseSessionInfo(string(logContent))
+	user, err := RenderPrompt(s.config, info, cleanLogContent(string(logContent)))
+	if err != nil {
+		return nil, err
+	}
+	return &Prompt{System: SystemPrompt(s.config), User: user, Info: info}, nil
+}
+
+// complete sends a single system/user prompt pair to the configured
+// provider, refusing once the budget is spent and recording token usage
+// against the session afterwards
+func (s *Summarizer) complete(session, kind, systemPrompt, prompt string) (string, error) {
+	if err := CheckBudget(s.config, s.ledger, time.Now()); err != nil {
+		return "", err
+	}
+
+	var (
+		content string
+		usage   Usage
+		err     error
+	)
+	switch s.config.LLM.Provider {
+	case "openai":
+		content, usage, err = s.callOpenAI(systemPrompt, prompt)
+	default:
+		return "", fmt.Errorf("unsupported LLM provider: %s", s.config.LLM.Provider)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to write summary file: %w", err)
+		return "", err
 	}
 
-	return nil
+	rec := UsageRecord{
+		Time:             time.Now(),
+		Session:          session,
+		Kind:             kind,
+		Provider:         s.config.LLM.Provider,
+		Model:            s.config.LLM.Model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Cost:             EstimateCost(s.config, s.config.LLM.Model, usage),
+	}
+	if err := s.ledger.Record(rec); err != nil {
+		log.Printf("Failed to record LLM usage: %v", err)
+	}
+	return content, nil
 }
 
 
@@ -97,27 +202,15 @@ func cleanLogContent(content string) string {
 }
 
 
-func (s *Summarizer) callOpenAI(logContent string) (string, error) {
+func (s *Summarizer) callOpenAI(systemPrompt, prompt string) (string, Usage, error) {
 	apiURL := "https://api.openai.com/v1/chat/completions"
 
-	prompt := fmt.Sprintf(`
-Analyze the following SSH session log and provide a security assessment:
-
-1. Identify all commands executed during the session
-2. Flag any potentially suspicious or dangerous commands
-3. Evaluate the overall security risk (low, medium, high)
-4. Provide recommendations if any security concerns are identified
-
-SSH Session Log:
-%s
-`, logContent)
-
 	requestBody, err := json.Marshal(map[string]interface{}{
 		"model": s.config.LLM.Model,
 		"messages": []map[string]string{
 			{
 				"role":    "system",
-				"content": "You are a security analyst specializing in SSH session analysis.",
+				"content": systemPrompt,
 			},
 			{
 				"role":    "user",
@@ -127,12 +220,12 @@ SSH Session Log:
 		"temperature": 0.3, 
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return "", Usage{}, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(requestBody))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", Usage{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -141,42 +234,52 @@ SSH Session Log:
 	client := &http.Client{Timeout: 60 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return "", Usage{}, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return "", Usage{}, fmt.Errorf("failed to read response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API error (%d): %s", resp.StatusCode, string(respBody))
+		return "", Usage{}, fmt.Errorf("API error (%d): %s", resp.StatusCode, string(respBody))
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(respBody, &result); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+		return "", Usage{}, fmt.Errorf("failed to parse response: %w", err)
 	}
 	choices, ok := result["choices"].([]interface{})
 	if !ok || len(choices) == 0 {
-		return "", fmt.Errorf("invalid response format")
+		return "", Usage{}, fmt.Errorf("invalid response format")
 	}
 
 	choice, ok := choices[0].(map[string]interface{})
 	if !ok {
-		return "", fmt.Errorf("invalid choice format")
+		return "", Usage{}, fmt.Errorf("invalid choice format")
 	}
 
 	message, ok := choice["message"].(map[string]interface{})
 	if !ok {
-		return "", fmt.Errorf("invalid message format")
+		return "", Usage{}, fmt.Errorf("invalid message format")
 	}
 
 	content, ok := message["content"].(string)
 	if !ok {
-		return "", fmt.Errorf("invalid content format")
+		return "", Usage{}, fmt.Errorf("invalid content format")
 	}
 
-	return content, nil
+	var usage Usage
+	if u, ok := result["usage"].(map[string]interface{}); ok {
+		if n, ok := u["prompt_tokens"].(float64); ok {
+			usage.PromptTokens = int(n)
+		}
+		if n, ok := u["completion_tokens"].(float64); ok {
+			usage.CompletionTokens = int(n)
+		}
+	}
+
+	return content, usage, nil
 }
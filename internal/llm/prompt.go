@@ -0,0 +1,177 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+const defaultPromptTemplate = `
+Analyze the following SSH session log and provide a security assessment:
+
+1. Identify all commands executed during the session
+2. Flag any potentially suspicious or dangerous commands
+3. Evaluate the overall security risk (low, medium, high)
+4. Provide recommendations if any security concerns are identified
+
+User: {{.User}}
+Client IP: {{.ClientIP}}
+Target: {{.Target}}
+Session type: {{.Mode}}
+{{- if .Duration}}
+Duration: {{.Duration}}
+{{- end}}
+
+SSH Session Log:
+{{.Log}}
+`
+
+const (
+	logHeaderSeparator = "------------------------------"
+	// LogFooterMarker starts the metadata block written when a session ends
+	LogFooterMarker = "--- Session ended ---"
+)
+
+// SessionInfo is the metadata recorded in a session log's header and footer
+type SessionInfo struct {
+	User     string
+	ClientIP string
+	Target   string
+	Mode     string
+	Started  time.Time
+	Ended    time.Time
+}
+
+// Duration is zero for sessions that never recorded an end time
+func (i SessionInfo) Duration() time.Duration {
+	if i.Started.IsZero() || i.Ended.IsZero() {
+		return 0
+	}
+	return i.Ended.Sub(i.Started).Round(time.Second)
+}
+
+// Exec reports whether the session ran a single command rather than a shell
+func (i SessionInfo) Exec() bool {
+	return i.Mode == "exec"
+}
+
+// Prompt is a fully rendered request for one session log
+type Prompt struct {
+	System string
+	User   string
+	Info   SessionInfo
+}
+
+// PromptData is what prompt templates are executed against
+type PromptData struct {
+	SessionInfo
+	Log string
+}
+
+// RenderPrompt executes the configured prompt template, or the built-in one
+func RenderPrompt(cfg *config.Config, info SessionInfo, logContent string) (string, error) {
+	text := defaultPromptTemplate
+	name := "default"
+	if cfg.LLM.PromptTemplate != "" {
+		data, err := os.ReadFile(cfg.LLM.PromptTemplate)
+		if err != nil {
+			return "", fmt.Errorf("failed to read prompt template: %w", err)
+		}
+		text = string(data)
+		name = cfg.LLM.PromptTemplate
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse prompt template: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, PromptData{SessionInfo: info, Log: logContent}); err != nil {
+		return "", fmt.Errorf("failed to render prompt template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// SystemPrompt returns the configured system prompt or the default analyst one
+func SystemPrompt(cfg *config.Config) string {
+	if cfg.LLM.SystemPrompt != "" {
+		return cfg.LLM.SystemPrompt
+	}
+	return analystSystemPrompt
+}
+
+// ParseSessionInfo reads the "Key: value" lines the proxy writes in the
+// header and footer of every session log. Lines in between are user input
+// and are never interpreted.
+func ParseSessionInfo(content string) SessionInfo {
+	var info SessionInfo
+	lines := strings.Split(content, "\n")
+
+	for _, line := range lines {
+		if line == logHeaderSeparator {
+			break
+		}
+		if strings.HasPrefix(line, "--- SSH Session Log for ") {
+			info.User = strings.TrimSuffix(strings.TrimPrefix(line, "--- SSH Session Log for "), " ---")
+			continue
+		}
+		info.parseField(line)
+	}
+
+	footer := strings.LastIndex(content, "\n"+LogFooterMarker+"\n")
+	if footer >= 0 {
+		// the marker may also be typed by the user, so only a complete
+		// footer block at the end of the log counts
+		if lines, ok := footerLines(content[footer+len(LogFooterMarker)+2:]); ok {
+			for _, line := range lines {
+				info.parseField(line)
+			}
+		}
+	}
+
+	if info.Mode == "" {
+		info.Mode = "interactive"
+	}
+	return info
+}
+
+// footerLines splits what follows the footer marker into its lines, if it
+// is an Ended line and then only the other footer fields, up to the end
+func footerLines(block string) ([]string, bool) {
+	lines := strings.Split(strings.TrimSuffix(block, "\n"), "\n")
+	if !strings.HasPrefix(lines[0], "Ended: ") {
+		return nil, false
+	}
+	for _, line := range lines[1:] {
+		key, _, _ := strings.Cut(line, ": ")
+		switch key {
+		case "Mode", "Exit status", "Exit signal":
+		default:
+			return nil, false
+		}
+	}
+	return lines, true
+}
+
+func (i *SessionInfo) parseField(line string) {
+	key, value, ok := strings.Cut(strings.TrimRight(line, "\r"), ": ")
+	if !ok {
+		return
+	}
+	switch key {
+	case "Started":
+		i.Started, _ = time.Parse(time.RFC3339, value)
+	case "Ended":
+		i.Ended, _ = time.Parse(time.RFC3339, value)
+	case "Client":
+		i.ClientIP = value
+	case "Target":
+		i.Target = value
+	case "Mode":
+		i.Mode = value
+	}
+}
@@ -0,0 +1,196 @@
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+const testLog = `--- SSH Session Log for alice ---
+Started: 2026-03-15T12:00:00Z
+Client: 10.0.0.1
+Target: db.internal:22
+------------------------------
+
+$ whoami
+alice
+Client: 6.6.6.6
+$ exit
+
+--- Session ended ---
+Ended: 2026-03-15T12:05:30Z
+Mode: exec
+`
+
+func TestParseSessionInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    SessionInfo
+	}{
+		{
+			name:    "header and footer",
+			content: testLog,
+			want: SessionInfo{
+				User: "alice", ClientIP: "10.0.0.1", Target: "db.internal:22", Mode: "exec",
+				Started: time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC),
+				Ended:   time.Date(2026, 3, 15, 12, 5, 30, 0, time.UTC),
+			},
+		},
+		{
+			name:    "session still open",
+			content: strings.Split(testLog, "\n--- Session ended ---")[0],
+			want: SessionInfo{
+				User: "alice", ClientIP: "10.0.0.1", Target: "db.internal:22", Mode: "interactive",
+				Started: time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "footer typed during the session",
+			content: strings.Split(testLog, "\n--- Session ended ---")[0] + "\n--- Session ended ---\nEnded: 2026-03-15T12:01:00Z\nMode: exec\n$ ls\n",
+			want: SessionInfo{
+				User: "alice", ClientIP: "10.0.0.1", Target: "db.internal:22", Mode: "interactive",
+				Started: time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "marker without an ended line",
+			content: strings.Split(testLog, "\n--- Session ended ---")[0] + "\n--- Session ended ---\nMode: exec\n",
+			want: SessionInfo{
+				User: "alice", ClientIP: "10.0.0.1", Target: "db.internal:22", Mode: "interactive",
+				Started: time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "exit status in the footer",
+			content: testLog + "Exit status: 1\n",
+			want: SessionInfo{
+				User: "alice", ClientIP: "10.0.0.1", Target: "db.internal:22", Mode: "exec",
+				Started: time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC),
+				Ended:   time.Date(2026, 3, 15, 12, 5, 30, 0, time.UTC),
+			},
+		},
+		{
+			name:    "not a session log",
+			content: "hello\nworld\n",
+			want:    SessionInfo{Mode: "interactive"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseSessionInfo(tt.content)
+			if got != tt.want {
+				t.Errorf("ParseSessionInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionInfoDuration(t *testing.T) {
+	start := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		info SessionInfo
+		want time.Duration
+	}{
+		{SessionInfo{Started: start, Ended: start.Add(90*time.Second + 400*time.Millisecond)}, 90 * time.Second},
+		{SessionInfo{Started: start}, 0},
+		{SessionInfo{Ended: start}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.info.Duration(); got != tt.want {
+			t.Errorf("Duration() = %v, want %v", got, tt.want)
+		}
+	}
+}
+
+func TestRenderPrompt(t *testing.T) {
+	info := ParseSessionInfo(testLog)
+	dir := t.TempDir()
+	write := func(name, text string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     []string
+		wantErr  string
+	}{
+		{
+			name: "built-in template",
+			want: []string{"User: alice", "Client IP: 10.0.0.1", "Target: db.internal:22", "Session type: exec", "Duration: 5m30s", "$ whoami"},
+		},
+		{
+			name:     "custom template",
+			template: write("custom.tmpl", "{{.User}} {{if .Exec}}ran a command{{end}} for {{.Duration}}\n{{.Log}}"),
+			want:     []string{"alice ran a command for 5m30s", "$ whoami"},
+		},
+		{
+			name:     "unknown field",
+			template: write("unknown.tmpl", "{{.Hostname}}"),
+			wantErr:  "failed to render prompt template",
+		},
+		{
+			name:     "syntax error",
+			template: write("broken.tmpl", "{{.User"),
+			wantErr:  "failed to parse prompt template",
+		},
+		{
+			name:     "missing file",
+			template: filepath.Join(dir, "missing.tmpl"),
+			wantErr:  "failed to read prompt template",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.LLM.PromptTemplate = tt.template
+			got, err := RenderPrompt(cfg, info, testLog)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RenderPrompt() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RenderPrompt() error = %v", err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("prompt does not contain %q:\n%s", w, got)
+				}
+			}
+		})
+	}
+}
+
+func TestExamplePromptTemplate(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.LLM.PromptTemplate = "../../configs/prompt.example.tmpl"
+	got, err := RenderPrompt(cfg, ParseSessionInfo(testLog), testLog)
+	if err != nil {
+		t.Fatalf("RenderPrompt() error = %v", err)
+	}
+	if !strings.Contains(got, "User alice connected from 10.0.0.1 to db.internal:22 and ran a single command.") {
+		t.Errorf("unexpected prompt:\n%s", got)
+	}
+}
+
+func TestSystemPrompt(t *testing.T) {
+	cfg := &config.Config{}
+	if got := SystemPrompt(cfg); got != analystSystemPrompt {
+		t.Errorf("SystemPrompt() = %q, want the default", got)
+	}
+	cfg.LLM.SystemPrompt = "You are terse."
+	if got := SystemPrompt(cfg); got != "You are terse." {
+		t.Errorf("SystemPrompt() = %q, want the configured one", got)
+	}
+}
@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RiskLevel orders the risk ratings returned by the analyst prompts
+type RiskLevel int
+
+const (
+	RiskUnknown RiskLevel = iota
+	RiskLow
+	RiskMedium
+	RiskHigh
+)
+
+func (r RiskLevel) String() string {
+	switch r {
+	case RiskLow:
+		return "low"
+	case RiskMedium:
+		return "medium"
+	case RiskHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+func ParseRiskLevel(s string) (RiskLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "low":
+		return RiskLow, nil
+	case "medium":
+		return RiskMedium, nil
+	case "high":
+		return RiskHigh, nil
+	default:
+		return RiskUnknown, fmt.Errorf("invalid risk level: %s", s)
+	}
+}
+
+var riskPattern = regexp.MustCompile(`(?i)risk[^a-z\n]*(?:level|rating|assessment)?[^a-z\n]*(?:is\s+)?\**\s*(low|medium|high)`)
+
+// ExtractRiskLevel finds the first risk rating mentioned in a model response
+func ExtractRiskLevel(text string) RiskLevel {
+	match := riskPattern.FindStringSubmatch(text)
+	if match == nil {
+		return RiskUnknown
+	}
+	level, err := ParseRiskLevel(match[1])
+	if err != nil {
+		return RiskUnknown
+	}
+	return level
+}
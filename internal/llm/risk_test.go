@@ -0,0 +1,64 @@
+package llm
+
+import "testing"
+
+func TestParseRiskLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RiskLevel
+		wantErr bool
+	}{
+		{"low", RiskLow, false},
+		{" Medium ", RiskMedium, false},
+		{"HIGH", RiskHigh, false},
+		{"critical", RiskUnknown, true},
+		{"", RiskUnknown, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRiskLevel(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseRiskLevel(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestExtractRiskLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want RiskLevel
+	}{
+		{"live answer", "RISK: high\nREASON: deletes the root filesystem", RiskHigh},
+		{"risk level", "Risk level: Medium", RiskMedium},
+		{"markdown", "**Risk Assessment:** **low**", RiskLow},
+		{"risk rating is", "The overall risk rating is high.", RiskHigh},
+		{"first rating wins", "RISK: low\nLater the risk: high", RiskLow},
+		{"no rating", "The session looks routine.", RiskUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractRiskLevel(tt.text); got != tt.want {
+				t.Errorf("ExtractRiskLevel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAssessment(t *testing.T) {
+	tests := []struct {
+		response   string
+		wantLevel  RiskLevel
+		wantReason string
+	}{
+		{"RISK: high\nREASON: reads the shadow file", RiskHigh, "reads the shadow file"},
+		{"  risk: low\n  reason:   harmless listing  ", RiskLow, "harmless listing"},
+		{"RISK: medium", RiskMedium, ""},
+		{"I cannot tell.", RiskUnknown, ""},
+	}
+	for _, tt := range tests {
+		got := parseAssessment("cat /etc/shadow", tt.response)
+		if got.Command != "cat /etc/shadow" || got.Level != tt.wantLevel || got.Reason != tt.wantReason {
+			t.Errorf("parseAssessment(%q) = %+v, want %v %q", tt.response, got, tt.wantLevel, tt.wantReason)
+		}
+	}
+}
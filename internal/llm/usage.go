@@ -0,0 +1,210 @@
+package llm
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+// ErrBudgetExceeded is returned instead of calling the provider once the
+// daily or monthly spend cap has been reached
+var ErrBudgetExceeded = errors.New("LLM budget exceeded, summarization paused")
+
+// Usage is the token count reported by the provider for one request
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// UsageRecord is one line of the usage ledger
+type UsageRecord struct {
+	Time             time.Time `json:"time"`
+	Session          string    `json:"session"`
+	Kind             string    `json:"kind"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Cost             float64   `json:"cost"`
+}
+
+// Ledger is an append-only JSON lines file of every LLM request. Only the
+// spend of the current day and month is kept in memory; the file is read
+// again when the day changes.
+type Ledger struct {
+	path string
+	// start of the day and month the running totals cover
+	day   time.Time
+	month time.Time
+	// spend in that day and month
+	daySpent   float64
+	monthSpent float64
+	mu         sync.Mutex
+}
+
+var (
+	ledgers   = make(map[string]*Ledger)
+	ledgersMu sync.Mutex
+)
+
+// OpenLedger returns the shared ledger for path so that concurrent
+// summaries in one process see each other's spend
+func OpenLedger(path string) *Ledger {
+	ledgersMu.Lock()
+	defer ledgersMu.Unlock()
+	if l, ok := ledgers[path]; ok {
+		return l
+	}
+	l := &Ledger{path: path}
+	ledgers[path] = l
+	return l
+}
+
+// LedgerPath is the configured ledger file, defaulting to the log directory
+func LedgerPath(cfg *config.Config) string {
+	if cfg.LLM.Usage.Ledger != "" {
+		return cfg.LLM.Usage.Ledger
+	}
+	return filepath.Join(cfg.Logging.Directory, "llm_usage.jsonl")
+}
+
+// scan calls fn for every record in the file at or after since
+func (l *Ledger) scan(since time.Time, fn func(UsageRecord)) error {
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open usage ledger: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec UsageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		if !rec.Time.Before(since) {
+			fn(rec)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read usage ledger: %w", err)
+	}
+	return nil
+}
+
+// load sums the spend of the day and month containing now from the file,
+// unless the running totals already cover that day
+func (l *Ledger) load(now time.Time) error {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if !l.day.IsZero() && l.day.Equal(day) {
+		return nil
+	}
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	var daySpent, monthSpent float64
+	err := l.scan(month, func(rec UsageRecord) {
+		if inPeriod(rec.Time, month, month.AddDate(0, 1, 0)) {
+			monthSpent += rec.Cost
+		}
+		if inPeriod(rec.Time, day, day.AddDate(0, 0, 1)) {
+			daySpent += rec.Cost
+		}
+	})
+	if err != nil {
+		return err
+	}
+	l.day, l.month = day, month
+	l.daySpent, l.monthSpent = daySpent, monthSpent
+	return nil
+}
+
+func inPeriod(t, start, end time.Time) bool {
+	return !t.Before(start) && t.Before(end)
+}
+
+func (l *Ledger) Record(rec UsageRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create ledger directory: %w", err)
+	}
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open usage ledger: %w", err)
+	}
+	defer file.Close()
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage record: %w", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write usage record: %w", err)
+	}
+	// totals not loaded yet will be read from the file
+	if !l.day.IsZero() {
+		if inPeriod(rec.Time, l.month, l.month.AddDate(0, 1, 0)) {
+			l.monthSpent += rec.Cost
+		}
+		if inPeriod(rec.Time, l.day, l.day.AddDate(0, 0, 1)) {
+			l.daySpent += rec.Cost
+		}
+	}
+	return nil
+}
+
+// Records calls fn for every record at or after since, reading the file
+func (l *Ledger) Records(since time.Time, fn func(UsageRecord)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.scan(since, fn)
+}
+
+// Spent returns the spend of the day and of the month containing now
+func (l *Ledger) Spent(now time.Time) (day, month float64, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(now); err != nil {
+		return 0, 0, err
+	}
+	return l.daySpent, l.monthSpent, nil
+}
+
+// CheckBudget returns ErrBudgetExceeded once today's or this month's spend
+// has reached its cap
+func CheckBudget(cfg *config.Config, ledger *Ledger, now time.Time) error {
+	usage := cfg.LLM.Usage
+	if usage.DailyBudget <= 0 && usage.MonthlyBudget <= 0 {
+		return nil
+	}
+	day, month, err := ledger.Spent(now)
+	if err != nil {
+		return err
+	}
+	if usage.DailyBudget > 0 && day >= usage.DailyBudget {
+		return fmt.Errorf("%w: spent $%.2f of $%.2f daily budget", ErrBudgetExceeded, day, usage.DailyBudget)
+	}
+	if usage.MonthlyBudget > 0 && month >= usage.MonthlyBudget {
+		return fmt.Errorf("%w: spent $%.2f of $%.2f monthly budget", ErrBudgetExceeded, month, usage.MonthlyBudget)
+	}
+	return nil
+}
+
+// EstimateCost prices a request using the configured per-1K-token table
+func EstimateCost(cfg *config.Config, model string, usage Usage) float64 {
+	price, ok := cfg.LLM.Usage.Prices[model]
+	if !ok {
+		return 0
+	}
+	return float64(usage.PromptTokens)/1000*price.Prompt + float64(usage.CompletionTokens)/1000*price.Completion
+}
@@ -0,0 +1,166 @@
+package llm
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+func TestEstimateCost(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.LLM.Usage.Prices = map[string]config.ModelPrice{
+		"gpt-4o": {Prompt: 0.005, Completion: 0.015},
+	}
+
+	tests := []struct {
+		name  string
+		model string
+		usage Usage
+		want  float64
+	}{
+		{"priced model", "gpt-4o", Usage{PromptTokens: 2000, CompletionTokens: 1000}, 0.025},
+		{"no tokens", "gpt-4o", Usage{}, 0},
+		{"unpriced model", "other", Usage{PromptTokens: 2000, CompletionTokens: 1000}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EstimateCost(cfg, tt.model, tt.usage)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("EstimateCost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckBudget(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		daily    float64
+		monthly  float64
+		spend    map[time.Time]float64
+		exceeded bool
+	}{
+		{
+			name:  "no budget",
+			spend: map[time.Time]float64{now: 100},
+		},
+		{
+			name:  "under daily budget",
+			daily: 1,
+			spend: map[time.Time]float64{now: 0.5},
+		},
+		{
+			name:     "daily budget reached",
+			daily:    1,
+			spend:    map[time.Time]float64{now: 0.5, now.Add(-time.Hour): 0.5},
+			exceeded: true,
+		},
+		{
+			name:  "yesterday does not count against today",
+			daily: 1,
+			spend: map[time.Time]float64{now.AddDate(0, 0, -1): 5, now: 0.5},
+		},
+		{
+			name:     "monthly budget reached across days",
+			daily:    10,
+			monthly:  3,
+			spend:    map[time.Time]float64{now.AddDate(0, 0, -10): 2, now: 1},
+			exceeded: true,
+		},
+		{
+			name:    "last month does not count against this month",
+			monthly: 3,
+			spend:   map[time.Time]float64{now.AddDate(0, -1, 0): 10, now: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.LLM.Usage.DailyBudget = tt.daily
+			cfg.LLM.Usage.MonthlyBudget = tt.monthly
+
+			ledger := OpenLedger(filepath.Join(t.TempDir(), "usage.jsonl"))
+			for at, cost := range tt.spend {
+				if err := ledger.Record(UsageRecord{Time: at, Cost: cost}); err != nil {
+					t.Fatalf("Record() error = %v", err)
+				}
+			}
+
+			err := CheckBudget(cfg, ledger, now)
+			if got := errors.Is(err, ErrBudgetExceeded); got != tt.exceeded {
+				t.Errorf("CheckBudget() error = %v, want exceeded %v", err, tt.exceeded)
+			}
+		})
+	}
+}
+
+func TestLedgerReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	now := time.Now()
+
+	written := OpenLedger(path)
+	for _, cost := range []float64{0.25, 0.5} {
+		if err := written.Record(UsageRecord{Time: now, Cost: cost}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	// a fresh ledger on the same file sees what an earlier process spent
+	reloaded := &Ledger{path: path}
+	day, month, err := reloaded.Spent(now)
+	if err != nil {
+		t.Fatalf("Spent() error = %v", err)
+	}
+	if day != 0.75 || month != 0.75 {
+		t.Errorf("Spent() = %v, %v, want 0.75, 0.75", day, month)
+	}
+}
+
+func TestLedgerRunningTotals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	ledger := OpenLedger(path)
+	for _, rec := range []UsageRecord{
+		{Time: now.AddDate(0, 0, -31), Cost: 8},
+		{Time: now.AddDate(0, 0, -1), Cost: 4},
+		{Time: now.Add(-time.Hour), Cost: 2},
+	} {
+		if err := ledger.Record(rec); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	check := func(at time.Time, wantDay, wantMonth float64) {
+		t.Helper()
+		day, month, err := ledger.Spent(at)
+		if err != nil {
+			t.Fatalf("Spent() error = %v", err)
+		}
+		if day != wantDay || month != wantMonth {
+			t.Errorf("Spent(%s) = %v, %v, want %v, %v", at.Format(time.DateOnly), day, month, wantDay, wantMonth)
+		}
+	}
+	check(now, 2, 6)
+
+	// new requests are added to the totals without reading the file
+	ledger.Record(UsageRecord{Time: now, Cost: 1})
+	check(now, 3, 7)
+
+	// the totals start over with the next day and month
+	ledger.Record(UsageRecord{Time: now.AddDate(0, 0, 1), Cost: 0.5})
+	check(now.AddDate(0, 0, 1), 0.5, 0.5)
+
+	var total float64
+	if err := ledger.Records(now.AddDate(0, 0, -1), func(rec UsageRecord) { total += rec.Cost }); err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if total != 7.5 {
+		t.Errorf("Records() since yesterday cost %v, want 7.5", total)
+	}
+}
@@ -0,0 +1,262 @@
+package logger
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The chain file starts with a header line naming the log, followed by one
+// line per write to the log:
+//
+//	R <offset> <length> <hash>
+//
+// where each hash covers the previous one, the offset and length, and the
+// bytes written. Closing the log appends a trailer with the totals and,
+// if a signer is configured, a signature over the trailer:
+//
+//	END <records> <size> <final hash> <time>
+//	SIG <format> <signature>
+const chainVersion = "ssh-proxy-chain/1"
+
+// ChainPath returns the sidecar file holding the hash chain of a log. A
+// compressed log keeps the chain of the original.
+func ChainPath(logPath string) string {
+	return strings.TrimSuffix(logPath, ".gz") + ".chain"
+}
+
+type chainWriter struct {
+	f      *os.File
+	key    []byte
+	signer ssh.Signer
+	prev   []byte
+	offset int64
+	count  int
+}
+
+func newChainWriter(logPath string, opts Options) (*chainWriter, error) {
+	f, err := os.OpenFile(ChainPath(logPath), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	c := &chainWriter{f: f, key: opts.HMACKey, signer: opts.Signer}
+	header := chainHeader(algorithm(c.key), filepath.Base(logPath))
+	c.prev = chainSum(c.key, []byte(header))
+	if _, err := fmt.Fprintln(f, header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func algorithm(key []byte) string {
+	if len(key) > 0 {
+		return "hmac-sha256"
+	}
+	return "sha256"
+}
+
+// the header binds the chain to the log's name, so that chains cannot be
+// swapped between logs
+func chainHeader(alg, name string) string {
+	return fmt.Sprintf("%s %s %s", chainVersion, alg, name)
+}
+
+func chainSum(key []byte, parts ...[]byte) []byte {
+	var h hash.Hash
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+func nextLink(key, prev []byte, offset int64, p []byte) []byte {
+	var pos [16]byte
+	binary.BigEndian.PutUint64(pos[:8], uint64(offset))
+	binary.BigEndian.PutUint64(pos[8:], uint64(len(p)))
+	return chainSum(key, prev, pos[:], p)
+}
+
+func (c *chainWriter) record(p []byte) error {
+	c.prev = nextLink(c.key, c.prev, c.offset, p)
+	if _, err := fmt.Fprintf(c.f, "R %d %d %x\n", c.offset, len(p), c.prev); err != nil {
+		return fmt.Errorf("failed to extend hash chain: %w", err)
+	}
+	c.offset += int64(len(p))
+	c.count++
+	return nil
+}
+
+func (c *chainWriter) close() error {
+	defer c.f.Close()
+
+	trailer := fmt.Sprintf("END %d %d %x %s", c.count, c.offset, c.prev, time.Now().UTC().Format(time.RFC3339))
+	if _, err := fmt.Fprintln(c.f, trailer); err != nil {
+		return fmt.Errorf("failed to write chain trailer: %w", err)
+	}
+	if c.signer == nil {
+		return nil
+	}
+	sig, err := c.signer.Sign(rand.Reader, []byte(trailer))
+	if err != nil {
+		return fmt.Errorf("failed to sign chain trailer: %w", err)
+	}
+	_, err = fmt.Fprintf(c.f, "SIG %s %s\n", sig.Format, base64.StdEncoding.EncodeToString(ssh.Marshal(sig)))
+	return err
+}
+
+// VerifyOptions hold what is needed to check a chain
+type VerifyOptions struct {
+	// Must match the key the log was written with, for HMAC chains
+	HMACKey []byte
+	// If set, the trailer must carry a valid signature by this key
+	PublicKey ssh.PublicKey
+}
+
+// Verification describes a log whose chain checked out
+type Verification struct {
+	Algorithm string
+	Records   int
+	Size      int64
+	// false if the trailer is missing, e.g. because the session is still open
+	Complete bool
+	Ended    time.Time
+	Signed   bool
+}
+
+var ErrNoChain = errors.New("no hash chain")
+
+// Verify checks a log against its chain file and reports the first sign
+// of truncation, modification or reordering
+func Verify(logPath string, opts VerifyOptions) (*Verification, error) {
+	data, err := readRaw(logPath)
+	if err != nil {
+		return nil, err
+	}
+	chainFile, err := os.Open(ChainPath(logPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoChain
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer chainFile.Close()
+
+	scanner := bufio.NewScanner(chainFile)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("chain file is empty")
+	}
+	fields := strings.Fields(scanner.Text())
+	if len(fields) != 3 || fields[0] != chainVersion {
+		return nil, fmt.Errorf("unrecognized chain header")
+	}
+	v := &Verification{Algorithm: fields[1]}
+	if fields[2] != filepath.Base(strings.TrimSuffix(logPath, ".gz")) {
+		return nil, fmt.Errorf("chain belongs to %s, not this log", fields[2])
+	}
+	var key []byte
+	switch v.Algorithm {
+	case "sha256":
+	case "hmac-sha256":
+		if len(opts.HMACKey) == 0 {
+			return nil, fmt.Errorf("log is HMAC-chained but no key was given")
+		}
+		key = opts.HMACKey
+	default:
+		return nil, fmt.Errorf("unsupported chain algorithm %s", v.Algorithm)
+	}
+	prev := chainSum(key, []byte(scanner.Text()))
+
+	var trailer string
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case fields[0] == "R" && trailer == "":
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("malformed chain record %d", v.Records+1)
+			}
+			offset, err1 := strconv.ParseInt(fields[1], 10, 64)
+			length, err2 := strconv.ParseInt(fields[2], 10, 64)
+			if err1 != nil || err2 != nil || length < 0 {
+				return nil, fmt.Errorf("malformed chain record %d", v.Records+1)
+			}
+			if offset != v.Size {
+				return nil, fmt.Errorf("chain record %d starts at byte %d, expected %d: chain reordered or edited", v.Records+1, offset, v.Size)
+			}
+			if offset+length > int64(len(data)) {
+				return nil, fmt.Errorf("log truncated: chain record %d ends at byte %d but the log has %d bytes", v.Records+1, offset+length, len(data))
+			}
+			prev = nextLink(key, prev, offset, data[offset:offset+length])
+			if !hmac.Equal([]byte(hex.EncodeToString(prev)), []byte(fields[3])) {
+				return nil, fmt.Errorf("log modified: bytes %d-%d (record %d) do not match the chain", offset, offset+length, v.Records+1)
+			}
+			v.Records++
+			v.Size += length
+		case fields[0] == "END" && trailer == "":
+			if len(fields) != 5 {
+				return nil, fmt.Errorf("malformed chain trailer")
+			}
+			if fields[1] != strconv.Itoa(v.Records) || fields[2] != strconv.FormatInt(v.Size, 10) || fields[3] != hex.EncodeToString(prev) {
+				return nil, fmt.Errorf("chain trailer does not match the chain: records removed or edited")
+			}
+			v.Ended, _ = time.Parse(time.RFC3339, fields[4])
+			v.Complete = true
+			trailer = line
+		case fields[0] == "SIG" && trailer != "" && !v.Signed:
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("malformed trailer signature")
+			}
+			if opts.PublicKey == nil {
+				continue
+			}
+			blob, err := base64.StdEncoding.DecodeString(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("malformed trailer signature")
+			}
+			var sig ssh.Signature
+			if err := ssh.Unmarshal(blob, &sig); err != nil {
+				return nil, fmt.Errorf("malformed trailer signature")
+			}
+			if err := opts.PublicKey.Verify([]byte(trailer), &sig); err != nil {
+				return nil, fmt.Errorf("chain trailer signature is invalid")
+			}
+			v.Signed = true
+		default:
+			return nil, fmt.Errorf("unexpected line in chain file: %q", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read chain file: %w", err)
+	}
+
+	if v.Size < int64(len(data)) {
+		return nil, fmt.Errorf("log has %d bytes after the end of the chain: data appended or inserted", int64(len(data))-v.Size)
+	}
+	if v.Complete && opts.PublicKey != nil && !v.Signed {
+		return nil, fmt.Errorf("chain trailer is not signed")
+	}
+	return v, nil
+}
@@ -0,0 +1,215 @@
+package logger
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var chainWrites = []string{"$ whoami\n", "root\n", "$ exit\n"}
+
+func newSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// writeChained writes chainWrites to a new log, closing it if asked
+func writeChained(t *testing.T, opts Options, close bool) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "session_abc.log")
+	opts.Integrity = true
+	f, err := Create(path, opts)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	for _, w := range chainWrites {
+		if _, err := f.Write([]byte(w)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if close {
+		if err := f.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	} else {
+		t.Cleanup(func() { f.f.Close(); f.chain.f.Close() })
+	}
+	return path
+}
+
+func editFile(t *testing.T, path string, edit func(string) string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(edit(string(data))), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dropLines removes every chain line starting with one of the prefixes
+func dropLines(prefixes ...string) func(string) string {
+	return func(s string) string {
+		var kept []string
+		for _, line := range strings.SplitAfter(s, "\n") {
+			drop := false
+			for _, p := range prefixes {
+				if strings.HasPrefix(line, p) {
+					drop = true
+				}
+			}
+			if !drop {
+				kept = append(kept, line)
+			}
+		}
+		return strings.Join(kept, "")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	signer := newSigner(t)
+	other := newSigner(t)
+	hmacKey := []byte("chain-key")
+
+	tests := []struct {
+		name      string
+		opts      Options
+		unclosed  bool
+		editLog   func(string) string
+		editChain func(string) string
+		verify    VerifyOptions
+		complete  bool
+		signed    bool
+		wantErr   string
+	}{
+		{
+			name:     "intact",
+			complete: true,
+		},
+		{
+			name:     "intact with hmac and signature",
+			opts:     Options{HMACKey: hmacKey, Signer: signer},
+			verify:   VerifyOptions{HMACKey: hmacKey, PublicKey: signer.PublicKey()},
+			complete: true,
+			signed:   true,
+		},
+		{
+			name:     "signature not checked without a public key",
+			opts:     Options{Signer: signer},
+			complete: true,
+		},
+		{
+			name:     "open session has no trailer",
+			unclosed: true,
+		},
+		{
+			name:    "modified byte",
+			editLog: func(s string) string { return strings.Replace(s, "root", "user", 1) },
+			wantErr: "log modified",
+		},
+		{
+			name:    "log truncated",
+			editLog: func(s string) string { return s[:len(s)-3] },
+			wantErr: "log truncated",
+		},
+		{
+			name:    "data appended",
+			editLog: func(s string) string { return s + "$ rm -rf /\n" },
+			wantErr: "after the end of the chain",
+		},
+		{
+			name:      "record removed",
+			editChain: dropLines("R 0 "),
+			wantErr:   "expected 0",
+		},
+		{
+			name:      "log and chain truncated together",
+			editLog:   func(s string) string { return strings.TrimSuffix(s, chainWrites[2]) },
+			editChain: dropLines("R 14 ", "END "),
+		},
+		{
+			name:      "last record removed from chain only",
+			editChain: dropLines("R 14 "),
+			wantErr:   "trailer does not match",
+		},
+		{
+			name:      "chain for another log",
+			editChain: func(s string) string { return strings.Replace(s, "session_abc.log", "session_xyz.log", 1) },
+			wantErr:   "chain belongs to session_xyz.log",
+		},
+		{
+			name:    "hmac chain without key",
+			opts:    Options{HMACKey: hmacKey},
+			wantErr: "no key was given",
+		},
+		{
+			name:    "hmac chain with wrong key",
+			opts:    Options{HMACKey: hmacKey},
+			verify:  VerifyOptions{HMACKey: []byte("other-key")},
+			wantErr: "log modified",
+		},
+		{
+			name:    "signed by another key",
+			opts:    Options{Signer: signer},
+			verify:  VerifyOptions{PublicKey: other.PublicKey()},
+			wantErr: "signature is invalid",
+		},
+		{
+			name:      "signature removed",
+			opts:      Options{Signer: signer},
+			editChain: dropLines("SIG "),
+			verify:    VerifyOptions{PublicKey: signer.PublicKey()},
+			wantErr:   "not signed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeChained(t, tt.opts, !tt.unclosed)
+			if tt.editLog != nil {
+				editFile(t, path, tt.editLog)
+			}
+			if tt.editChain != nil {
+				editFile(t, ChainPath(path), tt.editChain)
+			}
+
+			v, err := Verify(path, tt.verify)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if v.Complete != tt.complete || v.Signed != tt.signed {
+				t.Errorf("Verify() = %+v, want complete %v, signed %v", v, tt.complete, tt.signed)
+			}
+		})
+	}
+}
+
+func TestVerifyNoChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session_abc.log")
+	if err := os.WriteFile(path, []byte("plain\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(path, VerifyOptions{}); !errors.Is(err, ErrNoChain) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrNoChain)
+	}
+}
@@ -0,0 +1,257 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// An encrypted file starts with a magic line and the sender's ephemeral
+// X25519 public key. The rest is a sequence of frames, one per write:
+//
+//	<4-byte big-endian length> <ChaCha20-Poly1305 ciphertext>
+//
+// Frames are numbered by their nonce, and an empty frame marked as the last
+// one is written on close, so that dropped, reordered or truncated frames
+// are detected when decrypting. Only the holder of the recipient's private
+// key can read the file; the proxy only ever has the public key.
+const encryptedMagic = "ssh-proxy-encrypted/1\n"
+
+// largest frame a reader will accept
+const maxFrame = 1 << 24
+
+var (
+	// ErrEncrypted is returned when reading an encrypted file without a key
+	ErrEncrypted = errors.New("file is encrypted")
+	// ErrIncomplete is returned after decrypting a file that was never
+	// closed, e.g. because the proxy stopped during the session
+	ErrIncomplete = errors.New("file ends before its final frame")
+)
+
+// GenerateKey returns a new X25519 key pair for log encryption
+func GenerateKey() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// EncodeKey formats a public or private key for configuration files
+func EncodeKey(key interface{ Bytes() []byte }) string {
+	return base64.StdEncoding.EncodeToString(key.Bytes())
+}
+
+// ParsePublicKey parses a base64 X25519 public key
+func ParsePublicKey(s string) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	key, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return key, nil
+}
+
+// ParsePrivateKey parses a base64 X25519 private key. Lines starting with
+// '#' are ignored, so a key file may carry its public key as a comment.
+func ParsePrivateKey(data []byte) (*ecdh.PrivateKey, error) {
+	var encoded string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			encoded = line
+			break
+		}
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	return key, nil
+}
+
+func streamKey(shared, ephemeral, recipient []byte) ([]byte, error) {
+	salt := append(bytes.Clone(ephemeral), recipient...)
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(encryptedMagic)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// frameNonce numbers the frames; the last byte marks the final one
+func frameNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+type encrypter struct {
+	aead    cipher.AEAD
+	counter uint64
+}
+
+// newEncrypter returns the file header and an encrypter for the frames
+// that follow it
+func newEncrypter(recipient *ecdh.PublicKey) ([]byte, *encrypter, error) {
+	ephemeral, err := GenerateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := streamKey(shared, ephemeral.PublicKey().Bytes(), recipient.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := append([]byte(encryptedMagic), ephemeral.PublicKey().Bytes()...)
+	return header, &encrypter{aead: aead}, nil
+}
+
+// seal returns p as one frame
+func (e *encrypter) seal(p []byte, last bool) []byte {
+	frame := make([]byte, 4, 4+len(p)+e.aead.Overhead())
+	frame = e.aead.Seal(frame, frameNonce(e.counter, last), p, nil)
+	binary.BigEndian.PutUint32(frame, uint32(len(frame)-4))
+	e.counter++
+	return frame
+}
+
+// IsEncrypted reports whether the file at path was written encrypted
+func IsEncrypted(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(encryptedMagic))
+	n, _ := io.ReadFull(f, magic)
+	return string(magic[:n]) == encryptedMagic, nil
+}
+
+// ReadFile returns the contents of a log or summary, which may have been
+// compressed, or ErrEncrypted if it was written encrypted
+func ReadFile(path string) ([]byte, error) {
+	data, err := readRaw(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte(encryptedMagic)) {
+		return nil, ErrEncrypted
+	}
+	return data, nil
+}
+
+// WriteFile writes data to path, encrypted to recipient unless it is nil
+func WriteFile(path string, data []byte, recipient *ecdh.PublicKey) error {
+	if recipient == nil {
+		return os.WriteFile(path, data, 0644)
+	}
+	header, enc, err := newEncrypter(recipient)
+	if err != nil {
+		return fmt.Errorf("failed to set up encryption: %w", err)
+	}
+	out := header
+	for len(data) > 0 {
+		n := min(len(data), 64<<10)
+		out = append(out, enc.seal(data[:n], false)...)
+		data = data[n:]
+	}
+	out = append(out, enc.seal(nil, true)...)
+	return os.WriteFile(path, out, 0644)
+}
+
+// Decrypt copies the plaintext of an encrypted file to w. Everything that
+// could be authenticated is written before an error is returned; a file
+// that simply ends before its final frame returns ErrIncomplete.
+func Decrypt(r io.Reader, w io.Writer, key *ecdh.PrivateKey) error {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(encryptedMagic)+32)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(encryptedMagic)]) != encryptedMagic {
+		return fmt.Errorf("not an encrypted file")
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(header[len(encryptedMagic):])
+	if err != nil {
+		return fmt.Errorf("invalid file header: %w", err)
+	}
+	shared, err := key.ECDH(ephemeral)
+	if err != nil {
+		return fmt.Errorf("invalid file header: %w", err)
+	}
+	fileKey, err := streamKey(shared, ephemeral.Bytes(), key.PublicKey().Bytes())
+	if err != nil {
+		return err
+	}
+	aead, err := chacha20poly1305.New(fileKey)
+	if err != nil {
+		return err
+	}
+
+	var counter uint64
+	var length [4]byte
+	for {
+		if _, err := io.ReadFull(br, length[:]); err != nil {
+			if err == io.EOF {
+				return ErrIncomplete
+			}
+			return fmt.Errorf("frame %d is cut short: file truncated or corrupted", counter)
+		}
+		n := binary.BigEndian.Uint32(length[:])
+		if n > maxFrame {
+			return fmt.Errorf("frame %d is too large (%d bytes)", counter, n)
+		}
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(br, frame); err != nil {
+			return fmt.Errorf("frame %d is cut short: file truncated or corrupted", counter)
+		}
+
+		// a failed Open clears its output, so frames are not opened in place
+		last := false
+		plain, err := aead.Open(nil, frameNonce(counter, false), frame, nil)
+		if err != nil {
+			if plain, err = aead.Open(nil, frameNonce(counter, true), frame, nil); err != nil {
+				if counter == 0 {
+					return fmt.Errorf("failed to decrypt: wrong key or corrupted file")
+				}
+				return fmt.Errorf("failed to decrypt frame %d: corrupted, reordered or removed frames", counter)
+			}
+			last = true
+		}
+		if _, err := w.Write(plain); err != nil {
+			return err
+		}
+		counter++
+
+		if last {
+			if _, err := br.ReadByte(); err != io.EOF {
+				return fmt.Errorf("data after the final frame")
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var encryptedWrites = []string{"$ cat /etc/shadow\n", "root:*:19000:0:99999:7:::\n", "$ exit\n"}
+
+// splitFrames returns the header and frames of an encrypted file
+func splitFrames(t *testing.T, data []byte) ([]byte, [][]byte) {
+	t.Helper()
+	n := len(encryptedMagic) + 32
+	header, rest := data[:n], data[n:]
+	var frames [][]byte
+	for len(rest) > 0 {
+		size := 4 + int(binary.BigEndian.Uint32(rest))
+		if size > len(rest) {
+			t.Fatalf("frame of %d bytes but only %d left", size, len(rest))
+		}
+		frames = append(frames, rest[:size])
+		rest = rest[size:]
+	}
+	return header, frames
+}
+
+func joinFrames(header []byte, frames ...[]byte) []byte {
+	return append(bytes.Clone(header), bytes.Join(frames, nil)...)
+}
+
+func TestEncryptedLog(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "session_abc.log")
+	f, err := Create(path, Options{Recipient: key.PublicKey(), Transcript: true})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	for _, w := range encryptedWrites {
+		f.Write([]byte(w))
+	}
+	f.Write(nil)
+	want := strings.Join(encryptedWrites, "")
+	if got := string(f.Transcript()); got != want {
+		t.Errorf("Transcript() = %q, want %q", got, want)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("shadow")) {
+		t.Error("plaintext found in encrypted log")
+	}
+	// one frame per non-empty write and the final frame
+	if _, frames := splitFrames(t, data); len(frames) != len(encryptedWrites)+1 {
+		t.Errorf("got %d frames, want %d", len(frames), len(encryptedWrites)+1)
+	}
+	if ok, err := IsEncrypted(path); !ok || err != nil {
+		t.Errorf("IsEncrypted() = %v, %v, want true", ok, err)
+	}
+	if _, err := ReadFile(path); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("ReadFile() error = %v, want %v", err, ErrEncrypted)
+	}
+
+	var out bytes.Buffer
+	if err := Decrypt(bytes.NewReader(data), &out, key); err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if out.String() != want {
+		t.Errorf("Decrypt() = %q, want %q", out.String(), want)
+	}
+}
+
+func TestWriteFileRoundTrip(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"small", []byte("summary: nothing suspicious\n")},
+		{"several frames", bytes.Repeat([]byte("0123456789abcdef"), 10000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "summary.txt")
+			if err := WriteFile(path, tt.data, key.PublicKey()); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err := Decrypt(bytes.NewReader(data), &out, key); err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), tt.data) {
+				t.Errorf("Decrypt() returned %d bytes, want %d", out.Len(), len(tt.data))
+			}
+		})
+	}
+
+	// without a recipient the file is written as is
+	path := filepath.Join(t.TempDir(), "plain.txt")
+	if err := WriteFile(path, []byte("plain"), nil); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if data, err := ReadFile(path); err != nil || string(data) != "plain" {
+		t.Errorf("ReadFile() = %q, %v, want plain", data, err)
+	}
+}
+
+func TestDecryptTampering(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "session_abc.log")
+	f, err := Create(path, Options{Recipient: key.PublicKey()})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	for _, w := range encryptedWrites {
+		f.Write([]byte(w))
+	}
+	f.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, frames := splitFrames(t, data)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		key     bool
+		wantErr error
+		errText string
+		// plaintext that must have been written before the error
+		prefix string
+	}{
+		{
+			name:    "wrong key",
+			data:    data,
+			key:     true,
+			errText: "wrong key or corrupted file",
+		},
+		{
+			name:    "not encrypted",
+			data:    []byte("$ whoami\n"),
+			errText: "not an encrypted file",
+		},
+		{
+			name: "flipped ciphertext byte",
+			data: func() []byte {
+				d := joinFrames(header, frames...)
+				d[len(header)+len(frames[0])+8] ^= 1
+				return d
+			}(),
+			errText: "failed to decrypt frame 1",
+			prefix:  encryptedWrites[0],
+		},
+		{
+			name:    "frame removed",
+			data:    joinFrames(header, frames[0], frames[2], frames[3]),
+			errText: "failed to decrypt frame 1",
+			prefix:  encryptedWrites[0],
+		},
+		{
+			name:    "frames reordered",
+			data:    joinFrames(header, frames[1], frames[0], frames[2], frames[3]),
+			errText: "wrong key or corrupted file",
+		},
+		{
+			name:    "final frame removed",
+			data:    joinFrames(header, frames[:3]...),
+			wantErr: ErrIncomplete,
+			prefix:  strings.Join(encryptedWrites, ""),
+		},
+		{
+			name:    "cut mid-frame",
+			data:    joinFrames(header, frames...)[:len(header)+len(frames[0])+10],
+			errText: "frame 1 is cut short",
+			prefix:  encryptedWrites[0],
+		},
+		{
+			name:    "data after the final frame",
+			data:    append(joinFrames(header, frames...), 0),
+			errText: "data after the final frame",
+			prefix:  strings.Join(encryptedWrites, ""),
+		},
+		{
+			name: "oversized frame length",
+			data: func() []byte {
+				d := joinFrames(header, frames...)
+				binary.BigEndian.PutUint32(d[len(header):], maxFrame+1)
+				return d
+			}(),
+			errText: "too large",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := key
+			if tt.key {
+				k = other
+			}
+			var out bytes.Buffer
+			err := Decrypt(bytes.NewReader(tt.data), &out, k)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decrypt() error = %v, want %v", err, tt.wantErr)
+				}
+			case err == nil || !strings.Contains(err.Error(), tt.errText):
+				t.Fatalf("Decrypt() error = %v, want %q", err, tt.errText)
+			}
+			if out.String() != tt.prefix {
+				t.Errorf("Decrypt() wrote %q, want %q", out.String(), tt.prefix)
+			}
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ParsePublicKey(" " + EncodeKey(key.PublicKey()) + "\n")
+	if err != nil || !pub.Equal(key.PublicKey()) {
+		t.Errorf("ParsePublicKey() = %v, %v", pub, err)
+	}
+	file := "# public key: " + EncodeKey(key.PublicKey()) + "\n\n" + EncodeKey(key) + "\n"
+	priv, err := ParsePrivateKey([]byte(file))
+	if err != nil || !priv.Equal(key) {
+		t.Errorf("ParsePrivateKey() = %v, %v", priv, err)
+	}
+	for _, bad := range []string{"", "not base64!", "c2hvcnQ="} {
+		if _, err := ParsePublicKey(bad); err == nil {
+			t.Errorf("ParsePublicKey(%q) succeeded", bad)
+		}
+		if _, err := ParsePrivateKey([]byte(bad)); err == nil {
+			t.Errorf("ParsePrivateKey(%q) succeeded", bad)
+		}
+	}
+}
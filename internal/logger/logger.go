@@ -0,0 +1,154 @@
+// Package logger writes session logs, optionally hash-chained so that any
+// later modification can be detected with Verify, and optionally encrypted
+// so that they can only be read with the recipient's private key.
+package logger
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Options control how a session log is written
+type Options struct {
+	// Chain every write into a sidecar file next to the log
+	Integrity bool
+	// Key for an HMAC-SHA256 chain; a plain SHA-256 chain if empty
+	HMACKey []byte
+	// Signs the chain trailer when the log is closed; may be nil
+	Signer ssh.Signer
+	// Encrypt the log to this public key; the chain then covers the
+	// encrypted bytes, so logs can be verified without the private key
+	Recipient *ecdh.PublicKey
+	// Keep the plaintext of an encrypted log in memory, up to
+	// maxTranscript bytes, for the summarizer
+	Transcript bool
+	// Receives a copy of everything written to the log, in plaintext; it
+	// is closed with the log if it is an io.Closer
+	Mirror io.Writer
+}
+
+// how much of an encrypted session is kept for Transcript
+const maxTranscript = 16 << 20
+
+// File is a session log open for writing. Writes are serialized, so one
+// File can be shared by all the goroutines of a session.
+type File struct {
+	mu    sync.Mutex
+	f     *os.File
+	chain *chainWriter
+	enc   *encrypter
+	// plaintext of an encrypted log, if requested
+	transcript *bytes.Buffer
+	mirror     io.Writer
+}
+
+func Create(path string, opts Options) (*File, error) {
+	// never overwrite an existing log
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return nil, err
+	}
+	file := &File{f: f, mirror: opts.Mirror}
+	if opts.Integrity {
+		file.chain, err = newChainWriter(path, opts)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create hash chain: %w", err)
+		}
+	}
+	if opts.Recipient != nil {
+		header, enc, err := newEncrypter(opts.Recipient)
+		if err == nil {
+			_, err = file.write(header)
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to set up encryption: %w", err)
+		}
+		file.enc = enc
+		if opts.Transcript {
+			file.transcript = new(bytes.Buffer)
+		}
+	}
+	return file, nil
+}
+
+func (f *File) Name() string {
+	return f.f.Name()
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.mirror != nil {
+		f.mirror.Write(p)
+	}
+	if f.enc == nil {
+		return f.write(p)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if f.transcript != nil && f.transcript.Len() < maxTranscript {
+		f.transcript.Write(p[:min(len(p), maxTranscript-f.transcript.Len())])
+	}
+	if _, err := f.write(f.enc.seal(p, false)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// write puts p on disk and into the chain; the caller must hold f.mu
+func (f *File) write(p []byte) (int, error) {
+	n, err := f.f.Write(p)
+	if f.chain != nil && n > 0 {
+		if cerr := f.chain.record(p[:n]); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return n, err
+}
+
+// Transcript returns the plaintext kept for an encrypted log with
+// Options.Transcript, which may be cut short, or nil
+func (f *File) Transcript() []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.transcript == nil {
+		return nil
+	}
+	return bytes.Clone(f.transcript.Bytes())
+}
+
+// Close closes the log, writing the signed chain trailer if there is one
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var err error
+	if f.enc != nil {
+		_, err = f.write(f.enc.seal(nil, true))
+		f.enc = nil
+	}
+	if cerr := f.f.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if f.chain != nil {
+		if cerr := f.chain.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		f.chain = nil
+	}
+	if closer, ok := f.mirror.(io.Closer); ok {
+		closer.Close()
+		f.mirror = nil
+	}
+	return err
+}
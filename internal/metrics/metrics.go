@@ -0,0 +1,39 @@
+package metrics
+
+var (
+	// durations from milliseconds up to a minute, for dial latency
+	latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	// durations from seconds up to a working day, for session lengths
+	sessionBuckets = []float64{1, 10, 30, 60, 300, 900, 1800, 3600, 7200, 14400, 28800}
+)
+
+var (
+	ConnectionsAccepted = NewCounter("ssh_proxy_connections_accepted_total",
+		"TCP connections accepted by the proxy.")
+	HandshakeFailures = NewCounter("ssh_proxy_handshake_failures_total",
+		"Client connections that failed the SSH handshake or authentication.")
+	AuthAttempts = NewCounterVec("ssh_proxy_auth_attempts_total",
+		"Client authentication attempts by method, user and result.", "method", "user", "result")
+	ActiveConnections = NewGauge("ssh_proxy_active_connections",
+		"Open client connections, including ones still authenticating.")
+	ActiveSessions = NewGauge("ssh_proxy_active_sessions",
+		"Sessions currently being proxied.")
+	SessionDuration = NewHistogram("ssh_proxy_session_duration_seconds",
+		"Duration of completed sessions.", sessionBuckets)
+	UpstreamDialDuration = NewHistogram("ssh_proxy_upstream_dial_duration_seconds",
+		"Time taken to connect and authenticate to the upstream server.", latencyBuckets)
+	UpstreamDialFailures = NewCounter("ssh_proxy_upstream_dial_failures_total",
+		"Failed connections to the upstream server.")
+	BytesRelayed = NewCounterVec("ssh_proxy_bytes_relayed_total",
+		"Bytes relayed between clients and the upstream server.", "direction")
+	PolicyDenials = NewCounterVec("ssh_proxy_policy_denials_total",
+		"Connections, sessions or commands denied by policy.", "reason")
+	Bans = NewCounterVec("ssh_proxy_bans_total",
+		"Temporary bans issued after repeated failed logins, by kind (ip or user).", "kind")
+	SummarizerJobs = NewCounterVec("ssh_proxy_summarizer_jobs_total",
+		"Session summarization jobs by outcome.", "outcome")
+	ShippedEvents = NewCounterVec("ssh_proxy_shipped_events_total",
+		"Audit events by collector and outcome (sent, buffered or dropped).", "destination", "result")
+	RetentionActions = NewCounterVec("ssh_proxy_retention_actions_total",
+		"Session logs compressed, deleted or archived by the retention policy.", "action")
+)
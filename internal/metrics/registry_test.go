@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterVec(t *testing.T) {
+	v := NewCounterVec("test_requests_total", "Requests handled.", "method", "path")
+	v.WithLabelValues("GET", "/").Inc()
+	v.WithLabelValues("GET", "/").Add(2)
+	v.WithLabelValues("POST", `/a"b\c`+"\n").Inc()
+
+	r := &registry{}
+	r.register(v)
+	var b strings.Builder
+	r.expose(&b)
+
+	want := `# HELP test_requests_total Requests handled.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",path="/"} 3
+test_requests_total{method="POST",path="/a\"b\\c\n"} 1
+`
+	if b.String() != want {
+		t.Errorf("expose() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestGauge(t *testing.T) {
+	g := NewGauge("test_open_things", "Open things.")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+
+	r := &registry{}
+	r.register(defaultRegistryFamily(t, "test_open_things"))
+	var b strings.Builder
+	r.expose(&b)
+	if !strings.Contains(b.String(), "\ntest_open_things 1\n") {
+		t.Errorf("expose() =\n%s", b.String())
+	}
+
+	g.Set(0.5)
+	b.Reset()
+	r.expose(&b)
+	if !strings.Contains(b.String(), "\ntest_open_things 0.5\n") {
+		t.Errorf("expose() after Set =\n%s", b.String())
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test_latency_seconds", "Latency.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(2)
+
+	r := &registry{}
+	r.register(defaultRegistryFamily(t, "test_latency_seconds"))
+	var b strings.Builder
+	r.expose(&b)
+
+	want := `# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1"} 1
+test_latency_seconds_bucket{le="1"} 2
+test_latency_seconds_bucket{le="+Inf"} 3
+test_latency_seconds_sum 2.55
+test_latency_seconds_count 3
+`
+	if b.String() != want {
+		t.Errorf("expose() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestWrongLabelCount(t *testing.T) {
+	v := NewCounterVec("test_labelled_total", "Labelled.", "kind")
+	defer func() {
+		if recover() == nil {
+			t.Error("WithLabelValues() with too many values did not panic")
+		}
+	}()
+	v.WithLabelValues("a", "b")
+}
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := rec.Body.String()
+	// families are written in name order
+	accepted := strings.Index(body, "# TYPE ssh_proxy_connections_accepted_total counter")
+	active := strings.Index(body, "# TYPE ssh_proxy_active_sessions gauge")
+	if accepted < 0 || active < 0 || active > accepted {
+		t.Errorf("unexpected exposition:\n%s", body)
+	}
+}
+
+// defaultRegistryFamily finds a registered family by name
+func defaultRegistryFamily(t *testing.T, name string) collector {
+	t.Helper()
+	defaultRegistry.mu.Lock()
+	defer defaultRegistry.mu.Unlock()
+	for _, c := range defaultRegistry.collectors {
+		if c.name() == name {
+			return c
+		}
+	}
+	t.Fatalf("metric %s is not registered", name)
+	return nil
+}
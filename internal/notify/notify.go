@@ -0,0 +1,253 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+const (
+	EventAuthFailure  = "auth_failure"
+	EventPolicyDenied = "policy_denied"
+	EventSummaryRisk  = "summary_risk"
+	EventLiveRisk     = "live_risk"
+	// sent for every session that needs an approver, whatever the triggers
+	EventApprovalRequested = "approval_requested"
+
+	// recorded for auditing only, never sent as alerts
+	EventAuthSuccess  = "auth_success"
+	EventSessionStart = "session_start"
+	EventSessionEnd   = "session_end"
+	EventTranscript   = "transcript"
+	EventAgentSign    = "agent_sign"
+	EventX11Open      = "x11_open"
+)
+
+// how long a single sink gets to deliver an event
+const sendTimeout = 30 * time.Second
+
+type Event struct {
+	Type     string            `json:"type"`
+	Time     time.Time         `json:"time"`
+	Username string            `json:"username,omitempty"`
+	ClientIP string            `json:"client_ip,omitempty"`
+	Risk     string            `json:"risk,omitempty"`
+	Message  string            `json:"message"`
+	Details  map[string]string `json:"details,omitempty"`
+}
+
+// Title is a one-line description used by the human-readable sinks
+func (e Event) Title() string {
+	var b strings.Builder
+	b.WriteString("[ssh-proxy] ")
+	if e.Risk != "" {
+		fmt.Fprintf(&b, "%s risk: ", e.Risk)
+	}
+	b.WriteString(e.Message)
+	if e.Username != "" {
+		fmt.Fprintf(&b, " (user %s", e.Username)
+		if e.ClientIP != "" {
+			fmt.Fprintf(&b, " from %s", e.ClientIP)
+		}
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, event Event) error
+}
+
+type sinkEntry struct {
+	sink   Sink
+	events map[string]bool
+}
+
+// Notifier decides which events are worth an alert and fans them out to
+// the configured sinks
+type Notifier struct {
+	config   *config.Config
+	sinks    []sinkEntry
+	failures map[string][]time.Time
+	// receives every event, whether or not it triggers an alert
+	audit func(Event)
+	mu    sync.Mutex
+	wg    sync.WaitGroup
+}
+
+func NewNotifier(cfg *config.Config) (*Notifier, error) {
+	n := &Notifier{
+		config:   cfg,
+		failures: make(map[string][]time.Time),
+	}
+	if !cfg.Alerts.Enabled {
+		return n, nil
+	}
+	for _, sc := range cfg.Alerts.Sinks {
+		sink, err := newSink(sc)
+		if err != nil {
+			return nil, err
+		}
+		entry := sinkEntry{sink: sink}
+		if len(sc.Events) > 0 {
+			entry.events = make(map[string]bool)
+			for _, e := range sc.Events {
+				entry.events[e] = true
+			}
+		}
+		n.sinks = append(n.sinks, entry)
+	}
+	return n, nil
+}
+
+func newSink(sc config.AlertSink) (Sink, error) {
+	switch sc.Type {
+	case "webhook":
+		return NewWebhookSink(sc.URL, sc.Secret), nil
+	case "slack":
+		return NewSlackSink(sc.URL), nil
+	case "email":
+		return NewEmailSink(sc), nil
+	case "exec":
+		return NewExecSink(sc.Command), nil
+	default:
+		return nil, fmt.Errorf("unsupported alert sink type: %s", sc.Type)
+	}
+}
+
+// SetAudit sends a copy of every event to fn, including those that are
+// not alerted on
+func (n *Notifier) SetAudit(fn func(Event)) {
+	n.audit = fn
+}
+
+// Audit records an event for the audit trail without alerting on it
+func (n *Notifier) Audit(event Event) {
+	if n == nil || n.audit == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	n.audit(event)
+}
+
+// Notify dispatches the event asynchronously if it matches a trigger
+func (n *Notifier) Notify(event Event) {
+	if n == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	n.Audit(event)
+	if len(n.sinks) == 0 || !n.triggered(&event) {
+		return
+	}
+
+	for _, entry := range n.sinks {
+		if entry.events != nil && !entry.events[event.Type] {
+			continue
+		}
+		n.wg.Add(1)
+		go func(sink Sink) {
+			defer n.wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			defer cancel()
+			if err := sink.Send(ctx, event); err != nil {
+				log.Printf("Failed to send %s alert via %s: %v", event.Type, sink.Name(), err)
+			}
+		}(entry.sink)
+	}
+}
+
+// Wait blocks until all in-flight alerts have been delivered or failed
+func (n *Notifier) Wait() {
+	if n == nil {
+		return
+	}
+	n.wg.Wait()
+}
+
+// triggered reports whether the event is alerted on. Auth failures are
+// alerted once, when a user and address cross the threshold, and the alert
+// says so.
+func (n *Notifier) triggered(event *Event) bool {
+	triggers := n.config.Alerts.Triggers
+	switch event.Type {
+	case EventAuthFailure:
+		if triggers.AuthFailures <= 0 || n.countFailure(*event) != triggers.AuthFailures {
+			return false
+		}
+		event.Message = fmt.Sprintf("repeated authentication failures: %d within %s",
+			triggers.AuthFailures, triggers.AuthFailureWindow)
+		return true
+	case EventPolicyDenied:
+		return triggers.PolicyDenials
+	case EventSummaryRisk:
+		return triggers.SummaryRisk != "" && riskRank(event.Risk) >= riskRank(triggers.SummaryRisk)
+	case EventLiveRisk:
+		return triggers.LiveRisk
+	case EventApprovalRequested:
+		return true
+	default:
+		return true
+	}
+}
+
+// countFailure records an auth failure and returns how many failures the
+// same user and address have had inside the window. Pairs without a recent
+// failure are dropped, so that scanners trying many usernames do not grow
+// the map indefinitely.
+func (n *Notifier) countFailure(event Event) int {
+	key := event.Username + "@" + event.ClientIP
+	cutoff := event.Time.Add(-n.config.Alerts.Triggers.AuthFailureWindow)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for k, times := range n.failures {
+		if k != key && !times[len(times)-1].After(cutoff) {
+			delete(n.failures, k)
+		}
+	}
+
+	recent := n.failures[key][:0]
+	for _, t := range n.failures[key] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, event.Time)
+	n.failures[key] = recent
+	return len(recent)
+}
+
+func riskRank(level string) int {
+	switch strings.ToLower(level) {
+	case "low":
+		return 1
+	case "medium":
+		return 2
+	case "high":
+		return 3
+	default:
+		return 0
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,245 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+// recordingSink keeps every event it is sent
+type recordingSink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recordingSink) Name() string {
+	return "recording"
+}
+
+func (r *recordingSink) Send(ctx context.Context, event Event) error {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+	return nil
+}
+
+func newTestNotifier(cfg *config.Config, events ...string) (*Notifier, *recordingSink) {
+	sink := &recordingSink{}
+	entry := sinkEntry{sink: sink}
+	if len(events) > 0 {
+		entry.events = make(map[string]bool)
+		for _, e := range events {
+			entry.events[e] = true
+		}
+	}
+	n := &Notifier{
+		config:   cfg,
+		sinks:    []sinkEntry{entry},
+		failures: make(map[string][]time.Time),
+	}
+	return n, sink
+}
+
+func TestTriggers(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(cfg *config.Config)
+		event   Event
+		alerted bool
+	}{
+		{
+			name:    "policy denial with trigger",
+			setup:   func(cfg *config.Config) { cfg.Alerts.Triggers.PolicyDenials = true },
+			event:   Event{Type: EventPolicyDenied},
+			alerted: true,
+		},
+		{
+			name:  "policy denial without trigger",
+			event: Event{Type: EventPolicyDenied},
+		},
+		{
+			name:    "summary risk at threshold",
+			setup:   func(cfg *config.Config) { cfg.Alerts.Triggers.SummaryRisk = "medium" },
+			event:   Event{Type: EventSummaryRisk, Risk: "medium"},
+			alerted: true,
+		},
+		{
+			name:    "summary risk above threshold",
+			setup:   func(cfg *config.Config) { cfg.Alerts.Triggers.SummaryRisk = "medium" },
+			event:   Event{Type: EventSummaryRisk, Risk: "HIGH"},
+			alerted: true,
+		},
+		{
+			name:  "summary risk below threshold",
+			setup: func(cfg *config.Config) { cfg.Alerts.Triggers.SummaryRisk = "medium" },
+			event: Event{Type: EventSummaryRisk, Risk: "low"},
+		},
+		{
+			name:  "summary risk unknown",
+			setup: func(cfg *config.Config) { cfg.Alerts.Triggers.SummaryRisk = "low" },
+			event: Event{Type: EventSummaryRisk, Risk: "unknown"},
+		},
+		{
+			name:  "summary risk without trigger",
+			event: Event{Type: EventSummaryRisk, Risk: "high"},
+		},
+		{
+			name:    "live risk with trigger",
+			setup:   func(cfg *config.Config) { cfg.Alerts.Triggers.LiveRisk = true },
+			event:   Event{Type: EventLiveRisk, Risk: "high"},
+			alerted: true,
+		},
+		{
+			name:  "live risk without trigger",
+			event: Event{Type: EventLiveRisk, Risk: "high"},
+		},
+		{
+			name:  "auth failure without trigger",
+			event: Event{Type: EventAuthFailure, Username: "alice"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Alerts.Triggers.AuthFailureWindow = time.Minute
+			if tt.setup != nil {
+				tt.setup(cfg)
+			}
+			n, sink := newTestNotifier(cfg)
+			n.Notify(tt.event)
+			n.Wait()
+			if got := len(sink.events) == 1; got != tt.alerted {
+				t.Errorf("alerted = %v, want %v", got, tt.alerted)
+			}
+		})
+	}
+}
+
+func TestAuthFailureThreshold(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Alerts.Triggers.AuthFailures = 3
+	cfg.Alerts.Triggers.AuthFailureWindow = time.Minute
+	n, sink := newTestNotifier(cfg)
+
+	start := time.Now()
+	fail := func(user, ip string, at time.Duration) {
+		n.Notify(Event{Type: EventAuthFailure, Time: start.Add(at), Username: user, ClientIP: ip})
+	}
+	// the first failure falls out of the window before the third arrives
+	fail("alice", "10.0.0.1", 0)
+	fail("alice", "10.0.0.1", 50*time.Second)
+	fail("alice", "10.0.0.1", 70*time.Second)
+	// other users and addresses are counted separately
+	fail("bob", "10.0.0.1", 71*time.Second)
+	fail("alice", "10.0.0.2", 72*time.Second)
+	n.Wait()
+	if len(sink.events) != 0 {
+		t.Fatalf("alerted %d times before the threshold", len(sink.events))
+	}
+
+	// the third failure in the window alerts, further ones do not
+	fail("alice", "10.0.0.1", 80*time.Second)
+	fail("alice", "10.0.0.1", 90*time.Second)
+	n.Wait()
+	if len(sink.events) != 1 || sink.events[0].Username != "alice" || sink.events[0].ClientIP != "10.0.0.1" {
+		t.Fatalf("alerts = %+v, want one for alice from 10.0.0.1", sink.events)
+	}
+}
+
+func TestSinkEventFilter(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Alerts.Triggers.PolicyDenials = true
+	cfg.Alerts.Triggers.LiveRisk = true
+	n, sink := newTestNotifier(cfg, EventLiveRisk)
+
+	n.Notify(Event{Type: EventPolicyDenied})
+	n.Notify(Event{Type: EventLiveRisk, Risk: "high"})
+	n.Wait()
+	if len(sink.events) != 1 || sink.events[0].Type != EventLiveRisk {
+		t.Errorf("alerts = %+v, want only the live risk", sink.events)
+	}
+	if sink.events[0].Time.IsZero() {
+		t.Error("event time was not set")
+	}
+}
+
+func TestTitle(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  string
+	}{
+		{Event{Message: "proxy started"}, "[ssh-proxy] proxy started"},
+		{Event{Message: "rm -rf /", Risk: "high", Username: "bob"}, "[ssh-proxy] high risk: rm -rf / (user bob)"},
+		{Event{Message: "denied", Username: "bob", ClientIP: "10.0.0.1"}, "[ssh-proxy] denied (user bob from 10.0.0.1)"},
+	}
+	for _, tt := range tests {
+		if got := tt.event.Title(); got != tt.want {
+			t.Errorf("Title() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestNewNotifierSinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		sink    config.AlertSink
+		wantErr bool
+	}{
+		{"webhook", config.AlertSink{Type: "webhook", URL: "http://localhost/hook"}, false},
+		{"slack", config.AlertSink{Type: "slack", URL: "http://localhost/slack"}, false},
+		{"email", config.AlertSink{Type: "email", SMTPHost: "localhost"}, false},
+		{"exec", config.AlertSink{Type: "exec", Command: []string{"true"}}, false},
+		{"unknown", config.AlertSink{Type: "pager"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Alerts.Enabled = true
+			cfg.Alerts.Sinks = []config.AlertSink{tt.sink}
+			n, err := NewNotifier(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewNotifier() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && (len(n.sinks) != 1 || n.sinks[0].sink.Name() != tt.sink.Type) {
+				t.Errorf("sinks = %+v, want one %s sink", n.sinks, tt.sink.Type)
+			}
+		})
+	}
+}
+
+func TestAuthFailureAlertMessage(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Alerts.Triggers.AuthFailures = 2
+	cfg.Alerts.Triggers.AuthFailureWindow = 10 * time.Minute
+	n, sink := newTestNotifier(cfg)
+
+	for i := 0; i < 2; i++ {
+		n.Notify(Event{Type: EventAuthFailure, Username: "alice", ClientIP: "10.0.0.1", Message: "authentication failed with password"})
+	}
+	n.Wait()
+	if len(sink.events) != 1 {
+		t.Fatalf("alerts = %+v, want one", sink.events)
+	}
+	if want := "repeated authentication failures: 2 within 10m0s"; sink.events[0].Message != want {
+		t.Errorf("message = %q, want %q", sink.events[0].Message, want)
+	}
+}
+
+func TestCountFailureDropsExpiredPairs(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Alerts.Triggers.AuthFailureWindow = time.Minute
+	n, _ := newTestNotifier(cfg)
+
+	start := time.Now()
+	for i, user := range []string{"root", "admin", "oracle"} {
+		n.countFailure(Event{Username: user, ClientIP: "10.0.0.1", Time: start.Add(time.Duration(i) * time.Second)})
+	}
+	n.countFailure(Event{Username: "alice", ClientIP: "10.0.0.2", Time: start.Add(2 * time.Minute)})
+
+	if len(n.failures) != 1 {
+		t.Errorf("failures kept for %d pairs, want only the recent one", len(n.failures))
+	}
+}
@@ -0,0 +1,209 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+// WebhookSink posts the event as JSON. When a secret is set the body is
+// signed with HMAC-SHA256 in the X-SSH-Proxy-Signature header.
+type WebhookSink struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewWebhookSink(url, secret string) *WebhookSink {
+	return &WebhookSink{url: url, secret: secret, client: &http.Client{}}
+}
+
+func (w *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (w *WebhookSink) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	headers := map[string]string{}
+	if w.secret != "" {
+		headers["X-SSH-Proxy-Signature"] = "sha256=" + Sign(w.secret, body)
+	}
+	return postJSON(ctx, w.client, w.url, body, headers)
+}
+
+// Sign returns the hex HMAC-SHA256 of body, as sent by WebhookSink
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SlackSink posts to a Slack-compatible incoming webhook
+type SlackSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewSlackSink(url string) *SlackSink {
+	return &SlackSink{url: url, client: &http.Client{}}
+}
+
+func (s *SlackSink) Name() string {
+	return "slack"
+}
+
+func (s *SlackSink) Send(ctx context.Context, event Event) error {
+	text := event.Title()
+	for _, k := range sortedKeys(event.Details) {
+		text += fmt.Sprintf("\n• *%s*: %s", k, event.Details[k])
+	}
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return fmt.Errorf("failed to marshal slack payload: %w", err)
+	}
+	return postJSON(ctx, s.client, s.url, body, nil)
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status (%d): %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// EmailSink sends a plain-text mail through an SMTP relay
+type EmailSink struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func NewEmailSink(sc config.AlertSink) *EmailSink {
+	port := sc.SMTPPort
+	if port == 0 {
+		port = 25
+	}
+	return &EmailSink{
+		addr:     net.JoinHostPort(sc.SMTPHost, strconv.Itoa(port)),
+		host:     sc.SMTPHost,
+		username: sc.Username,
+		password: sc.Password,
+		from:     sc.From,
+		to:       sc.To,
+	}
+}
+
+func (e *EmailSink) Name() string {
+	return "email"
+}
+
+func (e *EmailSink) Send(ctx context.Context, event Event) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.to, ", "))
+	// the title contains the SSH username, which the client chooses; encoding
+	// it keeps CR and LF from starting new headers
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", event.Title()))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "Event: %s\r\nTime: %s\r\n", event.Type, event.Time.Format(time.RFC3339))
+	if event.Username != "" {
+		fmt.Fprintf(&msg, "User: %s\r\n", event.Username)
+	}
+	if event.ClientIP != "" {
+		fmt.Fprintf(&msg, "Client: %s\r\n", event.ClientIP)
+	}
+	if event.Risk != "" {
+		fmt.Fprintf(&msg, "Risk: %s\r\n", event.Risk)
+	}
+	for _, k := range sortedKeys(event.Details) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", k, event.Details[k])
+	}
+	fmt.Fprintf(&msg, "\r\n%s\r\n", event.Message)
+
+	var auth smtp.Auth
+	if e.username != "" {
+		auth = smtp.PlainAuth("", e.username, e.password, e.host)
+	}
+
+	// net/smtp has no context support, so give up waiting on it instead
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(e.addr, auth, e.from, e.to, msg.Bytes())
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ExecSink runs a local command with the event as JSON on stdin
+type ExecSink struct {
+	command []string
+}
+
+func NewExecSink(command []string) *ExecSink {
+	return &ExecSink{command: command}
+}
+
+func (x *ExecSink) Name() string {
+	return "exec"
+}
+
+func (x *ExecSink) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, x.command[0], x.command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"SSH_PROXY_EVENT="+event.Type,
+		"SSH_PROXY_USER="+event.Username,
+		"SSH_PROXY_CLIENT_IP="+event.ClientIP,
+		"SSH_PROXY_RISK="+event.Risk,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("command failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+var testEvent = Event{
+	Type:     EventLiveRisk,
+	Time:     time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC),
+	Username: "bob",
+	ClientIP: "10.0.0.1",
+	Risk:     "high",
+	Message:  "cat /etc/shadow",
+	Details:  map[string]string{"session": "abc", "command": "cat /etc/shadow"},
+}
+
+type capturedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func captureServer(t *testing.T, status int) (*httptest.Server, <-chan capturedRequest) {
+	t.Helper()
+	requests := make(chan capturedRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- capturedRequest{header: r.Header, body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func TestWebhookSink(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		status  int
+		wantErr bool
+	}{
+		{"unsigned", "", http.StatusOK, false},
+		{"signed", "s3cret", http.StatusNoContent, false},
+		{"rejected", "", http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := captureServer(t, tt.status)
+			err := NewWebhookSink(srv.URL, tt.secret).Send(context.Background(), testEvent)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, want error %v", err, tt.wantErr)
+			}
+			req := <-requests
+
+			var got Event
+			if err := json.Unmarshal(req.body, &got); err != nil {
+				t.Fatalf("body is not an event: %v", err)
+			}
+			if got.Type != testEvent.Type || got.Username != "bob" || got.Details["session"] != "abc" {
+				t.Errorf("event = %+v", got)
+			}
+			signature := req.header.Get("X-SSH-Proxy-Signature")
+			if tt.secret == "" {
+				if signature != "" {
+					t.Errorf("unexpected signature %q", signature)
+				}
+			} else if signature != "sha256="+Sign(tt.secret, req.body) {
+				t.Errorf("signature = %q does not match the body", signature)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	// HMAC-SHA256 test vector from RFC 4231, test case 2
+	got := Sign("Jefe", []byte("what do ya want for nothing?"))
+	if want := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"; got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+}
+
+func TestSlackSink(t *testing.T) {
+	srv, requests := captureServer(t, http.StatusOK)
+	if err := NewSlackSink(srv.URL).Send(context.Background(), testEvent); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	req := <-requests
+
+	var payload map[string]string
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	want := "[ssh-proxy] high risk: cat /etc/shadow (user bob from 10.0.0.1)\n• *command*: cat /etc/shadow\n• *session*: abc"
+	if payload["text"] != want {
+		t.Errorf("text = %q, want %q", payload["text"], want)
+	}
+}
+
+func TestExecSink(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "event")
+	script := `cat > "$1"; echo >> "$1"; echo "$SSH_PROXY_EVENT $SSH_PROXY_USER $SSH_PROXY_CLIENT_IP $SSH_PROXY_RISK" >> "$1"`
+	sink := NewExecSink([]string{"sh", "-c", script, "sh", out})
+	if err := sink.Send(context.Background(), testEvent); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, env, _ := strings.Cut(string(data), "\n")
+	if !strings.Contains(body, `"type":"live_risk"`) {
+		t.Errorf("stdin = %q, want the event as JSON", body)
+	}
+	if env != "live_risk bob 10.0.0.1 high\n" {
+		t.Errorf("environment = %q", env)
+	}
+
+	failing := NewExecSink([]string{"sh", "-c", "echo broken >&2; exit 3"})
+	if err := failing.Send(context.Background(), testEvent); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Send() error = %v, want the command's output", err)
+	}
+}
+
+// fakeSMTP accepts one message and returns what was sent after DATA
+func fakeSMTP(t *testing.T) (string, int, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		fmt.Fprintf(conn, "220 localhost ESMTP\r\n")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					messages <- data.String()
+					fmt.Fprintf(conn, "250 OK\r\n")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				fmt.Fprintf(conn, "250 localhost\r\n")
+			case cmd == "DATA":
+				inData = true
+				fmt.Fprintf(conn, "354 go ahead\r\n")
+			case cmd == "QUIT":
+				fmt.Fprintf(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprintf(conn, "250 OK\r\n")
+			}
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, messages
+}
+
+func TestEmailSink(t *testing.T) {
+	host, port, messages := fakeSMTP(t)
+	sink := NewEmailSink(config.AlertSink{SMTPHost: host, SMTPPort: port, From: "proxy@example.com", To: []string{"sec@example.com"}})
+	if err := sink.Send(context.Background(), testEvent); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	msg := <-messages
+	for _, want := range []string{
+		"From: proxy@example.com\r\n",
+		"To: sec@example.com\r\n",
+		"Event: live_risk\r\nTime: 2026-03-15T12:00:00Z\r\n",
+		"User: bob\r\nClient: 10.0.0.1\r\nRisk: high\r\ncommand: cat /etc/shadow\r\nsession: abc\r\n",
+		"\r\n\r\ncat /etc/shadow\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message is missing %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestEmailSinkHeaders(t *testing.T) {
+	host, port, messages := fakeSMTP(t)
+	sink := NewEmailSink(config.AlertSink{SMTPHost: host, SMTPPort: port, From: "proxy@example.com", To: []string{"sec@example.com"}})
+
+	event := testEvent
+	// usernames are chosen by the client
+	event.Username = "bob\r\nBcc: attacker@example.com"
+	if err := sink.Send(context.Background(), event); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	msg := <-messages
+
+	headers, _, _ := strings.Cut(msg, "\r\n\r\n")
+	for _, line := range strings.Split(headers, "\r\n") {
+		if strings.HasPrefix(strings.ToLower(line), "bcc:") {
+			t.Fatalf("username injected a header: %q", headers)
+		}
+	}
+	var subject string
+	for _, line := range strings.Split(headers, "\r\n") {
+		if rest, ok := strings.CutPrefix(line, "Subject: "); ok {
+			subject = rest
+		}
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(subject)
+	if err != nil {
+		t.Fatalf("subject %q does not decode: %v", subject, err)
+	}
+	if want := event.Title(); decoded != want {
+		t.Errorf("subject = %q, want %q", decoded, want)
+	}
+}
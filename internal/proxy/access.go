@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/metrics"
+	"github.com/devashar13/ssh-proxy/internal/notify"
+)
+
+var errBanned = errors.New("too many failed logins, try again later")
+
+// admitSource decides whether a new client address may start an SSH
+// handshake at all. It returns the rejection reason when it may not.
+func (s *Server) admitSource(cfg *config.Config, addr net.Addr) (string, bool) {
+	ip, err := netip.ParseAddr(hostOnly(addr))
+	if err != nil {
+		return "", true
+	}
+	ip = ip.Unmap()
+
+	// the lists were validated when the configuration was loaded
+	deny, _ := config.ParsePrefixes(cfg.Security.DenyCIDRs)
+	if containsAddr(deny, ip) {
+		return "source_denied", false
+	}
+	allow, _ := config.ParsePrefixes(cfg.Security.AllowCIDRs)
+	if len(allow) > 0 && !containsAddr(allow, ip) {
+		return "source_not_allowed", false
+	}
+
+	if cfg.Security.Lockout.Enabled {
+		if _, ok := s.lockout.banned(hostOnly(addr), ""); ok {
+			return "banned", false
+		}
+	}
+	return "", true
+}
+
+func containsAddr(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAccess applies the user's access rules once their credentials have
+// been accepted
+func (s *Server) checkAccess(conn ssh.ConnMetadata, user *config.User) error {
+	ip, _ := netip.ParseAddr(hostOnly(conn.RemoteAddr()))
+	reason, message := user.Access.Check(time.Now(), ip)
+	if reason == "" {
+		return nil
+	}
+	log.Printf("Denied login for user %s from %s: %s", user.Username, conn.RemoteAddr(), message)
+	metrics.PolicyDenials.WithLabelValues(reason).Inc()
+	s.notifier.Load().Notify(notify.Event{
+		Type:     notify.EventPolicyDenied,
+		Username: user.Username,
+		ClientIP: hostOnly(conn.RemoteAddr()),
+		Message:  "login denied: " + message,
+		Details:  map[string]string{"reason": reason},
+	})
+	return fmt.Errorf("access denied: %s", message)
+}
+
+// checkBanned rejects an authentication attempt from a banned address or
+// for a banned username without looking at the credentials
+func (s *Server) checkBanned(conn ssh.ConnMetadata) error {
+	if !s.currentConfig().Security.Lockout.Enabled {
+		return nil
+	}
+	ban, ok := s.lockout.banned(hostOnly(conn.RemoteAddr()), conn.User())
+	if !ok {
+		return nil
+	}
+	log.Printf("Rejected login for user %s from %s: %s %s is banned until %s",
+		conn.User(), conn.RemoteAddr(), ban.Kind, ban.Value, ban.Expires.Format(time.RFC3339))
+	metrics.PolicyDenials.WithLabelValues("banned").Inc()
+	return errBanned
+}
+
+// recordLoginFailure counts a failed login towards the lockout limits and
+// returns how long the response should be delayed
+func (s *Server) recordLoginFailure(addr net.Addr, username string) time.Duration {
+	cfg := s.currentConfig()
+	if !cfg.Security.Lockout.Enabled {
+		return 0
+	}
+	clientIP := hostOnly(addr)
+	delay, bans := s.lockout.fail(cfg, clientIP, username)
+
+	for _, ban := range bans {
+		log.Printf("Banned %s %s until %s after %d failed logins",
+			ban.Kind, ban.Value, ban.Expires.Format(time.RFC3339), ban.Failures)
+		metrics.Bans.WithLabelValues(ban.Kind).Inc()
+		s.notifier.Load().Notify(notify.Event{
+			Type:     notify.EventPolicyDenied,
+			Username: username,
+			ClientIP: clientIP,
+			Message:  fmt.Sprintf("%s %s banned after %d failed logins", ban.Kind, ban.Value, ban.Failures),
+			Details: map[string]string{
+				"kind":    ban.Kind,
+				"value":   ban.Value,
+				"expires": ban.Expires.Format(time.RFC3339),
+			},
+		})
+	}
+	return delay
+}
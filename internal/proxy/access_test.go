@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+func TestAdmitSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		allow  []string
+		deny   []string
+		ip     string
+		reason string
+	}{
+		{name: "no lists", ip: "203.0.113.5"},
+		{name: "allowed", allow: []string{"10.0.0.0/8"}, ip: "10.1.2.3"},
+		{name: "not allowed", allow: []string{"10.0.0.0/8"}, ip: "203.0.113.5", reason: "source_not_allowed"},
+		{name: "denied", deny: []string{"203.0.113.0/24"}, ip: "203.0.113.5", reason: "source_denied"},
+		{name: "deny wins over allow", allow: []string{"10.0.0.0/8"}, deny: []string{"10.66.0.0/16"}, ip: "10.66.0.1", reason: "source_denied"},
+		{name: "single address", deny: []string{"203.0.113.5"}, ip: "203.0.113.5", reason: "source_denied"},
+		{name: "mapped ipv4 address", allow: []string{"10.0.0.0/8"}, ip: "::ffff:10.1.2.3"},
+		{name: "ipv6", allow: []string{"2001:db8::/32"}, ip: "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Security.AllowCIDRs = tt.allow
+			cfg.Security.DenyCIDRs = tt.deny
+			s := &Server{}
+			addr := &net.TCPAddr{IP: net.ParseIP(tt.ip), Port: 40000}
+			reason, ok := s.admitSource(cfg, addr)
+			if reason != tt.reason || ok != (tt.reason == "") {
+				t.Errorf("admitSource(%s) = %q, %v, want %q", tt.ip, reason, ok, tt.reason)
+			}
+		})
+	}
+}
+
+func TestAdmitSourceBanned(t *testing.T) {
+	cfg := lockoutConfig(1, 0)
+	cfg.Security.Lockout.Enabled = true
+	l, err := newLockout("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{lockout: l}
+	l.fail(cfg, "10.0.0.1", "alice")
+
+	if reason, ok := s.admitSource(cfg, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000}); ok || reason != "banned" {
+		t.Errorf("admitSource() of a banned address = %q, %v", reason, ok)
+	}
+	if _, ok := s.admitSource(cfg, &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 40000}); !ok {
+		t.Error("admitSource() rejected an address that is not banned")
+	}
+}
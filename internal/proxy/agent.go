@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/devashar13/ssh-proxy/internal/notify"
+)
+
+const (
+	agentRequestType = "auth-agent-req@openssh.com"
+	agentChannelType = "auth-agent@openssh.com"
+
+	// SSH_AGENTC_SIGN_REQUEST from the agent protocol
+	agentSignRequest = 13
+	// agent messages are small; anything larger is not parsed
+	maxAgentMessage = 256 * 1024
+)
+
+// handleAgentRequest decides whether a client's agent forwarding request
+// is passed to the upstream
+func (s *Session) handleAgentRequest() bool {
+	user := s.config.FindUser(s.username)
+	if user == nil || !user.ForwardAgent {
+		log.Printf("Refused agent forwarding for user %s: not enabled for the user", s.username)
+		return false
+	}
+
+	s.mu.Lock()
+	started := s.forwardAgent
+	s.forwardAgent = true
+	s.mu.Unlock()
+	if !started {
+		// each session has its own upstream connection
+		if chans := s.upstreamConn.HandleChannelOpen(agentChannelType); chans != nil {
+			go s.relayAgentChannels(chans)
+		}
+		fmt.Fprintf(s.logFile, "\n# agent forwarding enabled\n")
+	}
+	return true
+}
+
+// relayAgentChannels connects every agent channel the upstream opens to the
+// client's agent
+func (s *Session) relayAgentChannels(chans <-chan ssh.NewChannel) {
+	for newChannel := range chans {
+		go s.relayAgent(newChannel)
+	}
+}
+
+func (s *Session) relayAgent(newChannel ssh.NewChannel) {
+	clientAgent, clientReqs, err := s.conn.sshConn.OpenChannel(agentChannelType, nil)
+	if err != nil {
+		log.Printf("Failed to open agent channel to user %s: %v", s.username, err)
+		newChannel.Reject(ssh.ConnectionFailed, "agent not available")
+		return
+	}
+	defer clientAgent.Close()
+	go ssh.DiscardRequests(clientReqs)
+
+	upstreamAgent, upstreamReqs, err := newChannel.Accept()
+	if err != nil {
+		log.Printf("Failed to accept agent channel from upstream: %v", err)
+		return
+	}
+	defer upstreamAgent.Close()
+	go ssh.DiscardRequests(upstreamReqs)
+
+	relayChannel(upstreamAgent, clientAgent, &agentAuditor{s: s})
+}
+
+// relayChannel copies a channel opened by the upstream to the one opened
+// for it on the client until both directions are done. What the upstream
+// sends is also written to audit, if set.
+func relayChannel(upstream, client ssh.Channel, audit io.Writer) {
+	var fromUpstream io.Reader = upstream
+	if audit != nil {
+		fromUpstream = io.TeeReader(upstream, audit)
+	}
+	done := make(chan struct{})
+	go func() {
+		io.Copy(client, fromUpstream)
+		client.CloseWrite()
+		close(done)
+	}()
+	io.Copy(upstream, client)
+	upstream.CloseWrite()
+	<-done
+}
+
+// agentAuditor reads the agent protocol messages sent by the upstream and
+// records every signing request with the fingerprint of the key
+type agentAuditor struct {
+	s   *Session
+	buf []byte
+	// set once the stream stops looking like agent messages
+	lost bool
+}
+
+func (a *agentAuditor) Write(p []byte) (int, error) {
+	if a.lost {
+		return len(p), nil
+	}
+	a.buf = append(a.buf, p...)
+	for len(a.buf) >= 4 {
+		size := binary.BigEndian.Uint32(a.buf)
+		if size == 0 || size > maxAgentMessage {
+			log.Printf("Unexpected agent message of %d bytes from upstream, no longer auditing this channel", size)
+			a.lost = true
+			a.buf = nil
+			break
+		}
+		if len(a.buf) < 4+int(size) {
+			break
+		}
+		a.message(a.buf[4 : 4+size])
+		a.buf = a.buf[4+size:]
+	}
+	return len(p), nil
+}
+
+func (a *agentAuditor) message(msg []byte) {
+	if msg[0] != agentSignRequest {
+		return
+	}
+	var req struct {
+		KeyBlob []byte
+		Data    []byte
+		Flags   uint32
+	}
+	if err := ssh.Unmarshal(msg[1:], &req); err != nil {
+		log.Printf("Failed to parse agent sign request: %v", err)
+		return
+	}
+	keyType, fingerprint := "unknown", "unknown"
+	if key, err := ssh.ParsePublicKey(req.KeyBlob); err == nil {
+		keyType, fingerprint = key.Type(), ssh.FingerprintSHA256(key)
+	}
+
+	s := a.s
+	log.Printf("Agent sign request from upstream for user %s with %s key %s", s.username, keyType, fingerprint)
+	fmt.Fprintf(s.logFile, "\n# agent: sign request with %s key %s\n", keyType, fingerprint)
+	s.notifier.Audit(notify.Event{
+		Type:     notify.EventAgentSign,
+		Username: s.username,
+		ClientIP: s.clientIP,
+		Message:  "upstream asked the forwarded agent to sign with " + fingerprint,
+		Details: map[string]string{
+			"session":     s.id,
+			"target":      s.target,
+			"key_type":    keyType,
+			"fingerprint": fingerprint,
+		},
+	})
+}
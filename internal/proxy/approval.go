@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/metrics"
+	"github.com/devashar13/ssh-proxy/internal/notify"
+)
+
+// ApprovalRequest is a session held until an approver accepts or rejects it
+type ApprovalRequest struct {
+	ID           string    `json:"id"`
+	ConnectionID string    `json:"connection_id"`
+	Username     string    `json:"username"`
+	ClientIP     string    `json:"client_ip"`
+	Target       string    `json:"target"`
+	Requested    time.Time `json:"requested"`
+	Expires      time.Time `json:"expires"`
+
+	decision chan approvalDecision
+}
+
+type approvalDecision struct {
+	approved bool
+	approver string
+	reason   string
+}
+
+var (
+	ErrApprovalNotFound = errors.New("approval request not found")
+	ErrSelfApproval     = errors.New("users cannot approve their own sessions")
+)
+
+// approvals holds the sessions waiting for an approver
+type approvals struct {
+	mu      sync.Mutex
+	pending map[string]*ApprovalRequest
+}
+
+func newApprovals() *approvals {
+	return &approvals{pending: make(map[string]*ApprovalRequest)}
+}
+
+// await blocks until the session is approved, rejected, timed out or the
+// client goes away. Progress is shown to the client and recorded in the
+// session log; the approver's name is returned on approval.
+func (a *approvals) await(cfg *config.Config, conn *Connection, target string, client io.Writer, logFile io.Writer, notifier *notify.Notifier) (string, error) {
+	now := time.Now()
+	req := &ApprovalRequest{
+		ID:           newID(),
+		ConnectionID: conn.id,
+		Username:     conn.username,
+		ClientIP:     conn.clientIP,
+		Target:       target,
+		Requested:    now,
+		Expires:      now.Add(cfg.Approval.Timeout),
+		decision:     make(chan approvalDecision, 1),
+	}
+	a.mu.Lock()
+	a.pending[req.ID] = req
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.pending, req.ID)
+		a.mu.Unlock()
+	}()
+
+	log.Printf("Session for user %s from %s is waiting for approval (request %s)", req.Username, req.ClientIP, req.ID)
+	fmt.Fprintf(logFile, "# approval requested: %s at %s\n", req.ID, now.Format(time.RFC3339))
+	fmt.Fprintf(client, "*** %s (request %s) ***\r\n", cfg.Approval.Message, req.ID)
+	notifier.Notify(notify.Event{
+		Type:     notify.EventApprovalRequested,
+		Username: req.Username,
+		ClientIP: req.ClientIP,
+		Message:  fmt.Sprintf("approval requested for a session to %s", target),
+		Details: map[string]string{
+			"request_id": req.ID,
+			"target":     target,
+			"expires":    req.Expires.Format(time.RFC3339),
+		},
+	})
+
+	timer := time.NewTimer(cfg.Approval.Timeout)
+	defer timer.Stop()
+
+	var d approvalDecision
+	select {
+	case d = <-req.decision:
+	case <-timer.C:
+		d = approvalDecision{reason: fmt.Sprintf("no approval within %s", cfg.Approval.Timeout)}
+	case <-conn.closed:
+		fmt.Fprintf(logFile, "# approval abandoned: client disconnected\n")
+		return "", fmt.Errorf("client disconnected while waiting for approval")
+	}
+
+	if d.approved {
+		log.Printf("Session for user %s from %s approved by %s (request %s)", req.Username, req.ClientIP, d.approver, req.ID)
+		fmt.Fprintf(logFile, "# approved by %s at %s\n", d.approver, time.Now().Format(time.RFC3339))
+		fmt.Fprintf(client, "*** Approved by %s. ***\r\n", d.approver)
+		return d.approver, nil
+	}
+
+	log.Printf("Session for user %s from %s was not approved (request %s): %s", req.Username, req.ClientIP, req.ID, d.reason)
+	if d.approver != "" {
+		fmt.Fprintf(logFile, "# rejected by %s at %s: %s\n", d.approver, time.Now().Format(time.RFC3339), d.reason)
+		metrics.PolicyDenials.WithLabelValues("approval_rejected").Inc()
+	} else {
+		fmt.Fprintf(logFile, "# not approved at %s: %s\n", time.Now().Format(time.RFC3339), d.reason)
+		metrics.PolicyDenials.WithLabelValues("approval_timeout").Inc()
+	}
+	return "", fmt.Errorf("session not approved: %s", d.reason)
+}
+
+// decide delivers a decision to a pending request. Nobody may approve a
+// session of their own.
+func (a *approvals) decide(id string, d approvalDecision) error {
+	a.mu.Lock()
+	req, ok := a.pending[id]
+	if !ok {
+		a.mu.Unlock()
+		return ErrApprovalNotFound
+	}
+	if d.approved && d.approver == req.Username {
+		a.mu.Unlock()
+		log.Printf("Refused self-approval of request %s by %s", id, d.approver)
+		return ErrSelfApproval
+	}
+	delete(a.pending, id)
+	a.mu.Unlock()
+	req.decision <- d
+	return nil
+}
+
+// rejectAll turns away every pending request, e.g. on shutdown
+func (a *approvals) rejectAll(reason string) {
+	a.mu.Lock()
+	reqs := make([]*ApprovalRequest, 0, len(a.pending))
+	for id, req := range a.pending {
+		reqs = append(reqs, req)
+		delete(a.pending, id)
+	}
+	a.mu.Unlock()
+	for _, req := range reqs {
+		req.decision <- approvalDecision{reason: reason}
+	}
+}
+
+func (a *approvals) list() []ApprovalRequest {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	reqs := make([]ApprovalRequest, 0, len(a.pending))
+	for _, req := range a.pending {
+		reqs = append(reqs, *req)
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Requested.Before(reqs[j].Requested) })
+	return reqs
+}
+
+// PendingApprovals lists the sessions waiting for approval, oldest first
+func (s *Server) PendingApprovals() []ApprovalRequest {
+	return s.approvals.list()
+}
+
+// Approve lets a pending session through
+func (s *Server) Approve(id, approver string) error {
+	return s.approvals.decide(id, approvalDecision{approved: true, approver: approver})
+}
+
+// Reject turns a pending session away
+func (s *Server) Reject(id, approver, reason string) error {
+	if reason == "" {
+		reason = "rejected by " + approver
+	}
+	return s.approvals.decide(id, approvalDecision{approver: approver, reason: reason})
+}
@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+type approvalResult struct {
+	approver string
+	err      error
+}
+
+// startApproval runs await in the background and returns once the request
+// is pending
+func startApproval(t *testing.T, a *approvals, timeout time.Duration) (*Connection, *bytes.Buffer, <-chan approvalResult) {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Approval.Timeout = timeout
+	cfg.Approval.Message = "waiting"
+	conn := &Connection{id: "conn1", username: "bob", clientIP: "10.0.0.1", closed: make(chan struct{})}
+	logFile := &bytes.Buffer{}
+
+	done := make(chan approvalResult, 1)
+	go func() {
+		approver, err := a.await(cfg, conn, "upstream:22", io.Discard, logFile, nil)
+		done <- approvalResult{approver, err}
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for len(a.list()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("approval request never became pending")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return conn, logFile, done
+}
+
+func TestApprovalFlow(t *testing.T) {
+	tests := []struct {
+		name      string
+		timeout   time.Duration
+		act       func(a *approvals, conn *Connection, id string) error
+		actErr    error
+		approver  string
+		wantErr   string
+		wantInLog string
+	}{
+		{
+			name:    "approved by another user",
+			timeout: time.Minute,
+			act: func(a *approvals, conn *Connection, id string) error {
+				return a.decide(id, approvalDecision{approved: true, approver: "alice"})
+			},
+			approver:  "alice",
+			wantInLog: "# approved by alice",
+		},
+		{
+			name:    "rejected",
+			timeout: time.Minute,
+			act: func(a *approvals, conn *Connection, id string) error {
+				return a.decide(id, approvalDecision{approver: "alice", reason: "not today"})
+			},
+			wantErr:   "not today",
+			wantInLog: "# rejected by alice",
+		},
+		{
+			name:    "self-approval refused until timeout",
+			timeout: 50 * time.Millisecond,
+			act: func(a *approvals, conn *Connection, id string) error {
+				return a.decide(id, approvalDecision{approved: true, approver: "bob"})
+			},
+			actErr:    ErrSelfApproval,
+			wantErr:   "no approval within",
+			wantInLog: "# not approved",
+		},
+		{
+			name:    "self-rejection allowed",
+			timeout: time.Minute,
+			act: func(a *approvals, conn *Connection, id string) error {
+				return a.decide(id, approvalDecision{approver: "bob", reason: "changed my mind"})
+			},
+			wantErr: "changed my mind",
+		},
+		{
+			name:    "unknown request",
+			timeout: 50 * time.Millisecond,
+			act: func(a *approvals, conn *Connection, id string) error {
+				return a.decide("nope", approvalDecision{approved: true, approver: "alice"})
+			},
+			actErr:  ErrApprovalNotFound,
+			wantErr: "no approval within",
+		},
+		{
+			name:    "rejected on shutdown",
+			timeout: time.Minute,
+			act: func(a *approvals, conn *Connection, id string) error {
+				a.rejectAll("proxy shutting down")
+				return nil
+			},
+			wantErr: "proxy shutting down",
+		},
+		{
+			name:    "client disconnects",
+			timeout: time.Minute,
+			act: func(a *approvals, conn *Connection, id string) error {
+				close(conn.closed)
+				return nil
+			},
+			wantErr:   "client disconnected",
+			wantInLog: "# approval abandoned",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newApprovals()
+			conn, logFile, done := startApproval(t, a, tt.timeout)
+			id := a.list()[0].ID
+
+			if err := tt.act(a, conn, id); !errors.Is(err, tt.actErr) {
+				t.Fatalf("decision error = %v, want %v", err, tt.actErr)
+			}
+
+			var res approvalResult
+			select {
+			case res = <-done:
+			case <-time.After(2 * time.Second):
+				t.Fatal("await did not return")
+			}
+			if tt.wantErr == "" {
+				if res.err != nil || res.approver != tt.approver {
+					t.Fatalf("await() = %q, %v, want %q", res.approver, res.err, tt.approver)
+				}
+			} else if res.err == nil || !strings.Contains(res.err.Error(), tt.wantErr) {
+				t.Fatalf("await() error = %v, want %q", res.err, tt.wantErr)
+			}
+			if !strings.Contains(logFile.String(), tt.wantInLog) {
+				t.Errorf("session log = %q, want %q", logFile.String(), tt.wantInLog)
+			}
+			if pending := a.list(); len(pending) != 0 {
+				t.Errorf("requests still pending: %+v", pending)
+			}
+		})
+	}
+}
+
+func TestApprovalDecidedOnce(t *testing.T) {
+	a := newApprovals()
+	_, _, done := startApproval(t, a, time.Minute)
+	id := a.list()[0].ID
+
+	if err := a.decide(id, approvalDecision{approved: true, approver: "alice"}); err != nil {
+		t.Fatalf("decide() error = %v", err)
+	}
+	if err := a.decide(id, approvalDecision{approver: "carol", reason: "too late"}); !errors.Is(err, ErrApprovalNotFound) {
+		t.Errorf("second decide() error = %v, want %v", err, ErrApprovalNotFound)
+	}
+	if res := <-done; res.err != nil || res.approver != "alice" {
+		t.Errorf("await() = %q, %v, want alice", res.approver, res.err)
+	}
+}
@@ -3,13 +3,18 @@ package proxy
 import (
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 
 	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/metrics"
 )
 
+// how long connecting and authenticating to the upstream may take
+const upstreamDialTimeout = 15 * time.Second
 
 type UpstreamClient struct {
 	config *config.Config
@@ -31,15 +36,36 @@ func (c *UpstreamClient) Connect() error {
 		return fmt.Errorf("failed to create client config: %w", err)
 	}
 	addr := fmt.Sprintf("%s:%d", c.config.Upstream.Host, c.config.Upstream.Port)
-	client, err := ssh.Dial("tcp", addr, clientConfig)
+	dialStart := time.Now()
+	client, err := dialUpstream(addr, clientConfig)
 	if err != nil {
+		metrics.UpstreamDialFailures.Inc()
 		return fmt.Errorf("failed to connect to upstream server: %w", err)
 	}
+	metrics.UpstreamDialDuration.Observe(time.Since(dialStart).Seconds())
 	c.client = client
 	log.Printf("Connected to upstream server %s", addr)
 	return nil
 }
 
+// dialUpstream is ssh.Dial with the connection and the handshake bounded by
+// upstreamDialTimeout, so an unresponsive upstream cannot hold a session
+// (or shutdown) indefinitely
+func dialUpstream(addr string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, upstreamDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(upstreamDialTimeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
 func (c *UpstreamClient) Close() error {
 	if c.client != nil {
 		return c.client.Close()
@@ -0,0 +1,102 @@
+package proxy
+
+import "unicode/utf8"
+
+// commandTracker rebuilds command lines from raw client keystrokes so they
+// can be analysed while the session is still running
+type commandTracker struct {
+	line      []byte
+	state     int
+	onCommand func(string)
+	// bytes typed past maxCommandLine, which are not kept
+	dropped int
+}
+
+// maxCommandLine bounds a command line, so a client that never sends a
+// newline cannot grow it without limit
+const maxCommandLine = 4096
+
+// truncatedMarker is appended to command lines cut at maxCommandLine
+const truncatedMarker = " [truncated]"
+
+const (
+	trackText = iota
+	trackEscape
+	trackCSI
+	trackSS3
+)
+
+func newCommandTracker(onCommand func(string)) *commandTracker {
+	return &commandTracker{onCommand: onCommand}
+}
+
+func (t *commandTracker) Write(p []byte) (int, error) {
+	for _, b := range p {
+		switch t.state {
+		case trackEscape:
+			switch b {
+			case '[':
+				t.state = trackCSI
+			case 'O':
+				t.state = trackSS3
+			default:
+				t.state = trackText
+			}
+			continue
+		case trackCSI:
+			// parameters until the final byte
+			if b >= 0x40 && b <= 0x7E {
+				t.state = trackText
+			}
+			continue
+		case trackSS3:
+			t.state = trackText
+			continue
+		}
+
+		switch {
+		case b == 0x1B:
+			t.state = trackEscape
+		case b == '\r' || b == '\n':
+			if len(t.line) > 0 {
+				command := string(t.line)
+				if t.dropped > 0 {
+					command += truncatedMarker
+				}
+				t.onCommand(command)
+				t.line = t.line[:0]
+				t.dropped = 0
+			}
+		case b == 0x08 || b == 0x7F:
+			if t.dropped > 0 {
+				t.dropped--
+			} else if len(t.line) > 0 {
+				t.line = t.line[:len(t.line)-1]
+			}
+		case b == 0x03 || b == 0x15:
+			// ctrl-c and ctrl-u discard the line being typed
+			t.line = t.line[:0]
+			t.dropped = 0
+		case b >= 32 || b == '\t':
+			if len(t.line) < maxCommandLine {
+				t.line = append(t.line, b)
+			} else {
+				t.dropped++
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// truncateCommand cuts a command longer than maxCommandLine at a character
+// boundary and marks it as cut
+func truncateCommand(command string) string {
+	if len(command) <= maxCommandLine {
+		return command
+	}
+	cut := maxCommandLine
+	for cut > 0 && !utf8.RuneStart(command[cut]) {
+		cut--
+	}
+	return command[:cut] + truncatedMarker
+}
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommandTracker(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"plain line", "ls -la\r", []string{"ls -la"}},
+		{"newline ends a line", "whoami\n", []string{"whoami"}},
+		{"several lines in one write", "id\rpwd\r", []string{"id", "pwd"}},
+		{"empty lines are skipped", "\r\r\n", nil},
+		{"unfinished line", "rm -rf", nil},
+		{"tab is kept", "ls\t/tmp\r", []string{"ls\t/tmp"}},
+		{"backspace", "lss\b -l\r", []string{"ls -l"}},
+		{"delete", "cat\x7f\x7ft /etc/passwd\r", []string{"ct /etc/passwd"}},
+		{"backspace on empty line", "\x7f\x7fid\r", []string{"id"}},
+		{"ctrl-c discards the line", "rm -rf /\x03ls\r", []string{"ls"}},
+		{"ctrl-u discards the line", "sudo su\x15exit\r", []string{"exit"}},
+		{"other control bytes are dropped", "l\x01s\x04\r", []string{"ls"}},
+		{"arrow keys", "\x1b[Auptime\x1b[D\x1b[C\r", []string{"uptime"}},
+		{"csi with parameters", "\x1b[1;5Dls\x1b[200~\r", []string{"ls"}},
+		{"ss3 keys", "\x1bOAid\x1bOH\r", []string{"id"}},
+		{"alt key", "\x1bbls\r", []string{"ls"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			tracker := newCommandTracker(func(command string) { got = append(got, command) })
+			if n, err := tracker.Write([]byte(tt.input)); n != len(tt.input) || err != nil {
+				t.Fatalf("Write() = %d, %v", n, err)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("commands = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandTrackerSplitWrites(t *testing.T) {
+	var got []string
+	tracker := newCommandTracker(func(command string) { got = append(got, command) })
+	// escape sequences and lines may be split across reads
+	for _, chunk := range []string{"ec", "ho hi\x1b", "[", "1;5", "D\x1bO", "A", "\r"} {
+		tracker.Write([]byte(chunk))
+	}
+	if len(got) != 1 || got[0] != "echo hi" {
+		t.Errorf("commands = %q, want [echo hi]", got)
+	}
+}
+
+func TestCommandTrackerLineCap(t *testing.T) {
+	long := strings.Repeat("a", maxCommandLine)
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"at the cap", long + "\r", long},
+		{"past the cap", long + "bbbb\r", long + truncatedMarker},
+		{"backspace over dropped bytes", long + "bb\b\b\r", long},
+		{"backspace below the cap", long + "b\b\b\bcc\r", long[:maxCommandLine-2] + "cc"},
+		{"ctrl-u resets", long + "bbbb\x15id\r", "id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			tracker := newCommandTracker(func(command string) { got = append(got, command) })
+			tracker.Write([]byte(tt.input))
+			if len(got) != 1 || got[0] != tt.want {
+				t.Fatalf("commands = %d lines, want one of %d bytes", len(got), len(tt.want))
+			}
+			if cap(tracker.line) > maxCommandLine*2 {
+				t.Errorf("line buffer grew to %d bytes", cap(tracker.line))
+			}
+		})
+	}
+}
+
+func TestTruncateCommand(t *testing.T) {
+	long := strings.Repeat("a", maxCommandLine)
+	tests := []struct {
+		name    string
+		command string
+		want    string
+	}{
+		{"short", "ls -la", "ls -la"},
+		{"at the limit", long, long},
+		{"past the limit", long + "bbb", long + truncatedMarker},
+		{"cut inside a character", long[:maxCommandLine-1] + "é", long[:maxCommandLine-1] + truncatedMarker},
+		{"already truncated", long + truncatedMarker, long + truncatedMarker},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateCommand(tt.command); got != tt.want {
+				t.Errorf("truncateCommand() = %d bytes, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/metrics"
+)
+
+// activityReader records when the client last sent any input
+type activityReader struct {
+	r    io.Reader
+	last *atomic.Int64
+}
+
+func (ar *activityReader) Read(p []byte) (int, error) {
+	n, err := ar.r.Read(p)
+	if n > 0 {
+		ar.last.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// enforceLimits closes the session once it has been idle or open for
+// longer than the configured limits, or once the user's access window
+// closes, warning the user shortly before
+func (s *Session) enforceLimits(done <-chan struct{}) {
+	idle, max := s.config.SessionLimits(s.username)
+	var rules *config.AccessRules
+	if user := s.config.FindUser(s.username); user != nil && user.Access.TerminateOutsideWindow {
+		rules = &user.Access
+	}
+	if idle <= 0 && max <= 0 && rules == nil {
+		return
+	}
+	warning := s.config.Session.WarningPeriod
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var idleWarned, maxWarned, windowWarned bool
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			if rules != nil {
+				if rules.Expired(now) || !rules.InWindow(now) {
+					metrics.PolicyDenials.WithLabelValues("outside_access_window").Inc()
+					s.Terminate("Your access window has closed.")
+					return
+				}
+				later := now.Add(warning)
+				if !windowWarned && (rules.Expired(later) || !rules.InWindow(later)) {
+					s.notifyClient(fmt.Sprintf("Your access window closes within %s; this session will then be closed.", warning))
+					windowWarned = true
+				}
+			}
+
+			if max > 0 {
+				remaining := max - now.Sub(s.started)
+				if remaining <= 0 {
+					s.Terminate(fmt.Sprintf("Maximum session duration of %s reached.", max))
+					return
+				}
+				if !maxWarned && remaining <= warning {
+					s.notifyClient(fmt.Sprintf("This session will be closed in %s (maximum session duration of %s).", remaining.Round(time.Second), max))
+					maxWarned = true
+				}
+			}
+
+			if idle > 0 {
+				remaining := idle - now.Sub(time.Unix(0, s.lastInput.Load()))
+				if remaining <= 0 {
+					s.Terminate(fmt.Sprintf("Idle timeout of %s reached.", idle))
+					return
+				}
+				if remaining > warning {
+					idleWarned = false
+				} else if !idleWarned {
+					s.notifyClient(fmt.Sprintf("This session has been idle and will be closed in %s unless there is input.", remaining.Round(time.Second)))
+					idleWarned = true
+				}
+			}
+		}
+	}
+}
+
+// connCounter tracks open client connections, authenticated or not
+type connCounter struct {
+	mu    sync.Mutex
+	total int
+	perIP map[string]int
+}
+
+func newConnCounter() *connCounter {
+	return &connCounter{perIP: make(map[string]int)}
+}
+
+// acquire reserves a connection slot for clientIP, or returns the reason
+// and a message for the client if a limit has been reached
+func (c *connCounter) acquire(cfg *config.Config, clientIP string) (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if max := cfg.Limits.MaxConnections; max > 0 && c.total >= max {
+		return "max_connections", "The SSH proxy has reached its connection limit. Please try again later."
+	}
+	if max := cfg.Limits.MaxConnectionsPerIP; max > 0 && c.perIP[clientIP] >= max {
+		return "max_connections_per_ip", fmt.Sprintf("Too many connections from %s (limit %d).", clientIP, max)
+	}
+	c.total++
+	c.perIP[clientIP]++
+	return "", ""
+}
+
+func (c *connCounter) release(clientIP string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.total--
+	if c.perIP[clientIP]--; c.perIP[clientIP] <= 0 {
+		delete(c.perIP, clientIP)
+	}
+}
+
+// sessionCounter tracks the session channels of each user from the moment
+// they are admitted, so that sessions still waiting for approval or for the
+// upstream count against the limit too
+type sessionCounter struct {
+	mu      sync.Mutex
+	perUser map[string]int
+}
+
+func newSessionCounter() *sessionCounter {
+	return &sessionCounter{perUser: make(map[string]int)}
+}
+
+// acquire reserves a session slot for username unless it already has max
+// (0 for no limit)
+func (c *sessionCounter) acquire(username string, max int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if max > 0 && c.perUser[username] >= max {
+		return false
+	}
+	c.perUser[username]++
+	return true
+}
+
+func (c *sessionCounter) release(username string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.perUser[username]--; c.perUser[username] <= 0 {
+		delete(c.perUser, username)
+	}
+}
+
+// admitChannel checks a new session channel against the per-connection and
+// per-user limits, returning the reason and a message for the client if it
+// must be rejected. An admitted channel holds a session slot of the user
+// until it is released.
+func (s *Server) admitChannel(cfg *config.Config, c *Connection) (string, string) {
+	if max := cfg.Limits.MaxChannelsPerConnection; max > 0 && int(c.channels.Load()) >= max {
+		return "max_channels_per_connection", fmt.Sprintf("too many open channels on this connection (limit %d)", max)
+	}
+	if max := cfg.Limits.MaxSessionsPerUser; !s.sessions.acquire(c.username, max) {
+		return "max_sessions_per_user", fmt.Sprintf("too many open sessions for user %s (limit %d)", c.username, max)
+	}
+	return "", ""
+}
@@ -0,0 +1,220 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+func TestEnforceLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(cfg *config.Config)
+		started    time.Duration
+		idle       time.Duration
+		message    string
+		terminated bool
+	}{
+		{
+			name:       "maximum duration reached",
+			setup:      func(cfg *config.Config) { cfg.Session.MaxDuration = time.Hour },
+			started:    time.Hour,
+			message:    "Maximum session duration of 1h0m0s reached.",
+			terminated: true,
+		},
+		{
+			name:    "maximum duration warning",
+			setup:   func(cfg *config.Config) { cfg.Session.MaxDuration = time.Hour },
+			started: 59*time.Minute + 30*time.Second,
+			message: "(maximum session duration of 1h0m0s).",
+		},
+		{
+			name:       "idle timeout reached",
+			setup:      func(cfg *config.Config) { cfg.Session.IdleTimeout = 5 * time.Minute },
+			started:    time.Hour,
+			idle:       5 * time.Minute,
+			message:    "Idle timeout of 5m0s reached.",
+			terminated: true,
+		},
+		{
+			name:    "idle warning",
+			setup:   func(cfg *config.Config) { cfg.Session.IdleTimeout = 5 * time.Minute },
+			started: time.Hour,
+			idle:    4*time.Minute + 30*time.Second,
+			message: "This session has been idle and will be closed in",
+		},
+		{
+			name: "user override",
+			setup: func(cfg *config.Config) {
+				cfg.Session.IdleTimeout = time.Hour
+				cfg.Users = []config.User{{Username: "alice", IdleTimeout: time.Minute}}
+			},
+			started:    time.Hour,
+			idle:       time.Minute,
+			message:    "Idle timeout of 1m0s reached.",
+			terminated: true,
+		},
+		{
+			name: "access window closed",
+			setup: func(cfg *config.Config) {
+				user := config.User{Username: "alice"}
+				user.Access.Expires = time.Now().Add(-time.Minute)
+				user.Access.TerminateOutsideWindow = true
+				cfg.Users = []config.User{user}
+			},
+			message:    "Your access window has closed.",
+			terminated: true,
+		},
+		{
+			name: "access window closing",
+			setup: func(cfg *config.Config) {
+				user := config.User{Username: "alice"}
+				user.Access.Expires = time.Now().Add(30 * time.Second)
+				user.Access.TerminateOutsideWindow = true
+				cfg.Users = []config.User{user}
+			},
+			message: "Your access window closes within 1m0s; this session will then be closed.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := &config.Config{}
+			cfg.Session.WarningPeriod = time.Minute
+			tt.setup(cfg)
+			s, client := newTestSession(t, cfg)
+			s.started = time.Now().Add(-tt.started)
+			s.lastInput.Store(time.Now().Add(-tt.idle).UnixNano())
+
+			done := make(chan struct{})
+			returned := make(chan struct{})
+			go func() {
+				s.enforceLimits(done)
+				close(returned)
+			}()
+
+			deadline := time.Now().Add(3 * time.Second)
+			for {
+				if _, stderr := client.output(); stderr != "" || time.Now().After(deadline) {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			close(done)
+			<-returned
+
+			_, stderr := client.output()
+			if !strings.Contains(stderr, tt.message) {
+				t.Errorf("client was told %q, want %q", stderr, tt.message)
+			}
+			if client.isClosed() != tt.terminated {
+				t.Errorf("terminated = %v, want %v", client.isClosed(), tt.terminated)
+			}
+		})
+	}
+}
+
+func TestEnforceLimitsWithoutLimits(t *testing.T) {
+	s, _ := newTestSession(t, &config.Config{})
+	returned := make(chan struct{})
+	go func() {
+		s.enforceLimits(make(chan struct{}))
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("enforceLimits() kept running without any limits")
+	}
+}
+
+func TestConnCounter(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Limits.MaxConnections = 3
+	cfg.Limits.MaxConnectionsPerIP = 2
+	c := newConnCounter()
+
+	steps := []struct {
+		ip   string
+		want string
+	}{
+		{"10.0.0.1", ""},
+		{"10.0.0.1", ""},
+		{"10.0.0.1", "max_connections_per_ip"},
+		{"10.0.0.2", ""},
+		{"10.0.0.3", "max_connections"},
+	}
+	for i, step := range steps {
+		if reason, _ := c.acquire(cfg, step.ip); reason != step.want {
+			t.Fatalf("step %d: acquire(%s) = %q, want %q", i, step.ip, reason, step.want)
+		}
+	}
+
+	c.release("10.0.0.1")
+	if reason, _ := c.acquire(cfg, "10.0.0.3"); reason != "" {
+		t.Errorf("acquire() after release = %q", reason)
+	}
+	c.release("10.0.0.3")
+	c.release("10.0.0.2")
+	c.release("10.0.0.1")
+	if c.total != 0 || len(c.perIP) != 0 {
+		t.Errorf("after releasing everything total = %d, perIP = %v", c.total, c.perIP)
+	}
+}
+
+func TestSessionCounter(t *testing.T) {
+	c := newSessionCounter()
+	if !c.acquire("alice", 2) || !c.acquire("alice", 2) {
+		t.Fatal("acquire() below the limit failed")
+	}
+	if c.acquire("alice", 2) {
+		t.Error("acquire() above the limit succeeded")
+	}
+	if !c.acquire("bob", 2) {
+		t.Error("acquire() for another user failed")
+	}
+	if !c.acquire("carol", 0) || !c.acquire("carol", 0) || !c.acquire("carol", 0) {
+		t.Error("acquire() without a limit failed")
+	}
+	c.release("alice")
+	if !c.acquire("alice", 2) {
+		t.Error("acquire() after release failed")
+	}
+	for _, user := range []string{"alice", "alice", "bob", "carol", "carol", "carol"} {
+		c.release(user)
+	}
+	if len(c.perUser) != 0 {
+		t.Errorf("after releasing everything perUser = %v", c.perUser)
+	}
+}
+
+func TestAdmitChannel(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Limits.MaxChannelsPerConnection = 2
+	cfg.Limits.MaxSessionsPerUser = 3
+	s := &Server{sessions: newSessionCounter()}
+	first := &Connection{username: "alice"}
+	second := &Connection{username: "alice"}
+
+	admit := func(c *Connection) string {
+		reason, _ := s.admitChannel(cfg, c)
+		if reason == "" {
+			c.channels.Add(1)
+		}
+		return reason
+	}
+	if admit(first) != "" || admit(first) != "" {
+		t.Fatal("channels below the limit were rejected")
+	}
+	if got := admit(first); got != "max_channels_per_connection" {
+		t.Errorf("third channel on a connection = %q", got)
+	}
+	if got := admit(second); got != "" {
+		t.Errorf("channel on a second connection = %q", got)
+	}
+	if got := admit(second); got != "max_sessions_per_user" {
+		t.Errorf("fourth session of the user = %q", got)
+	}
+}
@@ -0,0 +1,300 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+const (
+	BanKindIP   = "ip"
+	BanKindUser = "user"
+)
+
+// Ban blocks a client address or a username from authenticating until it
+// expires
+type Ban struct {
+	Kind     string    `json:"kind"`
+	Value    string    `json:"value"`
+	Failures int       `json:"failures"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+}
+
+// lockout counts failed logins per client address and per username and
+// bans either once it fails too often. Bans are persisted so that they
+// survive a restart.
+type lockout struct {
+	path     string
+	mu       sync.Mutex
+	failures map[string][]time.Time
+	bans     map[string]Ban
+	// usernames whose public key was rejected, by remote address of a
+	// handshake still in progress
+	keyRejects map[string]string
+}
+
+func banKey(kind, value string) string {
+	return kind + ":" + value
+}
+
+func newLockout(path string) (*lockout, error) {
+	l := &lockout{
+		path:       path,
+		failures:   make(map[string][]time.Time),
+		bans:       make(map[string]Ban),
+		keyRejects: make(map[string]string),
+	}
+	if path == "" {
+		return l, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ban list: %w", err)
+	}
+	var bans []Ban
+	if err := json.Unmarshal(data, &bans); err != nil {
+		return nil, fmt.Errorf("failed to parse ban list %s: %w", path, err)
+	}
+	now := time.Now()
+	for _, ban := range bans {
+		if ban.Expires.After(now) {
+			l.bans[banKey(ban.Kind, ban.Value)] = ban
+		}
+	}
+	if len(l.bans) > 0 {
+		log.Printf("Loaded %d active bans from %s", len(l.bans), path)
+	}
+	return l, nil
+}
+
+// banned returns the active ban on the address or username, if any
+func (l *lockout) banned(clientIP, username string) (Ban, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var keys []string
+	if clientIP != "" {
+		keys = append(keys, banKey(BanKindIP, clientIP))
+	}
+	if username != "" {
+		keys = append(keys, banKey(BanKindUser, username))
+	}
+	for _, key := range keys {
+		ban, ok := l.bans[key]
+		if !ok {
+			continue
+		}
+		if ban.Expires.After(now) {
+			return ban, true
+		}
+		delete(l.bans, key)
+	}
+	return Ban{}, false
+}
+
+// fail records a failed login and returns how long to delay the response,
+// along with any bans the failure triggered
+func (l *lockout) fail(cfg *config.Config, clientIP, username string) (time.Duration, []Ban) {
+	settings := cfg.Security.Lockout
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var newBans []Ban
+	worst := 0
+	check := func(kind, value string, limit int) {
+		key := banKey(kind, value)
+		n := l.record(key, now, settings.Window)
+		if n > worst {
+			worst = n
+		}
+		if limit <= 0 || n < limit {
+			return
+		}
+		ban := Ban{Kind: kind, Value: value, Failures: n, Created: now, Expires: now.Add(settings.BanDuration)}
+		l.bans[key] = ban
+		delete(l.failures, key)
+		newBans = append(newBans, ban)
+	}
+	check(BanKindIP, clientIP, settings.MaxFailuresPerIP)
+	check(BanKindUser, username, settings.MaxFailuresPerUser)
+
+	if len(newBans) > 0 {
+		if err := l.save(); err != nil {
+			log.Printf("Failed to save ban list: %v", err)
+		}
+	}
+	return backoff(settings.BackoffBase, settings.BackoffMax, worst), newBans
+}
+
+// record adds a failure for key and returns the number inside the window.
+// Expired entries of other keys are dropped along the way so the map does
+// not grow with every address that ever failed.
+func (l *lockout) record(key string, now time.Time, window time.Duration) int {
+	cutoff := now.Add(-window)
+	for k, times := range l.failures {
+		if k != key && times[len(times)-1].Before(cutoff) {
+			delete(l.failures, k)
+		}
+	}
+
+	recent := l.failures[key][:0]
+	for _, t := range l.failures[key] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	l.failures[key] = recent
+	return len(recent)
+}
+
+// backoff doubles base for every failure after the first, up to max
+func backoff(base, max time.Duration, failures int) time.Duration {
+	if base <= 0 || failures <= 0 {
+		return 0
+	}
+	delay := base
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return delay
+}
+
+// succeed forgets the user's failures after a successful login. Failures
+// of the address are kept, so that one valid account can't be used to
+// keep guessing the passwords of others.
+func (l *lockout) succeed(username string) {
+	l.mu.Lock()
+	delete(l.failures, banKey(BanKindUser, username))
+	l.mu.Unlock()
+}
+
+// rejectKey remembers a rejected public key until the handshake finishes
+func (l *lockout) rejectKey(remoteAddr, username string) {
+	l.mu.Lock()
+	l.keyRejects[remoteAddr] = username
+	l.mu.Unlock()
+}
+
+// handshakeDone returns the username of a rejected key on this connection,
+// if any, and forgets it
+func (l *lockout) handshakeDone(remoteAddr string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	username, ok := l.keyRejects[remoteAddr]
+	delete(l.keyRejects, remoteAddr)
+	return username, ok
+}
+
+func (l *lockout) list() []Ban {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	bans := make([]Ban, 0, len(l.bans))
+	for key, ban := range l.bans {
+		if !ban.Expires.After(now) {
+			delete(l.bans, key)
+			continue
+		}
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Created.Before(bans[j].Created) })
+	return bans
+}
+
+// clear lifts one ban, or every ban if kind is empty, and returns how many
+// were lifted. The failure history of the cleared entries is reset too.
+func (l *lockout) clear(kind, value string) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := 0
+	if kind == "" {
+		n = len(l.bans)
+		l.bans = make(map[string]Ban)
+		l.failures = make(map[string][]time.Time)
+	} else {
+		key := banKey(kind, value)
+		if _, ok := l.bans[key]; ok {
+			n = 1
+		}
+		delete(l.bans, key)
+		delete(l.failures, key)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, l.save()
+}
+
+// save writes the ban list; the caller must hold l.mu
+func (l *lockout) save() error {
+	if l.path == "" {
+		return nil
+	}
+	bans := make([]Ban, 0, len(l.bans))
+	for _, ban := range l.bans {
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Created.Before(bans[j].Created) })
+
+	data, err := json.MarshalIndent(bans, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create ban list directory: %w", err)
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write ban list: %w", err)
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// Bans lists the active bans, oldest first
+func (s *Server) Bans() []Ban {
+	return s.lockout.list()
+}
+
+// ClearBan lifts the ban on an address or username, reporting whether
+// there was one
+func (s *Server) ClearBan(kind, value string) (bool, error) {
+	if kind != BanKindIP && kind != BanKindUser {
+		return false, fmt.Errorf("invalid ban kind: %s", kind)
+	}
+	n, err := s.lockout.clear(kind, value)
+	if n > 0 {
+		log.Printf("Cleared ban on %s %s", kind, value)
+	}
+	return n > 0, err
+}
+
+// ClearBans lifts every ban and returns how many there were
+func (s *Server) ClearBans() (int, error) {
+	n, err := s.lockout.clear("", "")
+	if n > 0 {
+		log.Printf("Cleared %d bans", n)
+	}
+	return n, err
+}
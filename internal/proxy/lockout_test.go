@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+func lockoutConfig(perIP, perUser int) *config.Config {
+	cfg := &config.Config{}
+	settings := &cfg.Security.Lockout
+	settings.Window = time.Minute
+	settings.BanDuration = time.Hour
+	settings.MaxFailuresPerIP = perIP
+	settings.MaxFailuresPerUser = perUser
+	settings.BackoffBase = time.Second
+	settings.BackoffMax = 10 * time.Second
+	return cfg
+}
+
+type attempt struct {
+	ip, user string
+}
+
+func TestLockoutBans(t *testing.T) {
+	tests := []struct {
+		name     string
+		perIP    int
+		perUser  int
+		attempts []attempt
+		ipBanned []string
+		uBanned  []string
+		free     []attempt
+	}{
+		{
+			name:     "below both limits",
+			perIP:    3,
+			perUser:  3,
+			attempts: []attempt{{"10.0.0.1", "alice"}, {"10.0.0.1", "alice"}},
+			free:     []attempt{{"10.0.0.1", "alice"}},
+		},
+		{
+			name:     "address limit bans the address only",
+			perIP:    3,
+			perUser:  10,
+			attempts: []attempt{{"10.0.0.1", "alice"}, {"10.0.0.1", "bob"}, {"10.0.0.1", "carol"}},
+			ipBanned: []string{"10.0.0.1"},
+			free:     []attempt{{"10.0.0.2", "alice"}},
+		},
+		{
+			name:     "user limit bans the user across addresses",
+			perIP:    10,
+			perUser:  3,
+			attempts: []attempt{{"10.0.0.1", "alice"}, {"10.0.0.2", "alice"}, {"10.0.0.3", "alice"}},
+			uBanned:  []string{"alice"},
+			free:     []attempt{{"10.0.0.1", "bob"}},
+		},
+		{
+			name:     "zero limit never bans",
+			perIP:    0,
+			perUser:  0,
+			attempts: []attempt{{"10.0.0.1", "alice"}, {"10.0.0.1", "alice"}, {"10.0.0.1", "alice"}},
+			free:     []attempt{{"10.0.0.1", "alice"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := lockoutConfig(tt.perIP, tt.perUser)
+			l, err := newLockout("")
+			if err != nil {
+				t.Fatalf("newLockout() error = %v", err)
+			}
+			for _, a := range tt.attempts {
+				l.fail(cfg, a.ip, a.user)
+			}
+			for _, ip := range tt.ipBanned {
+				if ban, ok := l.banned(ip, ""); !ok || ban.Kind != BanKindIP {
+					t.Errorf("address %s not banned", ip)
+				}
+			}
+			for _, user := range tt.uBanned {
+				if ban, ok := l.banned("", user); !ok || ban.Kind != BanKindUser {
+					t.Errorf("user %s not banned", user)
+				}
+			}
+			for _, a := range tt.free {
+				if ban, ok := l.banned(a.ip, a.user); ok {
+					t.Errorf("%s@%s unexpectedly banned: %+v", a.user, a.ip, ban)
+				}
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := backoff(time.Second, 10*time.Second, tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+	if got := backoff(0, 10*time.Second, 3); got != 0 {
+		t.Errorf("backoff without base = %v, want 0", got)
+	}
+}
+
+func TestLockoutSucceed(t *testing.T) {
+	cfg := lockoutConfig(3, 3)
+	l, _ := newLockout("")
+	l.fail(cfg, "10.0.0.1", "alice")
+	l.fail(cfg, "10.0.0.1", "alice")
+	l.succeed("alice")
+
+	// the user's count starts over, the address keeps its failures
+	_, bans := l.fail(cfg, "10.0.0.1", "alice")
+	if len(bans) != 1 || bans[0].Kind != BanKindIP {
+		t.Fatalf("fail() bans = %+v, want only the address", bans)
+	}
+}
+
+func TestLockoutPersistence(t *testing.T) {
+	tests := []struct {
+		name   string
+		expiry time.Duration
+		clear  bool
+		want   bool
+	}{
+		{name: "active ban survives a restart", expiry: time.Hour, want: true},
+		{name: "expired ban is dropped on load", expiry: -time.Minute, want: false},
+		{name: "cleared ban stays cleared", expiry: time.Hour, clear: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bans.json")
+			cfg := lockoutConfig(1, 0)
+			cfg.Security.Lockout.BanDuration = tt.expiry
+
+			l, err := newLockout(path)
+			if err != nil {
+				t.Fatalf("newLockout() error = %v", err)
+			}
+			if _, bans := l.fail(cfg, "10.0.0.1", "alice"); len(bans) != 1 {
+				t.Fatalf("fail() bans = %+v, want one", bans)
+			}
+			if tt.clear {
+				if n, err := l.clear(BanKindIP, "10.0.0.1"); n != 1 || err != nil {
+					t.Fatalf("clear() = %d, %v", n, err)
+				}
+			}
+
+			reloaded, err := newLockout(path)
+			if err != nil {
+				t.Fatalf("newLockout() reload error = %v", err)
+			}
+			if _, ok := reloaded.banned("10.0.0.1", ""); ok != tt.want {
+				t.Errorf("banned after reload = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestLockoutClearAll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+	cfg := lockoutConfig(1, 1)
+	l, _ := newLockout(path)
+	l.fail(cfg, "10.0.0.1", "alice")
+
+	n, err := l.clear("", "")
+	if err != nil || n != 2 {
+		t.Fatalf("clear() = %d, %v, want 2", n, err)
+	}
+	if bans := l.list(); len(bans) != 0 {
+		t.Errorf("list() = %+v, want none", bans)
+	}
+	reloaded, _ := newLockout(path)
+	if bans := reloaded.list(); len(bans) != 0 {
+		t.Errorf("list() after reload = %+v, want none", bans)
+	}
+}
+
+func TestLockoutKeyRejects(t *testing.T) {
+	l, _ := newLockout("")
+	l.rejectKey("10.0.0.1:5000", "alice")
+
+	if user, ok := l.handshakeDone("10.0.0.1:5000"); !ok || user != "alice" {
+		t.Fatalf("handshakeDone() = %q, %v, want alice", user, ok)
+	}
+	if _, ok := l.handshakeDone("10.0.0.1:5000"); ok {
+		t.Error("handshakeDone() remembered the rejection twice")
+	}
+}
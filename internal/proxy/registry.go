@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Connection is an authenticated client connection and the metadata shared
+// by every session opened on it
+type Connection struct {
+	id       string
+	username string
+	clientIP string
+	started  time.Time
+	sshConn  *ssh.ServerConn
+	// the proxy host key the client connected to, which signs session logs
+	hostKey ssh.Signer
+	// closed once the client connection has gone away
+	closed chan struct{}
+	// open channels, for the per-connection limit
+	channels atomic.Int32
+	// how the client authenticated, from the auth callbacks
+	authMethod     string
+	keyFingerprint string
+}
+
+func newConnection(sshConn *ssh.ServerConn, hostKey ssh.Signer) *Connection {
+	c := &Connection{
+		id:       newID(),
+		username: sshConn.User(),
+		clientIP: hostOnly(sshConn.RemoteAddr()),
+		started:  time.Now(),
+		sshConn:  sshConn,
+		hostKey:  hostKey,
+		closed:   make(chan struct{}),
+	}
+	if sshConn.Permissions != nil {
+		c.authMethod = sshConn.Permissions.Extensions["auth_method"]
+		c.keyFingerprint = sshConn.Permissions.Extensions["key_fingerprint"]
+	}
+	go func() {
+		sshConn.Wait()
+		close(c.closed)
+	}()
+	return c
+}
+
+// ConnectionInfo is a point-in-time view of a client connection
+type ConnectionInfo struct {
+	ID            string    `json:"id"`
+	Username      string    `json:"username"`
+	ClientAddr    string    `json:"client_addr"`
+	ClientVersion string    `json:"client_version"`
+	Started       time.Time `json:"started"`
+	Sessions      int       `json:"sessions"`
+}
+
+// SessionInfo is a point-in-time view of a proxied session
+type SessionInfo struct {
+	ID           string    `json:"id"`
+	ConnectionID string    `json:"connection_id"`
+	Username     string    `json:"username"`
+	ClientIP     string    `json:"client_ip"`
+	Target       string    `json:"target"`
+	Mode         string    `json:"mode"`
+	Started      time.Time `json:"started"`
+	BytesIn      int64     `json:"bytes_in"`
+	BytesOut     int64     `json:"bytes_out"`
+	TermWidth    uint32    `json:"term_width"`
+	TermHeight   uint32    `json:"term_height"`
+	LogFile      string    `json:"log_file"`
+	ApprovedBy   string    `json:"approved_by,omitempty"`
+	Watchers     int       `json:"watchers"`
+}
+
+// registry tracks live connections and sessions for the admin API
+type registry struct {
+	mu       sync.Mutex
+	conns    map[string]*Connection
+	sessions map[string]*Session
+}
+
+func newRegistry() *registry {
+	return &registry{
+		conns:    make(map[string]*Connection),
+		sessions: make(map[string]*Session),
+	}
+}
+
+func (r *registry) addConnection(c *Connection) {
+	r.mu.Lock()
+	r.conns[c.id] = c
+	r.mu.Unlock()
+}
+
+func (r *registry) removeConnection(c *Connection) {
+	r.mu.Lock()
+	delete(r.conns, c.id)
+	r.mu.Unlock()
+}
+
+func (r *registry) addSession(s *Session) {
+	r.mu.Lock()
+	r.sessions[s.id] = s
+	r.mu.Unlock()
+}
+
+func (r *registry) removeSession(s *Session) {
+	r.mu.Lock()
+	delete(r.sessions, s.id)
+	r.mu.Unlock()
+}
+
+func (r *registry) activeSessions() []*Session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sessions := make([]*Session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+func (r *registry) session(id string) (*Session, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[id]
+	return s, ok
+}
+
+func (r *registry) activeConnections() []*Connection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conns := make([]*Connection, 0, len(r.conns))
+	for _, c := range r.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+func (r *registry) connectionInfo(c *Connection) ConnectionInfo {
+	info := ConnectionInfo{
+		ID:            c.id,
+		Username:      c.username,
+		ClientAddr:    c.sshConn.RemoteAddr().String(),
+		ClientVersion: string(c.sshConn.ClientVersion()),
+		Started:       c.started,
+	}
+	for _, s := range r.sessions {
+		if s.conn == c {
+			info.Sessions++
+		}
+	}
+	return info
+}
+
+// Connections lists the authenticated client connections, oldest first
+func (s *Server) Connections() []ConnectionInfo {
+	s.registry.mu.Lock()
+	defer s.registry.mu.Unlock()
+
+	infos := make([]ConnectionInfo, 0, len(s.registry.conns))
+	for _, c := range s.registry.conns {
+		infos = append(infos, s.registry.connectionInfo(c))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Started.Before(infos[j].Started) })
+	return infos
+}
+
+// Sessions lists the active sessions, oldest first
+func (s *Server) Sessions() []SessionInfo {
+	sessions := s.registry.activeSessions()
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, sess := range sessions {
+		infos = append(infos, sess.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Started.Before(infos[j].Started) })
+	return infos
+}
+
+// Session returns the active session with the given ID
+func (s *Server) Session(id string) (SessionInfo, bool) {
+	s.registry.mu.Lock()
+	sess, ok := s.registry.sessions[id]
+	s.registry.mu.Unlock()
+	if !ok {
+		return SessionInfo{}, false
+	}
+	return sess.Info(), true
+}
+
+// TerminateSession closes one session, reporting whether it was found
+func (s *Server) TerminateSession(id, reason string) bool {
+	s.registry.mu.Lock()
+	sess, ok := s.registry.sessions[id]
+	s.registry.mu.Unlock()
+	if !ok {
+		return false
+	}
+	sess.Terminate(reason)
+	return true
+}
+
+// TerminateUser closes every session and connection belonging to username
+// and returns the number of sessions closed
+func (s *Server) TerminateUser(username, reason string) int {
+	s.registry.mu.Lock()
+	var sessions []*Session
+	for _, sess := range s.registry.sessions {
+		if sess.username == username {
+			sessions = append(sessions, sess)
+		}
+	}
+	var conns []*Connection
+	for _, c := range s.registry.conns {
+		if c.username == username {
+			conns = append(conns, c)
+		}
+	}
+	s.registry.mu.Unlock()
+
+	for _, sess := range sessions {
+		sess.Terminate(reason)
+	}
+	for _, c := range conns {
+		c.sshConn.Close()
+	}
+	return len(sessions)
+}
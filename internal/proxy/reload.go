@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/notify"
+)
+
+// Reload re-reads the configuration file and swaps it in for new
+// connections. Sessions that are already open keep the configuration they
+// started with. If the file does not load or validate, the running
+// configuration is left untouched and the error is returned.
+func (s *Server) Reload(path string) ([]string, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	cfg, err := config.LoadYAML(path)
+	if err != nil {
+		log.Printf("Configuration reload failed, keeping current configuration: %v", err)
+		return nil, err
+	}
+	notifier, err := notify.NewNotifier(cfg)
+	if err != nil {
+		log.Printf("Configuration reload failed, keeping current configuration: %v", err)
+		return nil, fmt.Errorf("failed to set up alerts: %w", err)
+	}
+	notifier.SetAudit(s.audit)
+
+	current := s.currentConfig()
+	changes := config.Diff(current, cfg)
+
+	// startup-only settings stay as they are actually running, so later
+	// reloads keep reporting them as pending
+	cfg.Server = current.Server
+	cfg.Admin = current.Admin
+	cfg.Metrics = current.Metrics
+	cfg.Security.Lockout.BanFile = current.Security.Lockout.BanFile
+	cfg.Shipping = current.Shipping
+
+	s.config.Store(cfg)
+	s.notifier.Store(notifier)
+
+	if len(changes) == 0 {
+		log.Printf("Configuration reloaded from %s: no changes", path)
+		return changes, nil
+	}
+	log.Printf("Configuration reloaded from %s:", path)
+	for _, change := range changes {
+		if config.RequiresRestart(change) {
+			log.Printf("  %s (requires restart)", change)
+		} else {
+			log.Printf("  %s", change)
+		}
+	}
+	return changes, nil
+}
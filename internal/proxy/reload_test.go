@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+const reloadConfig = `
+server:
+  port: %PORT%
+  host_key_path: "%DIR%/host_key"
+upstream:
+  host: "localhost"
+  port: %UPSTREAM%
+  username: "admin"
+  auth:
+    type: "password"
+    password: "secret"
+users:
+  - username: "user1"
+    auth:
+      type: "password"
+      password: "user1pass"
+logging:
+  directory: "%DIR%/logs"
+`
+
+func writeReloadConfig(t *testing.T, path, port, upstream string) {
+	t.Helper()
+	r := strings.NewReplacer("%PORT%", port, "%UPSTREAM%", upstream, "%DIR%", filepath.Dir(path))
+	if err := os.WriteFile(path, []byte(r.Replace(reloadConfig)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeReloadConfig(t, path, "2222", "22")
+	cfg, err := config.LoadYAML(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	// an invalid file leaves the running configuration alone
+	os.WriteFile(path, []byte("upstream: ["), 0644)
+	if _, err := s.Reload(path); err == nil {
+		t.Fatal("Reload() of an invalid file succeeded")
+	}
+	if s.currentConfig() != cfg {
+		t.Fatal("failed reload replaced the configuration")
+	}
+
+	writeReloadConfig(t, path, "2223", "2200")
+	changes, err := s.Reload(path)
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	want := []string{"upstream.port: 22 -> 2200", "server.port: 2222 -> 2223"}
+	if strings.Join(changes, "\n") != strings.Join(want, "\n") {
+		t.Errorf("changes = %q, want %q", changes, want)
+	}
+	if got := s.currentConfig(); got.Upstream.Port != 2200 || got.Server.Port != 2222 {
+		t.Errorf("after reload upstream port = %d, server port = %d, want 2200 and the running 2222", got.Upstream.Port, got.Server.Port)
+	}
+
+	// the restart-only change is still pending on the next reload
+	changes, err = s.Reload(path)
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(changes) != 1 || !config.RequiresRestart(changes[0]) {
+		t.Errorf("second reload changes = %q, want the pending server port", changes)
+	}
+}
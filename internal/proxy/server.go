@@ -1,30 +1,76 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
 	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 
+	"github.com/devashar13/ssh-proxy/internal/audit"
 	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/history"
+	"github.com/devashar13/ssh-proxy/internal/llm"
+	"github.com/devashar13/ssh-proxy/internal/metrics"
+	"github.com/devashar13/ssh-proxy/internal/notify"
+	"github.com/devashar13/ssh-proxy/internal/retention"
+	"github.com/devashar13/ssh-proxy/internal/search"
 )
 
+// how long Shutdown still waits for sessions after closing their connections
+const forceCloseWait = 5 * time.Second
+
 type Server struct {
-	config     *config.Config
+	config     atomic.Pointer[config.Config]
 	sshConfig  *ssh.ServerConfig
+	hostKey    ssh.Signer
+	notifier   atomic.Pointer[notify.Notifier]
+	shipper    *audit.Shipper
+	registry   *registry
+	lockout    *lockout
+	conns      *connCounter
+	sessions   *sessionCounter
+	approvals  *approvals
 	listener   net.Listener
+	stopping   chan struct{}
 	shutdownWg sync.WaitGroup
+	sessionWg  sync.WaitGroup
 	running    bool
 	mu         sync.Mutex
+	reloadMu   sync.Mutex
 }
 
 func NewServer(cfg *config.Config) (*Server, error) {
+	notifier, err := notify.NewNotifier(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up alerts: %w", err)
+	}
+	lockout, err := newLockout(cfg.Security.Lockout.BanFile)
+	if err != nil {
+		return nil, err
+	}
+	shipper, err := audit.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up audit shipping: %w", err)
+	}
 	server := &Server{
-		config: cfg,
+		shipper:   shipper,
+		registry:  newRegistry(),
+		lockout:   lockout,
+		conns:     newConnCounter(),
+		sessions:  newSessionCounter(),
+		approvals: newApprovals(),
+		stopping:  make(chan struct{}),
 	}
+	server.config.Store(cfg)
+	notifier.SetAudit(server.audit)
+	server.notifier.Store(notifier)
 
 
 	sshConfig := &ssh.ServerConfig{
@@ -39,11 +85,22 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		return nil, fmt.Errorf("failed to load/generate host key: %w", err)
 	}
 	sshConfig.AddHostKey(hostKey)
+	server.hostKey = hostKey
 
 	server.sshConfig = sshConfig
 	return server, nil
 }
 
+// currentConfig returns the configuration new connections are served with
+func (s *Server) currentConfig() *config.Config {
+	return s.config.Load()
+}
+
+// Config returns the configuration in effect, including reloaded changes
+func (s *Server) Config() *config.Config {
+	return s.currentConfig()
+}
+
 func (s *Server) ListenAndServe() error {
 	s.mu.Lock()
 	if s.running {
@@ -53,15 +110,19 @@ func (s *Server) ListenAndServe() error {
 	s.running = true
 	s.mu.Unlock()
 
-	addr := fmt.Sprintf(":%d", s.config.Server.Port)
+	addr := fmt.Sprintf(":%d", s.currentConfig().Server.Port)
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %w", addr, err)
 	}
+	s.mu.Lock()
 	s.listener = listener
+	s.mu.Unlock()
 
 	log.Printf("SSH proxy server listening on %s", addr)
 
+	go retention.Run(s.currentConfig, s.activeLogs, s.stopping)
+
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
@@ -77,10 +138,24 @@ func (s *Server) ListenAndServe() error {
 			continue
 		}
 
-	
+		metrics.ConnectionsAccepted.Inc()
+
+		clientIP := hostOnly(conn.RemoteAddr())
+		if reason, message := s.conns.acquire(s.currentConfig(), clientIP); reason != "" {
+			log.Printf("Rejected connection from %s: %s", conn.RemoteAddr(), reason)
+			metrics.PolicyDenials.WithLabelValues(reason).Inc()
+			// sent before the SSH version line, which clients print or log
+			fmt.Fprintf(conn, "%s\r\n", message)
+			conn.Close()
+			continue
+		}
+		metrics.ActiveConnections.Inc()
+
 		s.shutdownWg.Add(1)
 		go func() {
 			defer s.shutdownWg.Done()
+			defer metrics.ActiveConnections.Dec()
+			defer s.conns.release(clientIP)
 			if err := s.handleConnection(conn); err != nil {
 				log.Printf("Error handling connection: %v", err)
 			}
@@ -88,88 +163,229 @@ func (s *Server) ListenAndServe() error {
 	}
 }
 
-func (s *Server) Shutdown() {
+// activeLogs returns the log files of open sessions, which retention must
+// leave alone
+func (s *Server) activeLogs() map[string]bool {
+	logs := make(map[string]bool)
+	for _, sess := range s.registry.activeSessions() {
+		logs[sess.logFile.Name()] = true
+	}
+	return logs
+}
+
+func (s *Server) isRunning() bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.running
+}
 
+// Shutdown stops accepting connections, warns every live session and waits
+// for them to finish until ctx is done. Sessions still open at that point
+// are closed, and Shutdown returns once their logs are written and pending
+// summaries and alerts have been sent.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
 	if !s.running {
-		return
+		s.mu.Unlock()
+		return nil
 	}
-
 	s.running = false
 	if s.listener != nil {
 		s.listener.Close()
 	}
+	close(s.stopping)
+	s.mu.Unlock()
 
+	s.approvals.rejectAll("the SSH proxy is shutting down")
 
+	cfg := s.currentConfig()
+	sessions := s.registry.activeSessions()
+	if len(sessions) > 0 {
+		log.Printf("Waiting for %d active sessions to finish", len(sessions))
+		for _, sess := range sessions {
+			sess.notifyClient(cfg.Server.ShutdownMessage)
+		}
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		s.sessionWg.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+		remaining := s.registry.activeSessions()
+		log.Printf("Drain deadline reached, closing %d remaining sessions", len(remaining))
+		for _, sess := range remaining {
+			sess.Terminate("The SSH proxy has shut down.")
+		}
+		// sessions still being set up are cut off with their connection
+		s.closeConnections()
+		select {
+		case <-drained:
+		case <-time.After(forceCloseWait):
+			log.Printf("Sessions still running %s after the deadline, no longer waiting for them", forceCloseWait)
+		}
+	}
+
+	// connections without sessions would otherwise stay open indefinitely
+	s.closeConnections()
 	s.shutdownWg.Wait()
+
+	llm.WaitForSummaries()
+	s.notifier.Load().Wait()
+	s.shipper.Close()
+
 	log.Println("SSH proxy server shutdown complete")
+	return err
+}
+
+func (s *Server) closeConnections() {
+	for _, c := range s.registry.activeConnections() {
+		c.sshConn.Close()
+	}
+}
+
+// registerSession adds a session to the registry unless shutdown has begun.
+// Shutdown stops the server under the same lock before it looks at the
+// registry, so every session registered here is seen by it.
+func (s *Server) registerSession(session *Session) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return false
+	}
+	s.registry.addSession(session)
+	return true
 }
 
 func (s *Server) handleConnection(conn net.Conn) error {
-    defer conn.Close()
-    
-    log.Printf("New connection from %s", conn.RemoteAddr())
-
-
-    sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.sshConfig)
-    if err != nil {
-        return fmt.Errorf("failed to handshake: %w", err)
-    }
-    defer sshConn.Close()
-
-    log.Printf("User %s authenticated from %s", sshConn.User(), conn.RemoteAddr())
-
-
-    go ssh.DiscardRequests(reqs)
-
-
-    for newChannel := range chans {
-    
-        if newChannel.ChannelType() != "session" {
-            newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
-            continue
-        }
-
-    
-        channel, requests, err := newChannel.Accept()
-        if err != nil {
-            return fmt.Errorf("failed to accept channel: %w", err)
-        }
-
-    
-        session, err := NewSession(s.config, sshConn.User(), channel, requests)
-        if err != nil {
-            log.Printf("Failed to create session: %v", err)
-        
-            fmt.Fprintf(channel, "Error: %v\r\n", err)
-            channel.Close()
-            continue
-        }
-
-    
-        go func() {
-            if err := session.Start(); err != nil {
-                log.Printf("Session error: %v", err)
-            
-                fmt.Fprintf(channel, "Error: %v\r\n", err)
-            }
-        }()
-    }
-    
-    return nil
+	defer conn.Close()
+
+	log.Printf("New connection from %s", conn.RemoteAddr())
+
+	if reason, ok := s.admitSource(s.currentConfig(), conn.RemoteAddr()); !ok {
+		log.Printf("Rejected connection from %s: %s", conn.RemoteAddr(), reason)
+		metrics.PolicyDenials.WithLabelValues(reason).Inc()
+		return nil
+	}
+
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.sshConfig)
+	keyRejectedFor, keyRejected := s.lockout.handshakeDone(conn.RemoteAddr().String())
+	if err != nil {
+		metrics.HandshakeFailures.Inc()
+		// rejected keys only count as a failed login once the client
+		// has run out of keys to offer
+		if keyRejected {
+			s.notifyAuthFailure(keyRejectedFor, conn.RemoteAddr(), "publickey")
+			s.recordLoginFailure(conn.RemoteAddr(), keyRejectedFor)
+		}
+		return fmt.Errorf("failed to handshake: %w", err)
+	}
+	defer sshConn.Close()
+
+	log.Printf("User %s authenticated from %s", sshConn.User(), conn.RemoteAddr())
+	s.authenticated(sshConn)
+
+	// the connection keeps the configuration it authenticated under, even
+	// if it is reloaded while the connection is open
+	cfg := s.currentConfig()
+	notifier := s.notifier.Load()
+
+	client := newConnection(sshConn, s.hostKey)
+	s.registry.addConnection(client)
+	defer s.registry.removeConnection(client)
+
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		if !s.isRunning() {
+			newChannel.Reject(ssh.ResourceShortage, "proxy is shutting down")
+			continue
+		}
+		if reason, message := s.admitChannel(cfg, client); reason != "" {
+			log.Printf("Rejected session for user %s from %s: %s", client.username, client.clientIP, reason)
+			metrics.PolicyDenials.WithLabelValues(reason).Inc()
+			newChannel.Reject(ssh.ResourceShortage, message)
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			s.sessions.release(client.username)
+			return fmt.Errorf("failed to accept channel: %w", err)
+		}
+		client.channels.Add(1)
+
+		// sessions are set up in the background so that one waiting for
+		// approval does not hold up the other channels of the connection
+		s.sessionWg.Add(1)
+		go func() {
+			defer s.sessionWg.Done()
+			defer client.channels.Add(-1)
+			defer s.sessions.release(client.username)
+
+			if s.isShadowAdmin(cfg, client.username) {
+				var handled bool
+				if requests, handled = s.interceptShadow(cfg, client, channel, requests); handled {
+					return
+				}
+			}
+
+			session, err := NewSession(cfg, client, channel, requests, notifier, s.approvals)
+			if err != nil {
+				log.Printf("Failed to create session: %v", err)
+
+				fmt.Fprintf(channel, "Error: %v\r\n", err)
+				channel.Close()
+				return
+			}
+
+			// approval and the upstream dial may take long enough for a
+			// shutdown to begin in the meantime
+			if !s.registerSession(session) {
+				session.abandon("the SSH proxy is shutting down")
+				fmt.Fprintf(channel, "Error: the SSH proxy is shutting down\r\n")
+				channel.Close()
+				return
+			}
+			defer s.registry.removeSession(session)
+			if err := session.Start(); err != nil {
+				log.Printf("Session error: %v", err)
+
+				fmt.Fprintf(channel, "Error: %v\r\n", err)
+			}
+		}()
+	}
+
+	return nil
 }
+
 func (s *Server) handlePasswordAuth(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
 	username := conn.User()
-	
+	if err := s.checkBanned(conn); err != nil {
+		return nil, err
+	}
 
-	for _, user := range s.config.Users {
+	for _, user := range s.currentConfig().Users {
 		if user.Username == username && user.Auth.Type == "password" {
 			if user.Auth.Password == string(password) {
+				if err := s.checkAccess(conn, &user); err != nil {
+					return nil, err
+				}
 				return &ssh.Permissions{
 				
 					Extensions: map[string]string{
-						"username": username,
+						"username":    username,
+						"auth_method": "password",
 					},
 				}, nil
 			}
@@ -177,14 +393,20 @@ func (s *Server) handlePasswordAuth(conn ssh.ConnMetadata, password []byte) (*ss
 	}
 
 	log.Printf("Failed password auth attempt for user %s from %s", username, conn.RemoteAddr())
+	s.notifyAuthFailure(username, conn.RemoteAddr(), "password")
+	// the failure is counted now, not again when the handshake fails
+	s.lockout.handshakeDone(conn.RemoteAddr().String())
+	time.Sleep(s.recordLoginFailure(conn.RemoteAddr(), username))
 	return nil, fmt.Errorf("authentication failed")
 }
 
 func (s *Server) handlePublicKeyAuth(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
 	username := conn.User()
-	
+	if err := s.checkBanned(conn); err != nil {
+		return nil, err
+	}
 
-	for _, user := range s.config.Users {
+	for _, user := range s.currentConfig().Users {
 		if user.Username == username && user.Auth.Type == "publickey" {
 		
 			authorizedKeysBytes, err := os.ReadFile(user.Auth.KeyPath)
@@ -202,9 +424,14 @@ func (s *Server) handlePublicKeyAuth(conn ssh.ConnMetadata, key ssh.PublicKey) (
 
 		
 			if KeysEqual(parsedKey, key) {
+				if err := s.checkAccess(conn, &user); err != nil {
+					return nil, err
+				}
 				return &ssh.Permissions{
 					Extensions: map[string]string{
-						"username": username,
+						"username":        username,
+						"auth_method":     "publickey",
+						"key_fingerprint": ssh.FingerprintSHA256(key),
 					},
 				}, nil
 			}
@@ -212,9 +439,91 @@ func (s *Server) handlePublicKeyAuth(conn ssh.ConnMetadata, key ssh.PublicKey) (
 	}
 
 	log.Printf("Failed public key auth attempt for user %s from %s", username, conn.RemoteAddr())
+	// a client may offer several keys; whether this was a failed login is
+	// only known once the handshake ends
+	s.lockout.rejectKey(conn.RemoteAddr().String(), username)
 	return nil, fmt.Errorf("authentication failed")
 }
 
+// authenticated does the bookkeeping of a successful login. It must wait
+// for the handshake: the public key callback is also asked about keys the
+// client merely offers, before it has proven it holds them.
+func (s *Server) authenticated(conn *ssh.ServerConn) {
+	username := conn.Permissions.Extensions["username"]
+	method := conn.Permissions.Extensions["auth_method"]
+	s.lockout.succeed(username)
+	s.recordAuth(method, username, true)
+
+	details := map[string]string{"method": method}
+	if fingerprint := conn.Permissions.Extensions["key_fingerprint"]; fingerprint != "" {
+		details["fingerprint"] = fingerprint
+	}
+	s.notifier.Load().Audit(notify.Event{
+		Type:     notify.EventAuthSuccess,
+		Username: username,
+		ClientIP: hostOnly(conn.RemoteAddr()),
+		Message:  "authenticated with " + method,
+		Details:  details,
+	})
+}
+
+// recordAuth counts an authentication attempt. Unknown usernames share one
+// label so that scanners cannot blow up the metric's cardinality.
+func (s *Server) recordAuth(method, username string, success bool) {
+	userLabel := "unknown"
+	if s.currentConfig().FindUser(username) != nil {
+		userLabel = username
+	}
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	metrics.AuthAttempts.WithLabelValues(method, userLabel, result).Inc()
+}
+
+// audit receives every event raised while serving, whether or not it is
+// alerted on
+func (s *Server) audit(event notify.Event) {
+	s.shipper.Ship(event)
+	if event.Type == notify.EventSummaryRisk {
+		cfg := s.currentConfig()
+		if !cfg.Search.Enabled {
+			return
+		}
+		if err := search.OpenIndex(search.IndexPath(cfg)).SetSessionRisk(filepath.Base(event.Details["log"]), event.Risk); err != nil {
+			log.Printf("Failed to index session risk: %v", err)
+		}
+	}
+}
+
+// Search queries the command index of the current configuration
+func (s *Server) Search(q search.Query) ([]search.Record, error) {
+	return search.OpenIndex(search.IndexPath(s.currentConfig())).Search(q)
+}
+
+// History lists recorded sessions, including those that have ended
+func (s *Server) History(f history.Filter) ([]history.Record, error) {
+	return history.OpenStore(history.StorePath(s.currentConfig())).List(f)
+}
+
+// HistoryRecord returns one recorded session
+func (s *Server) HistoryRecord(id string) (history.Record, bool, error) {
+	return history.OpenStore(history.StorePath(s.currentConfig())).Get(id)
+}
+
+// notifyAuthFailure records a failed login; the notifier alerts once a
+// user and address fail often enough
+func (s *Server) notifyAuthFailure(username string, addr net.Addr, method string) {
+	s.recordAuth(method, username, false)
+	s.notifier.Load().Notify(notify.Event{
+		Type:     notify.EventAuthFailure,
+		Username: username,
+		ClientIP: hostOnly(addr),
+		Message:  "authentication failed with " + method,
+		Details:  map[string]string{"method": method},
+	})
+}
+
 func (s *Server) loadOrGenerateHostKey(path string) (ssh.Signer, error) {
 
 	if _, err := os.Stat(path); err == nil {
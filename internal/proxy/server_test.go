@@ -0,0 +1,689 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"gopkg.in/yaml.v3"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/history"
+	"github.com/devashar13/ssh-proxy/internal/metrics"
+	"github.com/devashar13/ssh-proxy/internal/notify"
+)
+
+// startUpstream runs a minimal SSH server standing in for the upstream.
+// Exec commands:
+//
+//	print   writes to stdout and stderr and exits with status 3
+//	kill    is killed by SIGTERM
+//	cat     copies stdin to stdout until EOF
+//	sign    asks the forwarded agent to sign with its first key
+//	x11     opens an X11 channel, sends "ping" and relays the answer
+func startUpstream(t *testing.T) string {
+	t.Helper()
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "admin" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+	}
+	serverConfig.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn, chans, reqs, err := ssh.NewServerConn(nc, serverConfig)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					ch, chReqs, err := newChannel.Accept()
+					if err != nil {
+						continue
+					}
+					go serveUpstreamSession(conn, ch, chReqs)
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveUpstreamSession(conn *ssh.ServerConn, ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+	for req := range reqs {
+		if req.Type != "exec" {
+			req.Reply(true, nil)
+			continue
+		}
+		var params struct{ Command string }
+		ssh.Unmarshal(req.Payload, &params)
+		req.Reply(true, nil)
+
+		status := uint32(0)
+		switch params.Command {
+		case "print":
+			io.WriteString(ch, "out\n")
+			io.WriteString(ch.Stderr(), "err\n")
+			status = 3
+		case "kill":
+			ch.SendRequest("exit-signal", false, ssh.Marshal(struct {
+				Signal     string
+				CoreDumped bool
+				Message    string
+				Lang       string
+			}{"TERM", false, "", ""}))
+			return
+		case "cat":
+			io.Copy(ch, ch)
+		case "sign":
+			agentChannel, agentReqs, err := conn.OpenChannel(agentChannelType, nil)
+			if err != nil {
+				io.WriteString(ch.Stderr(), err.Error())
+				status = 1
+				break
+			}
+			go ssh.DiscardRequests(agentReqs)
+			keyring := agent.NewClient(agentChannel)
+			keys, err := keyring.List()
+			if err == nil && len(keys) > 0 {
+				_, err = keyring.Sign(keys[0], []byte("challenge"))
+			}
+			agentChannel.Close()
+			if err != nil || len(keys) == 0 {
+				status = 1
+				break
+			}
+			io.WriteString(ch, "signed")
+		case "x11":
+			origin := ssh.Marshal(struct {
+				Address string
+				Port    uint32
+			}{"127.0.0.1", 41000})
+			x11, x11Reqs, err := conn.OpenChannel(x11ChannelType, origin)
+			if err != nil {
+				io.WriteString(ch.Stderr(), err.Error())
+				status = 1
+				break
+			}
+			go ssh.DiscardRequests(x11Reqs)
+			io.WriteString(x11, "ping")
+			x11.CloseWrite()
+			io.Copy(ch, x11)
+			x11.Close()
+		}
+		ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+// startProxy runs the proxy in front of a test upstream. user1 logs in
+// with the password "user1pass".
+func startProxy(t *testing.T, setup func(cfg *config.Config)) (*Server, string) {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(startUpstream(t))
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Server.HostKeyPath = filepath.Join(dir, "host_key")
+	cfg.Upstream.Host = host
+	cfg.Upstream.Port, _ = strconv.Atoi(port)
+	cfg.Upstream.Username = "admin"
+	cfg.Upstream.Auth.Type = "password"
+	cfg.Upstream.Auth.Password = "secret"
+	users := "users: [{username: user1, auth: {type: password, password: user1pass}}]"
+	if err := yaml.Unmarshal([]byte(users), cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Logging.Directory = filepath.Join(dir, "logs")
+	if setup != nil {
+		setup(cfg)
+	}
+
+	s, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	go s.ListenAndServe()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		ln := s.listener
+		s.mu.Unlock()
+		if ln != nil {
+			_, port, _ := net.SplitHostPort(ln.Addr().String())
+			return s, net.JoinHostPort("127.0.0.1", port)
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("proxy did not start listening")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func dialProxy(t *testing.T, addr string) *ssh.Client {
+	t.Helper()
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "user1",
+		Auth:            []ssh.AuthMethod{ssh.Password("user1pass")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("failed to connect to the proxy: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestShutdownDrainsSessions(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		finish  bool
+		wantErr error
+	}{
+		{"session finishes in time", 5 * time.Second, true, nil},
+		{"deadline closes the session", 200 * time.Millisecond, false, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, addr := startProxy(t, func(cfg *config.Config) { cfg.Server.ShutdownMessage = "going down" })
+			session, err := dialProxy(t, addr).NewSession()
+			if err != nil {
+				t.Fatal(err)
+			}
+			stdin, _ := session.StdinPipe()
+			output, w := io.Pipe()
+			session.Stdout = w
+			session.Stderr = w
+			if err := session.Start("cat"); err != nil {
+				t.Fatal(err)
+			}
+
+			warned := make(chan struct{})
+			go func() {
+				var seen strings.Builder
+				found := false
+				buf := make([]byte, 1024)
+				for {
+					n, err := output.Read(buf)
+					seen.Write(buf[:n])
+					if !found && strings.Contains(seen.String(), "*** going down ***") {
+						close(warned)
+						found = true
+					}
+					if err != nil {
+						return
+					}
+				}
+			}()
+
+			done := make(chan error, 1)
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+				defer cancel()
+				done <- s.Shutdown(ctx)
+			}()
+			select {
+			case <-warned:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the client was not warned about the shutdown")
+			}
+			if tt.finish {
+				stdin.Close()
+			}
+			if err := <-done; err != tt.wantErr {
+				t.Errorf("Shutdown() error = %v, want %v", err, tt.wantErr)
+			}
+			session.Wait()
+			w.Close()
+
+			if conn, err := net.Dial("tcp", addr); err == nil {
+				conn.Close()
+				t.Error("the proxy still accepts connections")
+			}
+		})
+	}
+}
+
+func TestLoginAccessRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		expires time.Time
+		wantErr bool
+	}{
+		{"no expiry", time.Time{}, false},
+		{"not yet expired", time.Now().Add(time.Hour), false},
+		{"expired", time.Now().Add(-time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, addr := startProxy(t, func(cfg *config.Config) { cfg.Users[0].Access.Expires = tt.expires })
+			client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+				User:            "user1",
+				Auth:            []ssh.AuthMethod{ssh.Password("user1pass")},
+				HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			})
+			if err == nil {
+				client.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("login error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionHistory(t *testing.T) {
+	s, addr := startProxy(t, nil)
+	session, err := dialProxy(t, addr).NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := session.Output("print"); string(out) != "out\n" {
+		t.Fatalf("Output() = %q", out)
+	}
+
+	// the record is completed once the proxy has closed the session
+	var rec history.Record
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		records, err := s.History(history.Filter{})
+		if err != nil {
+			t.Fatalf("History() error = %v", err)
+		}
+		if len(records) == 1 && records[0].Ended != nil {
+			rec = records[0]
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("History() = %+v, want one ended session", records)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if rec.Username != "user1" || rec.Mode != "exec" || rec.AuthMethod != "password" ||
+		rec.ExitStatus == nil || *rec.ExitStatus != 3 || rec.BytesIn != 0 || rec.BytesOut != 8 {
+		t.Errorf("record = %+v", rec)
+	}
+	if !strings.HasPrefix(rec.Artifacts.Log, s.currentConfig().Logging.Directory) {
+		t.Errorf("log %s is outside the logging directory", rec.Artifacts.Log)
+	}
+	if got, ok, err := s.HistoryRecord(rec.ID); err != nil || !ok || got.ID != rec.ID {
+		t.Errorf("HistoryRecord(%s) = %+v, %v, %v", rec.ID, got, ok, err)
+	}
+}
+
+// sessionLog returns the log of the only session recorded so far
+func sessionLog(t *testing.T, s *Server) string {
+	t.Helper()
+	records, err := s.History(history.Filter{})
+	if err != nil || len(records) != 1 {
+		t.Fatalf("History() = %+v, %v, want one session", records, err)
+	}
+	data, err := os.ReadFile(records[0].Artifacts.Log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestExecThroughProxy(t *testing.T) {
+	tests := []struct {
+		command    string
+		stdin      string
+		stdout     string
+		stderr     string
+		exitStatus int
+		exitSignal string
+		footer     string
+	}{
+		{command: "print", stdout: "out\n", stderr: "err\n", exitStatus: 3, footer: "Exit status: 3\n"},
+		{command: "kill", exitStatus: 143, exitSignal: "TERM", footer: "Exit signal: TERM\n"},
+		{command: "cat", stdin: "piped input", stdout: "piped input", footer: "Exit status: 0\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			s, addr := startProxy(t, nil)
+			session, err := dialProxy(t, addr).NewSession()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var stdout, stderr bytes.Buffer
+			session.Stdin = strings.NewReader(tt.stdin)
+			session.Stdout = &stdout
+			session.Stderr = &stderr
+
+			err = session.Run(tt.command)
+			status, signal := 0, ""
+			var exitErr *ssh.ExitError
+			if errors.As(err, &exitErr) {
+				status, signal = exitErr.ExitStatus(), exitErr.Signal()
+			} else if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if status != tt.exitStatus || signal != tt.exitSignal {
+				t.Errorf("exit status %d, signal %q, want %d, %q", status, signal, tt.exitStatus, tt.exitSignal)
+			}
+			if stdout.String() != tt.stdout || stderr.String() != tt.stderr {
+				t.Errorf("stdout %q, stderr %q, want %q, %q", stdout.String(), stderr.String(), tt.stdout, tt.stderr)
+			}
+
+			log := sessionLog(t, s)
+			if !strings.Contains(log, "$ "+tt.command+"\n") || !strings.HasSuffix(log, "Mode: exec\n"+tt.footer) {
+				t.Errorf("session log:\n%s", log)
+			}
+		})
+	}
+}
+
+func TestAgentForwarding(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: priv}); err != nil {
+		t.Fatal(err)
+	}
+	signer, _ := ssh.NewSignerFromKey(priv)
+	fingerprint := ssh.FingerprintSHA256(signer.PublicKey())
+
+	tests := []struct {
+		name    string
+		allowed bool
+	}{
+		{"allowed", true},
+		{"not enabled for the user", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, addr := startProxy(t, func(cfg *config.Config) { cfg.Users[0].ForwardAgent = tt.allowed })
+			client := dialProxy(t, addr)
+			if err := agent.ForwardToAgent(client, keyring); err != nil {
+				t.Fatal(err)
+			}
+			session, err := client.NewSession()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = agent.RequestAgentForwarding(session)
+			if (err == nil) != tt.allowed {
+				t.Fatalf("RequestAgentForwarding() error = %v, want allowed %v", err, tt.allowed)
+			}
+			if !tt.allowed {
+				return
+			}
+			out, err := session.Output("sign")
+			if err != nil || string(out) != "signed" {
+				t.Fatalf("Output() = %q, %v", out, err)
+			}
+
+			log := sessionLog(t, s)
+			if !strings.Contains(log, "# agent forwarding enabled") ||
+				!strings.Contains(log, "# agent: sign request with ssh-ed25519 key "+fingerprint) {
+				t.Errorf("session log does not record the signature:\n%s", log)
+			}
+		})
+	}
+}
+
+func TestX11Forwarding(t *testing.T) {
+	x11Request := ssh.Marshal(struct {
+		SingleConnection bool
+		AuthProtocol     string
+		AuthCookie       string
+		ScreenNumber     uint32
+	}{false, "MIT-MAGIC-COOKIE-1", "00112233445566778899aabbccddeeff", 0})
+
+	tests := []struct {
+		name    string
+		allowed bool
+	}{
+		{"allowed", true},
+		{"not enabled for the user", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, addr := startProxy(t, func(cfg *config.Config) { cfg.Users[0].ForwardX11 = tt.allowed })
+			client := dialProxy(t, addr)
+
+			// the client's display answers "pong"
+			origins := make(chan string, 1)
+			go func() {
+				for newChannel := range client.HandleChannelOpen(x11ChannelType) {
+					var origin struct {
+						Address string
+						Port    uint32
+					}
+					ssh.Unmarshal(newChannel.ExtraData(), &origin)
+					origins <- net.JoinHostPort(origin.Address, strconv.Itoa(int(origin.Port)))
+					ch, reqs, err := newChannel.Accept()
+					if err != nil {
+						continue
+					}
+					go ssh.DiscardRequests(reqs)
+					io.ReadAll(ch)
+					io.WriteString(ch, "pong")
+					ch.Close()
+				}
+			}()
+
+			session, err := client.NewSession()
+			if err != nil {
+				t.Fatal(err)
+			}
+			ok, err := session.SendRequest(x11RequestType, true, x11Request)
+			if err != nil || ok != tt.allowed {
+				t.Fatalf("x11-req = %v, %v, want %v", ok, err, tt.allowed)
+			}
+			if !tt.allowed {
+				return
+			}
+			out, err := session.Output("x11")
+			if err != nil || string(out) != "pong" {
+				t.Fatalf("Output() = %q, %v", out, err)
+			}
+			if origin := <-origins; origin != "127.0.0.1:41000" {
+				t.Errorf("client was told the originator is %s", origin)
+			}
+			log := sessionLog(t, s)
+			if !strings.Contains(log, "# X11 forwarding enabled") || !strings.Contains(log, "# x11: channel opened from 127.0.0.1:41000") {
+				t.Errorf("session log does not record the X11 channel:\n%s", log)
+			}
+		})
+	}
+}
+
+// metricValue returns the exposed value of a metric series, or "" if it
+// has not been exposed yet
+func metricValue(t *testing.T, series string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// offerOnlySigner offers a public key without holding its private key
+type offerOnlySigner struct {
+	key ssh.PublicKey
+}
+
+func (s offerOnlySigner) PublicKey() ssh.PublicKey {
+	return s.key
+}
+
+func (s offerOnlySigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return nil, errors.New("no private key")
+}
+
+func TestOfferedKeyKeepsLoginFailures(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	key, _ := ssh.NewPublicKey(pub)
+	keyPath := filepath.Join(t.TempDir(), "user1.pub")
+	if err := os.WriteFile(keyPath, ssh.MarshalAuthorizedKey(key), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, addr := startProxy(t, func(cfg *config.Config) {
+		keyUser := config.User{Username: "user1"}
+		keyUser.Auth.Type = "publickey"
+		keyUser.Auth.KeyPath = keyPath
+		cfg.Users = append(cfg.Users, keyUser)
+		lockout := &cfg.Security.Lockout
+		lockout.Enabled = true
+		lockout.Window = time.Minute
+		lockout.MaxFailuresPerUser = 2
+		lockout.BanDuration = time.Minute
+		lockout.BackoffBase = time.Millisecond
+		lockout.BackoffMax = time.Millisecond
+	})
+	login := func(auth ssh.AuthMethod) error {
+		client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+			User:            "user1",
+			Auth:            []ssh.AuthMethod{auth},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		})
+		if err == nil {
+			client.Close()
+		}
+		return err
+	}
+
+	var mu sync.Mutex
+	var successes []notify.Event
+	s.notifier.Load().SetAudit(func(e notify.Event) {
+		if e.Type == notify.EventAuthSuccess {
+			mu.Lock()
+			successes = append(successes, e)
+			mu.Unlock()
+		}
+	})
+	keyLogins := metricValue(t, `ssh_proxy_auth_attempts_total{method="publickey",user="user1",result="success"}`)
+
+	if login(ssh.Password("wrong")) == nil {
+		t.Fatal("login with a wrong password succeeded")
+	}
+	// the server accepts the key when it is offered, but the client cannot
+	// prove it holds it, so this is no successful login
+	if login(ssh.PublicKeys(offerOnlySigner{key})) == nil {
+		t.Fatal("login without the private key succeeded")
+	}
+	if got := metricValue(t, `ssh_proxy_auth_attempts_total{method="publickey",user="user1",result="success"}`); got != keyLogins {
+		t.Errorf("successful key logins went from %s to %s for an offered key", keyLogins, got)
+	}
+	if login(ssh.Password("wrong")) == nil {
+		t.Fatal("login with a wrong password succeeded")
+	}
+	if login(ssh.Password("user1pass")) == nil {
+		t.Error("user1 was not banned after two failed logins")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(successes) != 0 {
+		t.Errorf("audit trail has successful logins: %+v", successes)
+	}
+}
+
+func TestRejectedKeysCountOnce(t *testing.T) {
+	s, addr := startProxy(t, nil)
+	var mu sync.Mutex
+	var failures []notify.Event
+	s.notifier.Load().SetAudit(func(e notify.Event) {
+		if e.Type == notify.EventAuthFailure {
+			mu.Lock()
+			failures = append(failures, e)
+			mu.Unlock()
+		}
+	})
+
+	var signers []ssh.Signer
+	for i := 0; i < 3; i++ {
+		_, priv, _ := ed25519.GenerateKey(rand.Reader)
+		signer, _ := ssh.NewSignerFromKey(priv)
+		signers = append(signers, signer)
+	}
+	_, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "user1",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signers...)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err == nil {
+		t.Fatal("login with unknown keys succeeded")
+	}
+
+	// the failure is recorded when the proxy sees the handshake fail
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(failures)
+		mu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// give any further failures a moment to show up
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failures) != 1 || failures[0].Details["method"] != "publickey" {
+		t.Errorf("auth failures = %+v, want one for publickey", failures)
+	}
+}
+
+func TestRegisterSessionDuringShutdown(t *testing.T) {
+	s := &Server{registry: newRegistry()}
+	if s.registerSession(&Session{id: "s_1"}) {
+		t.Error("registerSession() succeeded on a stopped server")
+	}
+	s.running = true
+	if !s.registerSession(&Session{id: "s_2"}) {
+		t.Error("registerSession() failed on a running server")
+	}
+	if _, ok := s.registry.session("s_1"); ok {
+		t.Error("a session turned away was registered")
+	}
+	if _, ok := s.registry.session("s_2"); !ok {
+		t.Error("an admitted session was not registered")
+	}
+}
@@ -6,33 +6,99 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 
 	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/history"
 	"github.com/devashar13/ssh-proxy/internal/llm"
+	"github.com/devashar13/ssh-proxy/internal/logger"
+	"github.com/devashar13/ssh-proxy/internal/metrics"
+	"github.com/devashar13/ssh-proxy/internal/notify"
+	"github.com/devashar13/ssh-proxy/internal/search"
 )
 
 type Session struct {
+	id            string
 	config        *config.Config
+	conn          *Connection
 	username      string
+	clientIP      string
+	target        string
+	mode          string
+	started       time.Time
+	bytesIn       atomic.Int64
+	bytesOut      atomic.Int64
+	lastInput     atomic.Int64
 	clientChannel ssh.Channel
 	clientReqs    <-chan *ssh.Request
 	upstreamConn  *ssh.Client
-	logFile       *os.File
+	upstreamChan  ssh.Channel
+	logFile       *logger.File
+	analyzer      *llm.LiveAnalyzer
+	notifier      *notify.Notifier
+	pty           bool
 	ptyWidth      uint32
 	ptyHeight     uint32
+	terminated    bool
+	approvedBy    string
+	// administrators shadowing the session
+	watching      map[*watcher]bool
+	// commands run so far, for the search index
+	commands      []search.Record
+	// the end of the latest output, to spot password prompts
+	outputTail    []byte
+	// how the session ended, for the session store
+	exitStatus    *int
+	exitSignal    string
+	endReason     string
+	// whether agent and X11 channels from the upstream are relayed
+	forwardAgent  bool
+	forwardX11    bool
+	watchEnded    bool
 	mu            sync.Mutex
 }
 
+const defaultRiskWarning = "Warning: this command has been flagged as high risk and reported to the security team."
+
+// secretPrompt matches output asking for something that must not be kept
+// as a command, such as sudo's password prompt
+var secretPrompt = regexp.MustCompile(`(?i)(password|passphrase|passcode|pin)[^\n]*:\s*$`)
+
+// how much of the latest output is kept for spotting prompts
+const outputTailSize = 256
+
 // Custom reader that cleans control characters when logging
 type cleaningReader struct {
 	r io.Reader
 	w io.Writer
 }
 
+// countingWriter adds the number of bytes written to n and to the relayed
+// bytes metric for its direction
+type countingWriter struct {
+	w       io.Writer
+	n       *atomic.Int64
+	relayed *metrics.Counter
+}
+
+func newCountingWriter(w io.Writer, n *atomic.Int64, direction string) *countingWriter {
+	return &countingWriter{w: w, n: n, relayed: metrics.BytesRelayed.WithLabelValues(direction)}
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n.Add(int64(n))
+	cw.relayed.Add(float64(n))
+	return n, err
+}
+
 func newCleaningReader(r io.Reader, w io.Writer) *cleaningReader {
 	return &cleaningReader{r: r, w: w}
 }
@@ -72,23 +138,59 @@ func cleanControlChars(data []byte) []byte {
     }
     return result
 }
-func NewSession(cfg *config.Config, username string, clientChannel ssh.Channel, clientReqs <-chan *ssh.Request) (*Session, error) {
-	logFile, err := createLogFile(cfg.Logging.Directory, username)
+func NewSession(cfg *config.Config, conn *Connection, clientChannel ssh.Channel, clientReqs <-chan *ssh.Request, notifier *notify.Notifier, approvals *approvals) (*Session, error) {
+	target := fmt.Sprintf("%s@%s:%d", cfg.Upstream.Username, cfg.Upstream.Host, cfg.Upstream.Port)
+	id := newID()
+	requested := time.Now()
+	var mirror io.Writer
+	if cfg.Shipping.Transcripts {
+		mirror = newTranscriptWriter(notifier, id, conn)
+	}
+	logFile, err := createLogFile(cfg, conn, id, target, mirror)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create log file: %w", err)
 	}
+	// sessions that never start are still recorded, with the reason
+	fail := func(err error) (*Session, error) {
+		logFile.Close()
+		rec := newRecord(cfg, conn, id, target, logFile.Name())
+		rec.Started = requested
+		ended := time.Now()
+		rec.Ended = &ended
+		rec.EndReason = err.Error()
+		saveRecord(cfg, rec)
+		return nil, err
+	}
+
+	// the upstream is only contacted once the session has been approved
+	var approvedBy string
+	if user := cfg.FindUser(conn.username); user != nil && user.RequireApproval {
+		// the client's requests are not read yet, so whether it has a
+		// terminal is unknown; stderr is safe either way
+		approvedBy, err = approvals.await(cfg, conn, target, clientChannel.Stderr(), logFile, notifier)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
 	upstreamClient := NewUpstreamClient(cfg)
 	if err := upstreamClient.Connect(); err != nil {
-		logFile.Close()
-		return nil, fmt.Errorf("failed to connect to upstream server: %w", err)
+		return fail(fmt.Errorf("failed to connect to upstream server: %w", err))
 	}
 	return &Session{
+		id:            id,
 		config:        cfg,
-		username:      username,
+		conn:          conn,
+		username:      conn.username,
+		clientIP:      conn.clientIP,
+		target:        target,
+		started:       time.Now(),
 		clientChannel: clientChannel,
 		clientReqs:    clientReqs,
 		upstreamConn:  upstreamClient.GetClient(),
 		logFile:       logFile,
+		notifier:      notifier,
+		approvedBy:    approvedBy,
 	}, nil
 }
 
@@ -101,41 +203,109 @@ func (s *Session) Start() error {
 	
 	// Use defer with a function to ensure logFile is closed before summarization
 	defer func() {
+		s.writeLogFooter()
 		s.logFile.Close()
+		s.indexCommands()
+		s.saveRecord(true)
 		
 		// If LLM is enabled, summarize the session
 		if s.config.LLM.Enabled && s.config.LLM.APIKey != "" {
 			log.Printf("Initiating security summarization for session: %s", filepath.Base(logFilePath))
-			summarizer := llm.NewSummarizer(s.config)
-			summarizer.SummarizeSessionAsync(logFilePath)
+			summarizer := llm.NewSummarizer(s.config, s.notifier)
+			summarizer.SummarizeSessionAsync(logFilePath, s.logFile.Transcript())
 		}
 	}()
 	
+	metrics.ActiveSessions.Inc()
+	s.auditSession(notify.EventSessionStart, "session started", nil)
+	defer func() {
+		metrics.ActiveSessions.Dec()
+		metrics.SessionDuration.Observe(time.Since(s.started).Seconds())
+		s.auditSession(notify.EventSessionEnd, "session ended", map[string]string{
+			"duration":  time.Since(s.started).Round(time.Second).String(),
+			"bytes_in":  strconv.FormatInt(s.bytesIn.Load(), 10),
+			"bytes_out": strconv.FormatInt(s.bytesOut.Load(), 10),
+		})
+	}()
+
 	log.Printf("Starting session for user %s", s.username)
+	s.saveRecord(false)
 	upstreamChannel, upstreamReqs, err := s.upstreamConn.OpenChannel("session", nil)
 	if err != nil {
+		s.setEndReason("failed to open upstream channel")
 		return fmt.Errorf("failed to open upstream channel: %w", err)
 	}
 	defer upstreamChannel.Close()
-	
-	go s.forwardRequests(upstreamChannel)
+
+	s.mu.Lock()
+	s.upstreamChan = upstreamChannel
+	s.mu.Unlock()
+
+	s.lastInput.Store(time.Now().UnixNano())
+	var clientInput io.Reader = &activityReader{r: s.clientChannel, last: &s.lastInput}
+	if s.config.LLM.Enabled && s.config.LLM.Live.Enabled && s.config.LLM.APIKey != "" {
+		analyzer, err := llm.NewLiveAnalyzer(s.config, s.username, filepath.Base(logFilePath), s.handleRisk)
+		if err != nil {
+			return fmt.Errorf("failed to start live analysis: %w", err)
+		}
+		defer analyzer.Close()
+		s.analyzer = analyzer
+	}
+	if s.analyzer != nil || s.config.Search.Enabled {
+		clientInput = io.TeeReader(clientInput, newCommandTracker(s.typedCommand))
+	}
+
+	// the client's request channel is closed once it has closed the session
+	clientClosed := make(chan struct{})
+	go func() {
+		s.forwardRequests(upstreamChannel)
+		close(clientClosed)
+	}()
+
+	defer s.closeWatchers()
+
+	limitsDone := make(chan struct{})
+	defer close(limitsDone)
+	go s.enforceLimits(limitsDone)
 	
 	// Use the cleaning reader instead of a simple TeeReader
-	cleanReader := newCleaningReader(s.clientChannel, s.logFile)
+	cleanReader := newCleaningReader(clientInput, s.logFile)
 	
-	errCh := make(chan error, 2)
+	// EOF is passed on in each direction; the session is over once the
+	// upstream has closed the channel, after its output and exit status
+	// have been relayed, or once the client has gone away
 	go func() {
-		_, err := io.Copy(upstreamChannel, cleanReader)
-		errCh <- err
+		io.Copy(newCountingWriter(upstreamChannel, &s.bytesIn, "client_to_upstream"), cleanReader)
+		upstreamChannel.CloseWrite()
 	}()
-	
+
+	// stderr (extended data) goes to the client's stderr; EOF is only
+	// passed on once both streams are drained
+	outputErr := make(chan error, 1)
 	go func() {
-		_, err := io.Copy(s.clientChannel, upstreamChannel)
-		errCh <- err
+		stderrDone := make(chan struct{})
+		go func() {
+			io.Copy(newCountingWriter(outputWriter{s, s.clientChannel.Stderr()}, &s.bytesOut, "upstream_to_client"), upstreamChannel.Stderr())
+			close(stderrDone)
+		}()
+		_, err := io.Copy(newCountingWriter(outputWriter{s, s.clientChannel}, &s.bytesOut, "upstream_to_client"), upstreamChannel)
+		<-stderrDone
+		s.clientChannel.CloseWrite()
+		outputErr <- err
 	}()
 
-	go ssh.DiscardRequests(upstreamReqs)
-	err = <-errCh
+	upstreamDone := make(chan struct{})
+	go func() {
+		s.forwardUpstreamRequests(upstreamReqs)
+		close(upstreamDone)
+	}()
+
+	select {
+	case <-upstreamDone:
+		err = <-outputErr
+	case <-clientClosed:
+		log.Printf("Client closed the session of user %s", s.username)
+	}
 	if err != nil && err != io.EOF {
 		return fmt.Errorf("data forwarding error: %w", err)
 	}
@@ -159,6 +329,23 @@ func (s *Session) forwardRequests(upstreamChannel ssh.Channel) {
 			s.logExecRequest(req)
 		}
 
+		if req.Type == agentRequestType && !s.handleAgentRequest() ||
+			req.Type == x11RequestType && !s.handleX11Request() {
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+			continue
+		}
+
+		switch req.Type {
+		case "shell":
+			s.setMode("interactive")
+		case "exec":
+			s.setMode("exec")
+		case "subsystem":
+			s.setMode("subsystem")
+		}
+
 		ok, err := upstreamChannel.SendRequest(req.Type, req.WantReply, req.Payload)
 		if err != nil {
 			log.Printf("Failed to forward request: %v", err)
@@ -211,6 +398,7 @@ func (s *Session) handlePtyReq(req *ssh.Request) {
 	}
 
 	s.mu.Lock()
+	s.pty = true
 	s.ptyWidth = params.Width
 	s.ptyHeight = params.Height
 	s.mu.Unlock()
@@ -230,26 +418,412 @@ func (s *Session) logExecRequest(req *ssh.Request) {
 
 	log.Printf("Exec requested: %s", params.Command)
 	fmt.Fprintf(s.logFile, "$ %s\n", params.Command)
+	if s.analyzer != nil {
+		s.analyzer.Submit(params.Command)
+	}
+	s.recordCommand(params.Command, "")
+}
+
+// typedCommand handles a command line typed by the client. Input to exec
+// and subsystem sessions without a terminal is data, such as a file being
+// copied, not commands.
+func (s *Session) typedCommand(command string) {
+	if !s.interactive() || s.answeringPrompt(command) {
+		return
+	}
+	if s.analyzer != nil {
+		s.analyzer.Submit(command)
+	}
+	s.recordCommand(command, "")
+}
+
+// injectedCommand handles a command line typed by an administrator who
+// joined the session. It is treated like the user's own, but tagged with
+// who typed it.
+func (s *Session) injectedCommand(admin, command string) {
+	if s.answeringPrompt(command) {
+		return
+	}
+	log.Printf("%s typed into session %s of user %s: %q", admin, s.id, s.username, command)
+	fmt.Fprintf(s.logFile, "\n# shadow: %s typed: %s\n", admin, command)
+	if !s.interactive() {
+		return
+	}
+	if s.analyzer != nil {
+		s.analyzer.Submit(command)
+	}
+	s.recordCommand(command, admin)
 }
 
-func createLogFile(directory string, username string) (*os.File, error) {
+// interactive reports whether someone is typing into the session: a shell,
+// or any command given a terminal
+func (s *Session) interactive() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mode == "interactive" || s.pty
+}
+
+// noteOutput keeps the end of the session output
+func (s *Session) noteOutput(p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(p) >= outputTailSize {
+		s.outputTail = append(s.outputTail[:0], p[len(p)-outputTailSize:]...)
+		return
+	}
+	if drop := len(s.outputTail) + len(p) - outputTailSize; drop > 0 {
+		s.outputTail = append(s.outputTail[:0], s.outputTail[drop:]...)
+	}
+	s.outputTail = append(s.outputTail, p...)
+}
+
+// answeringPrompt reports whether a typed line is the answer to a password
+// prompt: the output ends with one, and the line was not echoed back
+func (s *Session) answeringPrompt(line string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return secretPrompt.Match(s.outputTail) && !strings.Contains(string(s.outputTail), line)
+}
+
+// recordCommand keeps a command for the search index. typedBy names the
+// administrator who typed it, if not the user.
+func (s *Session) recordCommand(command, typedBy string) {
+	command = truncateCommand(strings.TrimSpace(command))
+	if !s.config.Search.Enabled || command == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, search.Record{
+		Time:     time.Now(),
+		Session:  s.id,
+		Log:      filepath.Base(s.logFile.Name()),
+		Username: s.username,
+		ClientIP: s.clientIP,
+		Target:   s.target,
+		Command:  command,
+		TypedBy:  typedBy,
+	})
+}
+
+// flagCommand attaches a live analysis rating to the latest matching command
+func (s *Session) flagCommand(command string, level llm.RiskLevel) {
+	command = truncateCommand(strings.TrimSpace(command))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.commands) - 1; i >= 0; i-- {
+		if s.commands[i].Command == command {
+			s.commands[i].Risk = level.String()
+			return
+		}
+	}
+}
+
+// indexCommands adds the session's commands to the search index
+func (s *Session) indexCommands() {
+	s.mu.Lock()
+	commands := s.commands
+	s.commands = nil
+	s.mu.Unlock()
+	if err := search.OpenIndex(search.IndexPath(s.config)).Add(commands); err != nil {
+		log.Printf("Failed to index commands of session %s: %v", s.id, err)
+	}
+}
+
+// auditSession records a session lifecycle event in the audit trail
+func (s *Session) auditSession(eventType, message string, details map[string]string) {
+	if details == nil {
+		details = make(map[string]string)
+	}
+	details["session"] = s.id
+	details["target"] = s.target
+	details["log"] = filepath.Base(s.logFile.Name())
+	if s.approvedBy != "" {
+		details["approved_by"] = s.approvedBy
+	}
+	s.notifier.Audit(notify.Event{
+		Type:     eventType,
+		Username: s.username,
+		ClientIP: s.clientIP,
+		Message:  message,
+		Details:  details,
+	})
+}
+
+// handleRisk applies the configured live analysis action to a flagged command
+func (s *Session) handleRisk(a llm.Assessment) {
+	log.Printf("ALERT: %s risk command from user %s: %q (%s)", a.Level, s.username, a.Command, a.Reason)
+	s.flagCommand(a.Command, a.Level)
+	fmt.Fprintf(s.logFile, "\n# live-analysis: %s risk: %s (%s)\n", a.Level, a.Command, a.Reason)
+	s.notifier.Notify(notify.Event{
+		Type:     notify.EventLiveRisk,
+		Username: s.username,
+		ClientIP: s.clientIP,
+		Risk:     a.Level.String(),
+		Message:  fmt.Sprintf("command flagged during live session: %s", a.Command),
+		Details: map[string]string{
+			"command": a.Command,
+			"reason":  a.Reason,
+			"action":  s.config.LLM.Live.Action,
+		},
+	})
+
+	switch s.config.LLM.Live.Action {
+	case "warn":
+		s.notifyClient(s.riskWarning())
+	case "terminate":
+		metrics.PolicyDenials.WithLabelValues("live_analysis").Inc()
+		s.notifier.Notify(notify.Event{
+			Type:     notify.EventPolicyDenied,
+			Username: s.username,
+			ClientIP: s.clientIP,
+			Risk:     a.Level.String(),
+			Message:  "session terminated by live analysis",
+			Details:  map[string]string{"command": a.Command},
+		})
+		s.Terminate(s.riskWarning() + " Session terminated.")
+	}
+}
+
+func (s *Session) riskWarning() string {
+	if s.config.LLM.Live.WarningMessage != "" {
+		return s.config.LLM.Live.WarningMessage
+	}
+	return defaultRiskWarning
+}
+
+// notifyClient injects a message into the client's terminal. Without one
+// the output may be a file or a protocol like SFTP, so the message goes to
+// stderr instead.
+func (s *Session) notifyClient(message string) {
+	s.mu.Lock()
+	pty := s.pty
+	s.mu.Unlock()
+	if !pty {
+		fmt.Fprintf(s.clientChannel.Stderr(), "*** %s ***\n", message)
+		return
+	}
+	fmt.Fprintf(s.clientChannel, "\r\n*** %s ***\r\n", message)
+}
+
+// Terminate tells the client why and closes both sides of the session,
+// which unblocks Start
+func (s *Session) Terminate(reason string) {
+	s.mu.Lock()
+	if s.terminated {
+		s.mu.Unlock()
+		return
+	}
+	s.terminated = true
+	if s.endReason == "" {
+		s.endReason = reason
+	}
+	upstreamChan := s.upstreamChan
+	s.mu.Unlock()
+
+	log.Printf("Terminating session for user %s: %s", s.username, reason)
+	fmt.Fprintf(s.logFile, "\n# session terminated: %s\n", reason)
+	s.notifyClient(reason)
+
+	if upstreamChan != nil {
+		upstreamChan.Close()
+	}
+	s.clientChannel.Close()
+}
+
+func (s *Session) Info() SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SessionInfo{
+		ID:           s.id,
+		ConnectionID: s.conn.id,
+		Username:     s.username,
+		ClientIP:     s.clientIP,
+		Target:       s.target,
+		Mode:         s.mode,
+		Started:      s.started,
+		BytesIn:      s.bytesIn.Load(),
+		BytesOut:     s.bytesOut.Load(),
+		TermWidth:    s.ptyWidth,
+		TermHeight:   s.ptyHeight,
+		LogFile:      s.logFile.Name(),
+		ApprovedBy:   s.approvedBy,
+		Watchers:     len(s.watching),
+	}
+}
+
+func (s *Session) setMode(mode string) {
+	s.mu.Lock()
+	s.mode = mode
+	s.mu.Unlock()
+}
+
+// writeLogFooter records how the session ended, in the same Key: value form
+// as the header so the summarizer can read it back
+func (s *Session) writeLogFooter() {
+	s.mu.Lock()
+	mode := s.mode
+	exitStatus, exitSignal := s.exitStatus, s.exitSignal
+	s.mu.Unlock()
+	if mode == "" {
+		mode = "interactive"
+	}
+
+	fmt.Fprintf(s.logFile, "\n%s\n", llm.LogFooterMarker)
+	fmt.Fprintf(s.logFile, "Ended: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(s.logFile, "Mode: %s\n", mode)
+	if exitStatus != nil {
+		fmt.Fprintf(s.logFile, "Exit status: %d\n", *exitStatus)
+	}
+	if exitSignal != "" {
+		fmt.Fprintf(s.logFile, "Exit signal: %s\n", exitSignal)
+	}
+}
+
+func createLogFile(cfg *config.Config, conn *Connection, id, target string, mirror io.Writer) (*logger.File, error) {
+	directory := cfg.Logging.Directory
 	if err := os.MkdirAll(directory, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create log directory: %w", err)
 	}
 
 	timestamp := time.Now().Format("20060102-150405")
-	filename := fmt.Sprintf("%s_%s.log", username, timestamp)
+	// the session ID keeps names unique when a user opens several
+	// sessions within a second
+	filename := fmt.Sprintf("%s_%s_%s.log", conn.username, timestamp, id)
 	path := filepath.Join(directory, filename)
 
-	file, err := os.Create(path)
+	file, err := logger.Create(path, logger.Options{
+		Integrity: cfg.Logging.Integrity.Enabled,
+		HMACKey:   []byte(cfg.Logging.Integrity.HMACKey),
+		Signer:    conn.hostKey,
+		Recipient: cfg.LogRecipient(),
+		// encrypted logs can't be read back by the summarizer
+		Transcript: cfg.LLM.Enabled,
+		Mirror:     mirror,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create log file: %w", err)
 	}
 
-	fmt.Fprintf(file, "--- SSH Session Log for %s ---\n", username)
+	fmt.Fprintf(file, "--- SSH Session Log for %s ---\n", conn.username)
+	fmt.Fprintf(file, "Session: %s\n", id)
 	fmt.Fprintf(file, "Started: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(file, "Client: %s\n", conn.clientIP)
+	fmt.Fprintf(file, "Target: %s\n", target)
 	fmt.Fprintf(file, "------------------------------\n\n")
 
 	log.Printf("Created log file: %s", path)
 	return file, nil
 }
+
+// forwardUpstreamRequests relays requests the upstream sends on the
+// session channel, such as exit-status and exit-signal, to the client. It
+// returns once the upstream has closed the channel.
+func (s *Session) forwardUpstreamRequests(reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		switch req.Type {
+		case "exit-status":
+			var params struct{ Status uint32 }
+			if err := ssh.Unmarshal(req.Payload, &params); err == nil {
+				status := int(params.Status)
+				log.Printf("Session of user %s exited with status %d", s.username, status)
+				s.mu.Lock()
+				s.exitStatus = &status
+				s.mu.Unlock()
+			}
+		case "exit-signal":
+			var params struct {
+				Signal     string
+				CoreDumped bool
+				Message    string
+				Lang       string
+			}
+			if err := ssh.Unmarshal(req.Payload, &params); err == nil {
+				signal := params.Signal
+				if params.CoreDumped {
+					signal += " (core dumped)"
+				}
+				log.Printf("Session of user %s killed by signal %s", s.username, signal)
+				s.mu.Lock()
+				s.exitSignal = signal
+				s.mu.Unlock()
+			}
+		}
+
+		ok, err := s.clientChannel.SendRequest(req.Type, req.WantReply, req.Payload)
+		if err != nil {
+			log.Printf("Failed to forward %s to client: %v", req.Type, err)
+		}
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+	}
+}
+
+// abandon closes a session that was set up but will not be started
+func (s *Session) abandon(reason string) {
+	s.setEndReason(reason)
+	log.Printf("Closing session for user %s before it started: %s", s.username, reason)
+	fmt.Fprintf(s.logFile, "\n# session not started: %s\n", reason)
+	s.upstreamConn.Close()
+	s.writeLogFooter()
+	s.logFile.Close()
+	s.saveRecord(true)
+}
+
+func (s *Session) setEndReason(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.endReason == "" {
+		s.endReason = reason
+	}
+}
+
+// saveRecord writes the session to the session store, when it starts and
+// again once it has ended
+func (s *Session) saveRecord(ended bool) {
+	rec := newRecord(s.config, s.conn, s.id, s.target, s.logFile.Name())
+	rec.Started = s.started
+	rec.BytesIn = s.bytesIn.Load()
+	rec.BytesOut = s.bytesOut.Load()
+	s.mu.Lock()
+	rec.Mode = s.mode
+	rec.ApprovedBy = s.approvedBy
+	rec.ExitStatus = s.exitStatus
+	rec.ExitSignal = s.exitSignal
+	rec.EndReason = s.endReason
+	s.mu.Unlock()
+	if ended {
+		now := time.Now()
+		rec.Ended = &now
+	}
+	saveRecord(s.config, rec)
+}
+
+func newRecord(cfg *config.Config, conn *Connection, id, target, logPath string) history.Record {
+	rec := history.Record{
+		ID:             id,
+		ConnectionID:   conn.id,
+		Username:       conn.username,
+		ClientAddr:     conn.sshConn.RemoteAddr().String(),
+		ClientVersion:  string(conn.sshConn.ClientVersion()),
+		AuthMethod:     conn.authMethod,
+		KeyFingerprint: conn.keyFingerprint,
+		Target:         target,
+		Started:        time.Now(),
+		Artifacts:      history.Artifacts{Log: logPath},
+	}
+	if cfg.Logging.Integrity.Enabled {
+		rec.Artifacts.Chain = logger.ChainPath(logPath)
+	}
+	if cfg.LLM.Enabled && cfg.LLM.APIKey != "" {
+		rec.Artifacts.Summary = llm.SummaryPath(logPath)
+	}
+	return rec
+}
+
+func saveRecord(cfg *config.Config, rec history.Record) {
+	if err := history.OpenStore(history.StorePath(cfg)).Save(rec); err != nil {
+		log.Printf("Failed to record session %s: %v", rec.ID, err)
+	}
+}
@@ -0,0 +1,306 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/llm"
+	"github.com/devashar13/ssh-proxy/internal/logger"
+)
+
+// fakeChannel is an ssh.Channel that keeps everything written to it
+type fakeChannel struct {
+	mu       sync.Mutex
+	in       io.Reader
+	out      bytes.Buffer
+	stderr   bytes.Buffer
+	requests []*ssh.Request
+	closed   bool
+}
+
+func (c *fakeChannel) Read(p []byte) (int, error) {
+	if c.in == nil {
+		return 0, io.EOF
+	}
+	return c.in.Read(p)
+}
+
+func (c *fakeChannel) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.out.Write(p)
+}
+
+func (c *fakeChannel) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *fakeChannel) CloseWrite() error {
+	return nil
+}
+
+func (c *fakeChannel) SendRequest(name string, wantReply bool, payload []byte) (bool, error) {
+	c.mu.Lock()
+	c.requests = append(c.requests, &ssh.Request{Type: name, WantReply: wantReply, Payload: payload})
+	c.mu.Unlock()
+	return true, nil
+}
+
+func (c *fakeChannel) Stderr() io.ReadWriter {
+	return stderrWriter{c}
+}
+
+// output returns what was written to the channel and its stderr
+func (c *fakeChannel) output() (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.out.String(), c.stderr.String()
+}
+
+func (c *fakeChannel) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+type stderrWriter struct {
+	c *fakeChannel
+}
+
+func (w stderrWriter) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (w stderrWriter) Write(p []byte) (int, error) {
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+	return w.c.stderr.Write(p)
+}
+
+// newTestSession returns a session of user alice that writes its log to a
+// temporary directory
+func newTestSession(t *testing.T, cfg *config.Config) (*Session, *fakeChannel) {
+	t.Helper()
+	logFile, err := logger.Create(filepath.Join(t.TempDir(), "session.log"), logger.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { logFile.Close() })
+	client := &fakeChannel{}
+	s := &Session{
+		id:            "s_1",
+		config:        cfg,
+		conn:          &Connection{id: "c_1", username: "alice", clientIP: "10.0.0.1"},
+		username:      "alice",
+		clientIP:      "10.0.0.1",
+		target:        "upstream:22",
+		mode:          "interactive",
+		started:       time.Now(),
+		clientChannel: client,
+		logFile:       logFile,
+	}
+	s.lastInput.Store(s.started.UnixNano())
+	return s, client
+}
+
+func TestForwardUpstreamRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        *ssh.Request
+		exitStatus int
+		exitSignal string
+	}{
+		{
+			name:       "exit status",
+			req:        &ssh.Request{Type: "exit-status", Payload: ssh.Marshal(struct{ Status uint32 }{130})},
+			exitStatus: 130,
+		},
+		{
+			name: "exit signal",
+			req: &ssh.Request{Type: "exit-signal", Payload: ssh.Marshal(struct {
+				Signal     string
+				CoreDumped bool
+				Message    string
+				Lang       string
+			}{"KILL", false, "", ""})},
+			exitStatus: -1,
+			exitSignal: "KILL",
+		},
+		{
+			name: "exit signal with core dump",
+			req: &ssh.Request{Type: "exit-signal", Payload: ssh.Marshal(struct {
+				Signal     string
+				CoreDumped bool
+				Message    string
+				Lang       string
+			}{"SEGV", true, "segmentation fault", "en"})},
+			exitStatus: -1,
+			exitSignal: "SEGV (core dumped)",
+		},
+		{
+			name:       "malformed exit status",
+			req:        &ssh.Request{Type: "exit-status", Payload: []byte{0, 1}},
+			exitStatus: -1,
+		},
+		{
+			name:       "other request",
+			req:        &ssh.Request{Type: "keepalive@openssh.com"},
+			exitStatus: -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, client := newTestSession(t, &config.Config{})
+			reqs := make(chan *ssh.Request, 1)
+			reqs <- tt.req
+			close(reqs)
+			s.forwardUpstreamRequests(reqs)
+
+			// every request reaches the client unchanged
+			if len(client.requests) != 1 || client.requests[0].Type != tt.req.Type ||
+				!bytes.Equal(client.requests[0].Payload, tt.req.Payload) {
+				t.Errorf("client got %+v", client.requests)
+			}
+			status := -1
+			if s.exitStatus != nil {
+				status = *s.exitStatus
+			}
+			if status != tt.exitStatus || s.exitSignal != tt.exitSignal {
+				t.Errorf("exit status %d, signal %q, want %d, %q", status, s.exitSignal, tt.exitStatus, tt.exitSignal)
+			}
+		})
+	}
+}
+
+func TestWriteLogFooter(t *testing.T) {
+	status := 2
+	tests := []struct {
+		name       string
+		mode       string
+		exitStatus *int
+		exitSignal string
+		want       []string
+		notWant    []string
+	}{
+		{
+			name:    "no exit reported",
+			want:    []string{"Mode: interactive\n"},
+			notWant: []string{"Exit status", "Exit signal"},
+		},
+		{
+			name:       "exit status",
+			mode:       "exec",
+			exitStatus: &status,
+			want:       []string{"Mode: exec\nExit status: 2\n"},
+			notWant:    []string{"Exit signal"},
+		},
+		{
+			name:       "exit signal",
+			mode:       "interactive",
+			exitSignal: "SEGV (core dumped)",
+			want:       []string{"Mode: interactive\nExit signal: SEGV (core dumped)\n"},
+			notWant:    []string{"Exit status"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestSession(t, &config.Config{})
+			s.mode = tt.mode
+			s.exitStatus = tt.exitStatus
+			s.exitSignal = tt.exitSignal
+			s.writeLogFooter()
+
+			data, _ := os.ReadFile(s.logFile.Name())
+			log := string(data)
+			if !strings.HasPrefix(log, "\n--- Session ended ---\nEnded: ") {
+				t.Errorf("footer = %q", log)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(log, w) {
+					t.Errorf("footer does not contain %q:\n%s", w, log)
+				}
+			}
+			for _, w := range tt.notWant {
+				if strings.Contains(log, w) {
+					t.Errorf("footer contains %q:\n%s", w, log)
+				}
+			}
+			// the summarizer reads the footer back
+			if info := llm.ParseSessionInfo(log); info.Ended.IsZero() || info.Mode != "interactive" && info.Mode != tt.mode {
+				t.Errorf("ParseSessionInfo() of the footer = %+v", info)
+			}
+		})
+	}
+}
+
+func TestTypedCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		pty  bool
+		want int
+	}{
+		{name: "shell", mode: "interactive", want: 1},
+		{name: "exec without a terminal", mode: "exec", want: 0},
+		{name: "exec with a terminal", mode: "exec", pty: true, want: 1},
+		{name: "subsystem", mode: "subsystem", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Search.Enabled = true
+			s, _ := newTestSession(t, cfg)
+			s.mode = tt.mode
+			s.pty = tt.pty
+
+			s.typedCommand("ls -la")
+			if len(s.commands) != tt.want {
+				t.Errorf("recorded %d commands, want %d", len(s.commands), tt.want)
+			}
+		})
+	}
+}
+
+func TestAnsweringPrompt(t *testing.T) {
+	tests := []struct {
+		name   string
+		output []string
+		line   string
+		want   int
+	}{
+		{name: "shell prompt", output: []string{"alice@host:~$ "}, line: "ls -la", want: 1},
+		{name: "sudo password", output: []string{"[sudo] password for alice: "}, line: "hunter2", want: 0},
+		{name: "key passphrase", output: []string{"Enter passphrase for key '/home/alice/.ssh/id_ed25519': "}, line: "correct horse", want: 0},
+		{name: "prompt after long output", output: []string{strings.Repeat("x", 1000), "\r\nPassword: "}, line: "hunter2", want: 0},
+		{name: "prompt scrolled away", output: []string{"Password: ", "\r\nok\r\n$ "}, line: "uptime", want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Search.Enabled = true
+			s, _ := newTestSession(t, cfg)
+			for _, out := range tt.output {
+				s.noteOutput([]byte(out))
+			}
+
+			s.typedCommand(tt.line)
+			if len(s.commands) != tt.want {
+				t.Errorf("recorded %d commands, want %d", len(s.commands), tt.want)
+			}
+		})
+	}
+}
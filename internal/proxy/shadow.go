@@ -0,0 +1,347 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+// detachKey ends a shadow session, as Ctrl-] does in telnet
+const detachKey = 0x1d
+
+// how many output chunks a watcher may fall behind before it is dropped
+const watcherBuffer = 256
+
+// watcher receives a copy of a session's output
+type watcher struct {
+	name string
+	join bool
+	out  chan []byte
+	// why out was closed; only read after it is
+	reason string
+	// rebuilds the command lines a joined watcher types
+	tracker *commandTracker
+}
+
+// outputWriter sends session output to one of the client's streams and a
+// copy to every watcher
+type outputWriter struct {
+	s *Session
+	w io.Writer
+}
+
+func (o outputWriter) Write(p []byte) (int, error) {
+	n, err := o.w.Write(p)
+	o.s.noteOutput(p[:n])
+	o.s.broadcast(p[:n])
+	return n, err
+}
+
+// attach adds a watcher to the session. With join set, the watcher may
+// also send input with inject.
+func (s *Session) attach(name string, join bool) *watcher {
+	w := &watcher{name: name, join: join, out: make(chan []byte, watcherBuffer)}
+	if join {
+		w.tracker = newCommandTracker(func(command string) { s.injectedCommand(name, command) })
+	}
+
+	s.mu.Lock()
+	if s.watchEnded {
+		s.mu.Unlock()
+		w.reason = "The session has ended."
+		close(w.out)
+		return w
+	}
+	if s.watching == nil {
+		s.watching = make(map[*watcher]bool)
+	}
+	s.watching[w] = true
+	s.mu.Unlock()
+
+	action, message := "started watching", fmt.Sprintf("%s is now watching this session.", name)
+	if join {
+		action, message = "joined", fmt.Sprintf("%s has joined this session and may type.", name)
+	}
+	log.Printf("%s %s session %s of user %s", name, action, s.id, s.username)
+	fmt.Fprintf(s.logFile, "\n# shadow: %s %s the session at %s\n", name, action, time.Now().Format(time.RFC3339))
+	if s.config.Shadow.NotifyUser {
+		s.notifyClient(message)
+	}
+	return w
+}
+
+// attached reports whether w is still watching the session
+func (s *Session) attached(w *watcher) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.watching[w]
+}
+
+// detach removes a watcher that is leaving of its own accord
+func (s *Session) detach(w *watcher) {
+	s.mu.Lock()
+	attached := s.watching[w]
+	if attached {
+		delete(s.watching, w)
+		w.reason = "Detached."
+		close(w.out)
+	}
+	s.mu.Unlock()
+	if !attached {
+		return
+	}
+
+	log.Printf("%s left session %s of user %s", w.name, s.id, s.username)
+	fmt.Fprintf(s.logFile, "\n# shadow: %s left the session at %s\n", w.name, time.Now().Format(time.RFC3339))
+	if s.config.Shadow.NotifyUser {
+		s.notifyClient(fmt.Sprintf("%s is no longer watching this session.", w.name))
+	}
+}
+
+// broadcast copies output to the watchers. A watcher that has fallen too
+// far behind is dropped rather than slowing down the session.
+func (s *Session) broadcast(p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.watching) == 0 || len(p) == 0 {
+		return
+	}
+	chunk := bytes.Clone(p)
+	for w := range s.watching {
+		select {
+		case w.out <- chunk:
+		default:
+			log.Printf("Dropping %s from session %s: not keeping up with the output", w.name, s.id)
+			delete(s.watching, w)
+			w.reason = "Disconnected: not keeping up with the session output."
+			close(w.out)
+		}
+	}
+}
+
+// closeWatchers disconnects every watcher once the session is over
+func (s *Session) closeWatchers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watchEnded = true
+	for w := range s.watching {
+		delete(s.watching, w)
+		w.reason = "The session has ended."
+		close(w.out)
+	}
+}
+
+// inject sends a joined watcher's keystrokes upstream as if the user had
+// typed them. They are recorded like the user's input, with the commands
+// attributed to the watcher.
+func (s *Session) inject(w *watcher, p []byte) error {
+	s.mu.Lock()
+	upstream := s.upstreamChan
+	s.mu.Unlock()
+	if upstream == nil {
+		return fmt.Errorf("session is not connected")
+	}
+	s.lastInput.Store(time.Now().UnixNano())
+	s.logFile.Write(cleanControlChars(p))
+	w.tracker.Write(p)
+	_, err := newCountingWriter(upstream, &s.bytesIn, "client_to_upstream").Write(p)
+	return err
+}
+
+func (s *Server) isShadowAdmin(cfg *config.Config, username string) bool {
+	return cfg.Shadow.Enabled && slices.Contains(cfg.Shadow.Admins, username)
+}
+
+// interceptShadow lets shadow administrators run the shadow commands in
+// place of an upstream session. It reads the channel's requests up to the
+// one that starts the session. If that is a shadow command, it is served
+// here and true is returned; otherwise the requests read so far are handed
+// back, followed by the rest, for a normal session.
+func (s *Server) interceptShadow(cfg *config.Config, client *Connection, channel ssh.Channel, reqs <-chan *ssh.Request) (<-chan *ssh.Request, bool) {
+	var held []*ssh.Request
+	for req := range reqs {
+		held = append(held, req)
+		if req.Type != "exec" {
+			if req.Type == "shell" || req.Type == "subsystem" {
+				break
+			}
+			continue
+		}
+
+		var params struct {
+			Command string
+		}
+		if err := ssh.Unmarshal(req.Payload, &params); err != nil {
+			break
+		}
+		command, arg, _ := strings.Cut(strings.TrimSpace(params.Command), " ")
+		switch command {
+		case "sessions", "shadow", "join":
+			s.serveShadow(cfg, client, channel, held, reqs, command, strings.TrimSpace(arg))
+			return nil, true
+		}
+		break
+	}
+
+	replay := make(chan *ssh.Request, len(held))
+	for _, req := range held {
+		replay <- req
+	}
+	go func() {
+		defer close(replay)
+		for req := range reqs {
+			replay <- req
+		}
+	}()
+	return replay, false
+}
+
+func (s *Server) serveShadow(cfg *config.Config, client *Connection, channel ssh.Channel, held []*ssh.Request, reqs <-chan *ssh.Request, command, arg string) {
+	defer channel.Close()
+
+	// accept the terminal setup so that the administrator gets a raw tty
+	for _, req := range held {
+		if req.WantReply {
+			req.Reply(true, nil)
+		}
+	}
+	go func() {
+		for req := range reqs {
+			if req.WantReply {
+				req.Reply(req.Type == "window-change", nil)
+			}
+		}
+	}()
+
+	out := &crlfWriter{w: channel}
+	status := uint32(0)
+	if err := s.runShadowCommand(cfg, client, channel, out, command, arg); err != nil {
+		fmt.Fprintf(out, "%s: %v\n", command, err)
+		status = 1
+	}
+	channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+}
+
+func (s *Server) runShadowCommand(cfg *config.Config, client *Connection, channel ssh.Channel, out io.Writer, command, arg string) error {
+	if command == "sessions" {
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tUSER\tCLIENT\tMODE\tSTARTED\tWATCHERS")
+		for _, info := range s.Sessions() {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\n", info.ID, info.Username, info.ClientIP, info.Mode,
+				info.Started.Local().Format(time.DateTime), info.Watchers)
+		}
+		return tw.Flush()
+	}
+
+	if arg == "" {
+		return fmt.Errorf("usage: %s <session-id>", command)
+	}
+	join := command == "join"
+	if join && !cfg.Shadow.AllowJoin {
+		return fmt.Errorf("joining sessions is not enabled")
+	}
+	sess, ok := s.registry.session(arg)
+	if !ok {
+		return fmt.Errorf("no active session %s", arg)
+	}
+
+	mode := "read-only"
+	if join {
+		mode = "joined, your input is sent to the session"
+	}
+	fmt.Fprintf(out, "*** Watching session %s of %s (%s). Press Ctrl-] to detach. ***\n", sess.id, sess.username, mode)
+
+	w := sess.attach(client.username, join)
+	detached := make(chan struct{})
+	go func() {
+		defer close(detached)
+		buf := make([]byte, 1024)
+		for {
+			n, err := channel.Read(buf)
+			if n > 0 {
+				p := buf[:n]
+				i := bytes.IndexByte(p, detachKey)
+				if i >= 0 {
+					p = p[:i]
+				}
+				if join && len(p) > 0 {
+					sess.inject(w, p)
+				}
+				if i >= 0 {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case p, ok := <-w.out:
+			if !ok {
+				fmt.Fprintf(out, "\n*** %s ***\n", w.reason)
+				return nil
+			}
+			channel.Write(p)
+		case <-detached:
+			sess.detach(w)
+			fmt.Fprintf(out, "\n*** Detached. ***\n")
+			return nil
+		}
+	}
+}
+
+// WatchSession attaches to a live session as a read-only watcher. It
+// reports false if there is no such session or it has ended; otherwise
+// stream copies the session's output to out until the session ends or
+// stop is closed.
+func (s *Server) WatchSession(id, name string) (stream func(out io.Writer, stop <-chan struct{}), ok bool) {
+	sess, ok := s.registry.session(id)
+	if !ok {
+		return nil, false
+	}
+	w := sess.attach(name, false)
+	if !sess.attached(w) {
+		return nil, false
+	}
+	return func(out io.Writer, stop <-chan struct{}) {
+		for {
+			select {
+			case p, ok := <-w.out:
+				if !ok {
+					return
+				}
+				if _, err := out.Write(p); err != nil {
+					sess.detach(w)
+					return
+				}
+			case <-stop:
+				sess.detach(w)
+				return
+			}
+		}
+	}, true
+}
+
+// crlfWriter turns bare newlines into CRLF for a client terminal in raw mode
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.Write(bytes.ReplaceAll(p, []byte("\n"), []byte("\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,274 @@
+package proxy
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+)
+
+func TestWatcherLifecycle(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Shadow.NotifyUser = true
+	s, client := newTestSession(t, cfg)
+
+	w := s.attach("bob", false)
+	outputWriter{s: s, w: client}.Write([]byte("hello"))
+	if got := string(<-w.out); got != "hello" {
+		t.Errorf("watcher got %q, want hello", got)
+	}
+
+	s.detach(w)
+	if _, ok := <-w.out; ok || w.reason != "Detached." {
+		t.Errorf("after detach the watcher is open or has reason %q", w.reason)
+	}
+	// a second detach is harmless
+	s.detach(w)
+
+	_, stderr := client.output()
+	for _, want := range []string{"bob is now watching this session.", "bob is no longer watching this session."} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("user was not told %q: %q", want, stderr)
+		}
+	}
+	stdout, _ := client.output()
+	if stdout != "hello" {
+		t.Errorf("client output = %q, want hello", stdout)
+	}
+}
+
+func TestWatcherNotifyUserOff(t *testing.T) {
+	s, client := newTestSession(t, &config.Config{})
+	s.detach(s.attach("bob", false))
+	if _, stderr := client.output(); stderr != "" {
+		t.Errorf("user was told %q with notify_user off", stderr)
+	}
+	log, _ := os.ReadFile(s.logFile.Name())
+	if !strings.Contains(string(log), "# shadow: bob started watching the session") ||
+		!strings.Contains(string(log), "# shadow: bob left the session") {
+		t.Errorf("log does not record the watcher:\n%s", log)
+	}
+}
+
+func TestSlowWatcherDropped(t *testing.T) {
+	s, _ := newTestSession(t, &config.Config{})
+	slow := s.attach("bob", false)
+	for i := 0; i <= watcherBuffer; i++ {
+		s.broadcast([]byte("x"))
+	}
+	for range slow.out {
+	}
+	if !strings.Contains(slow.reason, "not keeping up") {
+		t.Errorf("reason = %q", slow.reason)
+	}
+	if len(s.watching) != 0 {
+		t.Errorf("%d watchers left", len(s.watching))
+	}
+}
+
+func TestCloseWatchers(t *testing.T) {
+	s, _ := newTestSession(t, &config.Config{})
+	w := s.attach("bob", false)
+	s.closeWatchers()
+	if _, ok := <-w.out; ok || w.reason != "The session has ended." {
+		t.Errorf("watcher open or reason %q after the session ended", w.reason)
+	}
+	// watchers arriving after the end are closed straight away
+	late := s.attach("carol", false)
+	if _, ok := <-late.out; ok || late.reason != "The session has ended." {
+		t.Errorf("late watcher open or reason %q", late.reason)
+	}
+}
+
+func TestWatchSession(t *testing.T) {
+	srv := &Server{registry: newRegistry()}
+	s, _ := newTestSession(t, &config.Config{})
+	srv.registry.addSession(s)
+
+	if _, ok := srv.WatchSession("s_2", "bob"); ok {
+		t.Error("WatchSession() of an unknown session succeeded")
+	}
+	stream, ok := srv.WatchSession("s_1", "bob")
+	if !ok {
+		t.Fatal("WatchSession() of a live session failed")
+	}
+	s.broadcast([]byte("hello"))
+	s.closeWatchers()
+	var out bytes.Buffer
+	stream(&out, nil)
+	if out.String() != "hello" {
+		t.Errorf("streamed %q, want hello", out.String())
+	}
+
+	// a session that has ended but is not yet unregistered cannot be watched
+	if _, ok := srv.WatchSession("s_1", "carol"); ok {
+		t.Error("WatchSession() of an ended session succeeded")
+	}
+}
+
+func TestInject(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Search.Enabled = true
+	s, _ := newTestSession(t, cfg)
+	w := s.attach("bob", true)
+
+	if err := s.inject(w, []byte("ls\r")); err == nil {
+		t.Error("inject() before the upstream is connected succeeded")
+	}
+
+	upstream := &fakeChannel{}
+	s.upstreamChan = upstream
+	if err := s.inject(w, []byte("uptime\r")); err != nil {
+		t.Fatalf("inject() error = %v", err)
+	}
+	if out, _ := upstream.output(); out != "uptime\r" {
+		t.Errorf("upstream got %q", out)
+	}
+	if len(s.commands) != 1 || s.commands[0].Command != "uptime" || s.commands[0].TypedBy != "bob" {
+		t.Errorf("commands = %+v, want uptime typed by bob", s.commands)
+	}
+	log, _ := os.ReadFile(s.logFile.Name())
+	if !strings.Contains(string(log), "# shadow: bob typed: uptime") {
+		t.Errorf("log does not attribute the command:\n%s", log)
+	}
+}
+
+func TestRunShadowCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		command   string
+		arg       string
+		allowJoin bool
+		input     string
+		want      []string
+		wantErr   string
+		upstream  string
+	}{
+		{name: "list sessions", command: "sessions", want: []string{"ID", "WATCHERS", "s_1", "alice", "10.0.0.1"}},
+		{name: "missing id", command: "shadow", wantErr: "usage: shadow <session-id>"},
+		{name: "unknown session", command: "shadow", arg: "s_2", wantErr: "no active session s_2"},
+		{name: "join not enabled", command: "join", arg: "s_1", wantErr: "joining sessions is not enabled"},
+		{
+			name:    "watch and detach",
+			command: "shadow", arg: "s_1", input: "ls\r\x1d",
+			want: []string{"Watching session s_1 of alice (read-only)", "*** Detached. ***"},
+		},
+		{
+			name:    "join and type",
+			command: "join", arg: "s_1", allowJoin: true, input: "ls\r\x1dignored",
+			want:     []string{"(joined, your input is sent to the session)", "*** Detached. ***"},
+			upstream: "ls\r",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Shadow.Enabled = true
+			cfg.Shadow.AllowJoin = tt.allowJoin
+			s := &Server{registry: newRegistry()}
+			sess, _ := newTestSession(t, cfg)
+			upstream := &fakeChannel{}
+			sess.upstreamChan = upstream
+			s.registry.addSession(sess)
+
+			channel := &fakeChannel{in: strings.NewReader(tt.input)}
+			var out strings.Builder
+			err := s.runShadowCommand(cfg, &Connection{username: "bob"}, channel, &out, tt.command, tt.arg)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("runShadowCommand() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("runShadowCommand() error = %v", err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(out.String(), w) {
+					t.Errorf("output does not contain %q:\n%s", w, out.String())
+				}
+			}
+			if got, _ := upstream.output(); got != tt.upstream {
+				t.Errorf("upstream got %q, want %q", got, tt.upstream)
+			}
+		})
+	}
+}
+
+func TestInterceptShadow(t *testing.T) {
+	exec := func(command string) *ssh.Request {
+		return &ssh.Request{Type: "exec", Payload: ssh.Marshal(struct{ Command string }{command})}
+	}
+	tests := []struct {
+		name    string
+		reqs    []*ssh.Request
+		handled bool
+	}{
+		{name: "shell", reqs: []*ssh.Request{{Type: "pty-req"}, {Type: "shell"}, {Type: "window-change"}}},
+		{name: "other command", reqs: []*ssh.Request{exec("uptime")}},
+		{name: "sessions command", reqs: []*ssh.Request{{Type: "pty-req"}, exec("sessions")}, handled: true},
+		{name: "shadow command", reqs: []*ssh.Request{exec("shadow")}, handled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Shadow.Enabled = true
+			s := &Server{registry: newRegistry()}
+			reqs := make(chan *ssh.Request, len(tt.reqs))
+			for _, req := range tt.reqs {
+				reqs <- req
+			}
+			close(reqs)
+
+			channel := &fakeChannel{}
+			replay, handled := s.interceptShadow(cfg, &Connection{username: "bob"}, channel, reqs)
+			if handled != tt.handled {
+				t.Fatalf("handled = %v, want %v", handled, tt.handled)
+			}
+			if handled {
+				if !channel.isClosed() || len(channel.requests) != 1 || channel.requests[0].Type != "exit-status" {
+					t.Errorf("shadow command did not finish with an exit status: %+v", channel.requests)
+				}
+				return
+			}
+			// every request reaches the normal session, in order
+			var got []*ssh.Request
+			for req := range replay {
+				got = append(got, req)
+			}
+			if len(got) != len(tt.reqs) {
+				t.Fatalf("replayed %d requests, want %d", len(got), len(tt.reqs))
+			}
+			for i := range got {
+				if got[i] != tt.reqs[i] {
+					t.Errorf("request %d is %s, want %s", i, got[i].Type, tt.reqs[i].Type)
+				}
+			}
+		})
+	}
+}
+
+func TestIsShadowAdmin(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Shadow.Admins = []string{"bob"}
+	s := &Server{}
+	if s.isShadowAdmin(cfg, "bob") {
+		t.Error("bob is a shadow admin with shadowing disabled")
+	}
+	cfg.Shadow.Enabled = true
+	if !s.isShadowAdmin(cfg, "bob") || s.isShadowAdmin(cfg, "alice") {
+		t.Error("isShadowAdmin() does not follow the admin list")
+	}
+}
+
+func TestCRLFWriter(t *testing.T) {
+	var b strings.Builder
+	n, err := (&crlfWriter{w: &b}).Write([]byte("a\nb\n"))
+	if n != 4 || err != nil || b.String() != "a\r\nb\r\n" {
+		t.Errorf("Write() = %d, %v, wrote %q", n, err, b.String())
+	}
+}
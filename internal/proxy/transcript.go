@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/devashar13/ssh-proxy/internal/notify"
+)
+
+// longest transcript line shipped as one event; longer lines are split
+const maxTranscriptLine = 4096
+
+// transcriptWriter turns what is written to a session log into one audit
+// event per line. The log serializes writes, so it needs no locking.
+type transcriptWriter struct {
+	notifier  *notify.Notifier
+	sessionID string
+	username  string
+	clientIP  string
+	line      int
+	buf       bytes.Buffer
+}
+
+func newTranscriptWriter(notifier *notify.Notifier, sessionID string, conn *Connection) *transcriptWriter {
+	return &transcriptWriter{
+		notifier:  notifier,
+		sessionID: sessionID,
+		username:  conn.username,
+		clientIP:  conn.clientIP,
+	}
+}
+
+func (t *transcriptWriter) Write(p []byte) (int, error) {
+	t.buf.Write(p)
+	for {
+		i := bytes.IndexByte(t.buf.Bytes(), '\n')
+		if i < 0 {
+			if t.buf.Len() >= maxTranscriptLine {
+				t.ship(t.buf.Next(maxTranscriptLine))
+			}
+			return len(p), nil
+		}
+		t.ship(t.buf.Next(i + 1)[:i])
+	}
+}
+
+// Close ships whatever is left of an unfinished line
+func (t *transcriptWriter) Close() error {
+	if t.buf.Len() > 0 {
+		t.ship(t.buf.Bytes())
+		t.buf.Reset()
+	}
+	return nil
+}
+
+func (t *transcriptWriter) ship(line []byte) {
+	t.line++
+	t.notifier.Audit(notify.Event{
+		Type:     notify.EventTranscript,
+		Username: t.username,
+		ClientIP: t.clientIP,
+		Message:  string(bytes.TrimRight(line, "\r")),
+		Details: map[string]string{
+			"session": t.sessionID,
+			"line":    strconv.Itoa(t.line),
+		},
+	})
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/notify"
+)
+
+func TestTranscriptWriter(t *testing.T) {
+	notifier, err := notify.NewNotifier(&config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []notify.Event
+	notifier.SetAudit(func(e notify.Event) { events = append(events, e) })
+
+	w := newTranscriptWriter(notifier, "s_1", &Connection{username: "alice", clientIP: "10.0.0.1"})
+	long := strings.Repeat("x", maxTranscriptLine+10)
+	for _, chunk := range []string{"$ l", "s\r\nfile\n", long, "\n", "tail"} {
+		if n, err := w.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write() = %d, %v", n, err)
+		}
+	}
+	w.Close()
+
+	want := []string{"$ ls", "file", long[:maxTranscriptLine], "xxxxxxxxxx", "tail"}
+	if len(events) != len(want) {
+		t.Fatalf("shipped %d lines, want %d", len(events), len(want))
+	}
+	for i, e := range events {
+		if e.Message != want[i] {
+			t.Errorf("line %d = %.20q, want %.20q", i+1, e.Message, want[i])
+		}
+		if e.Type != notify.EventTranscript || e.Username != "alice" || e.ClientIP != "10.0.0.1" ||
+			e.Details["session"] != "s_1" || e.Details["line"] != strconv.Itoa(i+1) {
+			t.Errorf("line %d event = %+v", i+1, e)
+		}
+	}
+}
@@ -3,8 +3,10 @@ package proxy
 import (
 	"crypto/ed25519"
 	"crypto/rand"
+	"encoding/hex"
 	"encoding/pem"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"bytes"
@@ -73,3 +75,19 @@ func saveHostKey(signer ssh.Signer, path string) error {
 func KeysEqual(a, b ssh.PublicKey) bool {
 	return bytes.Equal(a.Marshal(), b.Marshal())
 }
+
+// hostOnly strips the port from a remote address
+func hostOnly(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// newID returns a random identifier for connections and sessions
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/devashar13/ssh-proxy/internal/notify"
+)
+
+const (
+	x11RequestType = "x11-req"
+	x11ChannelType = "x11"
+)
+
+// handleX11Request decides whether a client's X11 forwarding request is
+// passed to the upstream
+func (s *Session) handleX11Request() bool {
+	user := s.config.FindUser(s.username)
+	if user == nil || !user.ForwardX11 {
+		log.Printf("Refused X11 forwarding for user %s: not enabled for the user", s.username)
+		return false
+	}
+
+	s.mu.Lock()
+	started := s.forwardX11
+	s.forwardX11 = true
+	s.mu.Unlock()
+	if !started {
+		if chans := s.upstreamConn.HandleChannelOpen(x11ChannelType); chans != nil {
+			go s.relayX11Channels(chans)
+		}
+		fmt.Fprintf(s.logFile, "\n# X11 forwarding enabled\n")
+	}
+	return true
+}
+
+// relayX11Channels connects every X11 channel the upstream opens to the
+// client's display
+func (s *Session) relayX11Channels(chans <-chan ssh.NewChannel) {
+	for newChannel := range chans {
+		go s.relayX11(newChannel)
+	}
+}
+
+func (s *Session) relayX11(newChannel ssh.NewChannel) {
+	var origin struct {
+		Address string
+		Port    uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &origin); err != nil {
+		log.Printf("Rejected malformed X11 channel from upstream: %v", err)
+		newChannel.Reject(ssh.ConnectionFailed, "malformed x11 channel request")
+		return
+	}
+	originator := net.JoinHostPort(origin.Address, strconv.Itoa(int(origin.Port)))
+
+	log.Printf("X11 channel opened from upstream %s for user %s", originator, s.username)
+	fmt.Fprintf(s.logFile, "\n# x11: channel opened from %s\n", originator)
+	s.notifier.Audit(notify.Event{
+		Type:     notify.EventX11Open,
+		Username: s.username,
+		ClientIP: s.clientIP,
+		Message:  "upstream opened an X11 channel from " + originator,
+		Details: map[string]string{
+			"session":    s.id,
+			"target":     s.target,
+			"originator": originator,
+		},
+	})
+
+	// the originator reported by the upstream is passed on unchanged
+	clientX11, clientReqs, err := s.conn.sshConn.OpenChannel(x11ChannelType, newChannel.ExtraData())
+	if err != nil {
+		log.Printf("Failed to open X11 channel to user %s: %v", s.username, err)
+		newChannel.Reject(ssh.ConnectionFailed, "X11 display not available")
+		return
+	}
+	defer clientX11.Close()
+	go ssh.DiscardRequests(clientReqs)
+
+	upstreamX11, upstreamReqs, err := newChannel.Accept()
+	if err != nil {
+		log.Printf("Failed to accept X11 channel from upstream: %v", err)
+		return
+	}
+	defer upstreamX11.Close()
+	go ssh.DiscardRequests(upstreamReqs)
+
+	relayChannel(upstreamX11, clientX11, nil)
+}
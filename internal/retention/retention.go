@@ -0,0 +1,285 @@
+// Package retention compresses, expires and archives finished session logs
+// according to the logging.retention settings.
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/logger"
+	"github.com/devashar13/ssh-proxy/internal/metrics"
+)
+
+// HoldSuffix marks a log under legal hold: while <log>.hold exists, the
+// log and everything belonging to it are left alone
+const HoldSuffix = ".hold"
+
+// Action is one change made to the logs, or planned on a dry run
+type Action struct {
+	// "compress", "delete" or "archive"
+	Kind   string
+	Log    string
+	Reason string
+	// size of the files affected
+	Bytes int64
+}
+
+// group is a session log together with its chain, summary and markers
+type group struct {
+	log        string
+	files      []string
+	size       int64
+	modTime    time.Time
+	held       bool
+	compressed bool
+}
+
+// Apply runs the retention policy once over the logging directory. Logs in
+// active are never touched. With dryRun set, nothing is changed and the
+// actions that would have been taken are returned.
+func Apply(cfg *config.Config, active map[string]bool, now time.Time, dryRun bool) ([]Action, error) {
+	policy := cfg.Logging.Retention
+	groups, err := scan(cfg.Logging.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		actions    []Action
+		total      int64
+		candidates []*group
+	)
+	for _, g := range groups {
+		total += g.size
+	}
+
+	for _, g := range groups {
+		if active[g.log] || g.held {
+			continue
+		}
+		age := now.Sub(g.modTime)
+		if policy.MaxAge > 0 && age > policy.MaxAge {
+			action, err := remove(cfg, g, "older than "+policy.MaxAge.String(), dryRun)
+			if err != nil {
+				return actions, err
+			}
+			actions = append(actions, action)
+			total -= g.size
+			continue
+		}
+		if policy.Compression == "gzip" && !g.compressed && age >= policy.CompressAfter {
+			before := g.size
+			action, ok, err := compress(g, dryRun)
+			if err != nil {
+				return actions, err
+			}
+			if ok {
+				actions = append(actions, action)
+				total += g.size - before
+			}
+		}
+		candidates = append(candidates, g)
+	}
+
+	if policy.MaxTotalSize > 0 && total > int64(policy.MaxTotalSize) {
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].modTime.Before(candidates[j].modTime) })
+		for _, g := range candidates {
+			if total <= int64(policy.MaxTotalSize) {
+				break
+			}
+			action, err := remove(cfg, g, "over the "+policy.MaxTotalSize.String()+" size limit", dryRun)
+			if err != nil {
+				return actions, err
+			}
+			actions = append(actions, action)
+			total -= g.size
+		}
+	}
+	return actions, nil
+}
+
+// scan groups the files in dir by the session log they belong to. Files
+// that don't belong to a log, such as the ban list, are ignored.
+func scan(dir string) ([]*group, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log directory: %w", err)
+	}
+
+	groups := make(map[string]*group)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		name := entry.Name()
+		i := strings.LastIndex(name, ".log")
+		if i <= 0 || (len(name) > i+4 && name[i+4] != '.') {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		key := filepath.Join(dir, name[:i+4])
+		g := groups[key]
+		if g == nil {
+			g = &group{log: key}
+			groups[key] = g
+		}
+		g.files = append(g.files, path)
+		g.size += info.Size()
+		switch name[i+4:] {
+		case "":
+			g.modTime = info.ModTime()
+		case ".gz":
+			g.modTime = info.ModTime()
+			g.compressed = true
+		case HoldSuffix:
+			g.held = true
+		}
+	}
+
+	list := make([]*group, 0, len(groups))
+	for _, g := range groups {
+		// chains or summaries whose log is gone are left alone
+		if !g.modTime.IsZero() {
+			list = append(list, g)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].log < list[j].log })
+	return list, nil
+}
+
+func compress(g *group, dryRun bool) (Action, bool, error) {
+	// encrypted logs don't compress
+	if encrypted, err := logger.IsEncrypted(g.log); err != nil || encrypted {
+		return Action{}, false, nil
+	}
+	action := Action{Kind: "compress", Log: g.log, Reason: "finished", Bytes: g.size}
+	if dryRun {
+		return action, true, nil
+	}
+
+	info, err := os.Stat(g.log)
+	if err != nil {
+		return Action{}, false, nil
+	}
+	dest, err := logger.Compress(g.log)
+	if err != nil {
+		return Action{}, false, fmt.Errorf("failed to compress %s: %w", g.log, err)
+	}
+	compressed, err := os.Stat(dest)
+	if err != nil {
+		return Action{}, false, err
+	}
+	for i, f := range g.files {
+		if f == g.log {
+			g.files[i] = dest
+		}
+	}
+	g.size += compressed.Size() - info.Size()
+	g.compressed = true
+	action.Bytes = g.size
+
+	metrics.RetentionActions.WithLabelValues("compressed").Inc()
+	log.Printf("Retention: compressed %s (%d -> %d bytes)", filepath.Base(g.log), info.Size(), compressed.Size())
+	return action, true, nil
+}
+
+// remove deletes a log and its files, or moves them to the archive
+func remove(cfg *config.Config, g *group, reason string, dryRun bool) (Action, error) {
+	archive := cfg.Logging.Retention.ArchiveDirectory
+	action := Action{Kind: "delete", Log: g.log, Reason: reason, Bytes: g.size}
+	if archive != "" {
+		action.Kind = "archive"
+	}
+	if dryRun {
+		return action, nil
+	}
+
+	if archive != "" {
+		if err := os.MkdirAll(archive, 0755); err != nil {
+			return action, fmt.Errorf("failed to create archive directory: %w", err)
+		}
+	}
+	for _, f := range g.files {
+		var err error
+		if archive != "" {
+			err = moveFile(f, filepath.Join(archive, filepath.Base(f)))
+		} else {
+			err = os.Remove(f)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return action, fmt.Errorf("failed to %s %s: %w", action.Kind, f, err)
+		}
+	}
+
+	metrics.RetentionActions.WithLabelValues(action.Kind + "d").Inc()
+	log.Printf("Retention: %sd %s (%s)", action.Kind, filepath.Base(g.log), reason)
+	return action, nil
+}
+
+// moveFile renames src to dst, copying it if they are on different
+// filesystems
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	os.Chtimes(dst, info.ModTime(), info.ModTime())
+	return os.Remove(src)
+}
+
+// Run applies the policy now and then every retention interval until stop
+// is closed. The configuration is re-read each time, so reloads apply.
+func Run(current func() *config.Config, active func() map[string]bool, stop <-chan struct{}) {
+	for {
+		cfg := current()
+		if cfg.Logging.Retention.Enabled {
+			if _, err := Apply(cfg, active(), time.Now(), false); err != nil {
+				log.Printf("Retention: %v", err)
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(cfg.Logging.Retention.Interval):
+		}
+	}
+}
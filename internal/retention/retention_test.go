@@ -0,0 +1,253 @@
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/logger"
+)
+
+type logFile struct {
+	name string
+	age  time.Duration
+	size int
+}
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestApply(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		files       []logFile
+		compression string
+		maxAge      time.Duration
+		maxTotal    config.ByteSize
+		archive     bool
+		active      []string
+		dryRun      bool
+		actions     []string
+		remaining   []string
+		archived    []string
+	}{
+		{
+			name:        "recent logs are left alone",
+			compression: "gzip",
+			maxAge:      24 * time.Hour,
+			files:       []logFile{{"s_1.log", time.Minute, 100}},
+			remaining:   []string{"s_1.log"},
+		},
+		{
+			name:        "finished logs are compressed with their chain kept",
+			compression: "gzip",
+			files:       []logFile{{"s_1.log", 2 * time.Hour, 100}, {"s_1.log.chain", 2 * time.Hour, 50}},
+			actions:     []string{"compress s_1.log"},
+			remaining:   []string{"s_1.log.chain", "s_1.log.gz"},
+		},
+		{
+			name:        "no compression",
+			compression: "none",
+			files:       []logFile{{"s_1.log", 2 * time.Hour, 100}},
+			remaining:   []string{"s_1.log"},
+		},
+		{
+			name:        "expired logs are deleted with everything belonging to them",
+			compression: "none",
+			maxAge:      24 * time.Hour,
+			files: []logFile{
+				{"s_1.log", 48 * time.Hour, 100}, {"s_1.log.chain", 48 * time.Hour, 50}, {"s_1.log.summary", 48 * time.Hour, 10},
+				{"s_2.log", time.Hour, 100},
+				{"bans.json", 48 * time.Hour, 10},
+			},
+			actions:   []string{"delete s_1.log"},
+			remaining: []string{"bans.json", "s_2.log"},
+		},
+		{
+			name:        "expired logs are archived",
+			compression: "none",
+			maxAge:      24 * time.Hour,
+			archive:     true,
+			files:       []logFile{{"s_1.log", 48 * time.Hour, 100}, {"s_1.log.chain", 48 * time.Hour, 50}},
+			actions:     []string{"archive s_1.log"},
+			archived:    []string{"s_1.log", "s_1.log.chain"},
+		},
+		{
+			name:        "legal hold keeps an expired log",
+			compression: "gzip",
+			maxAge:      24 * time.Hour,
+			files:       []logFile{{"s_1.log", 48 * time.Hour, 100}, {"s_1.log.hold", time.Hour, 0}},
+			remaining:   []string{"s_1.log", "s_1.log.hold"},
+		},
+		{
+			name:        "active sessions are never touched",
+			compression: "gzip",
+			maxAge:      24 * time.Hour,
+			active:      []string{"s_1.log"},
+			files:       []logFile{{"s_1.log", 48 * time.Hour, 100}},
+			remaining:   []string{"s_1.log"},
+		},
+		{
+			name:        "oldest logs go first over the size limit",
+			compression: "none",
+			maxTotal:    250,
+			files: []logFile{
+				{"s_1.log", 3 * time.Hour, 100}, {"s_2.log", 2 * time.Hour, 100}, {"s_3.log", time.Hour, 100},
+			},
+			actions:   []string{"delete s_1.log"},
+			remaining: []string{"s_2.log", "s_3.log"},
+		},
+		{
+			name:        "held logs count towards the size limit but stay",
+			compression: "none",
+			maxTotal:    150,
+			files: []logFile{
+				{"s_1.log", 3 * time.Hour, 100}, {"s_1.log.hold", time.Hour, 0}, {"s_2.log", 2 * time.Hour, 100},
+			},
+			actions:   []string{"delete s_2.log"},
+			remaining: []string{"s_1.log", "s_1.log.hold"},
+		},
+		{
+			name:        "dry run changes nothing",
+			compression: "gzip",
+			maxAge:      24 * time.Hour,
+			dryRun:      true,
+			files:       []logFile{{"s_1.log", 48 * time.Hour, 100}, {"s_2.log", 2 * time.Hour, 100}},
+			actions:     []string{"delete s_1.log", "compress s_2.log"},
+			remaining:   []string{"s_1.log", "s_2.log"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			dir := filepath.Join(root, "logs")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range tt.files {
+				path := filepath.Join(dir, f.name)
+				if err := os.WriteFile(path, []byte(strings.Repeat("x", f.size)), 0644); err != nil {
+					t.Fatal(err)
+				}
+				mod := now.Add(-f.age)
+				if err := os.Chtimes(path, mod, mod); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cfg := &config.Config{}
+			cfg.Logging.Directory = dir
+			policy := &cfg.Logging.Retention
+			policy.Compression = tt.compression
+			policy.CompressAfter = time.Hour
+			policy.MaxAge = tt.maxAge
+			policy.MaxTotalSize = tt.maxTotal
+			if tt.archive {
+				policy.ArchiveDirectory = filepath.Join(root, "archive")
+			}
+			active := make(map[string]bool)
+			for _, name := range tt.active {
+				active[filepath.Join(dir, name)] = true
+			}
+
+			actions, err := Apply(cfg, active, now, tt.dryRun)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			var got []string
+			for _, a := range actions {
+				got = append(got, a.Kind+" "+filepath.Base(a.Log))
+			}
+			if strings.Join(got, ", ") != strings.Join(tt.actions, ", ") {
+				t.Errorf("actions = %v, want %v", got, tt.actions)
+			}
+			if got := listDir(t, dir); strings.Join(got, ", ") != strings.Join(tt.remaining, ", ") {
+				t.Errorf("remaining = %v, want %v", got, tt.remaining)
+			}
+			if tt.archive {
+				if got := listDir(t, policy.ArchiveDirectory); strings.Join(got, ", ") != strings.Join(tt.archived, ", ") {
+					t.Errorf("archived = %v, want %v", got, tt.archived)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyKeepsEncryptedLogsUncompressed(t *testing.T) {
+	key, err := logger.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "s_1.log")
+	if err := logger.WriteFile(path, []byte("$ whoami\n"), key.PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(path, old, old)
+
+	cfg := &config.Config{}
+	cfg.Logging.Directory = dir
+	cfg.Logging.Retention.Compression = "gzip"
+	cfg.Logging.Retention.CompressAfter = time.Hour
+
+	actions, err := Apply(cfg, nil, time.Now(), false)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(actions) != 0 {
+		t.Errorf("actions = %+v, want none", actions)
+	}
+	if got := listDir(t, dir); len(got) != 1 || got[0] != "s_1.log" {
+		t.Errorf("remaining = %v, want s_1.log", got)
+	}
+}
+
+func TestCompressedLogStillVerifies(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "s_1.log")
+	f, err := logger.Create(path, logger.Options{Integrity: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("$ whoami\nroot\n"))
+	f.Close()
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(path, old, old)
+
+	cfg := &config.Config{}
+	cfg.Logging.Directory = dir
+	cfg.Logging.Retention.Compression = "gzip"
+	cfg.Logging.Retention.CompressAfter = time.Hour
+	if _, err := Apply(cfg, nil, time.Now(), false); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	v, err := logger.Verify(path+".gz", logger.VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !v.Complete {
+		t.Error("Verify() reported the compressed log as incomplete")
+	}
+}
@@ -0,0 +1,337 @@
+// Package search keeps a full-text index of the commands run through the
+// proxy, so that session history can be queried without reading every log.
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/config"
+	"github.com/devashar13/ssh-proxy/internal/llm"
+)
+
+// Record is one command run in a session
+type Record struct {
+	Time     time.Time `json:"time"`
+	Session  string    `json:"session"`
+	Log      string    `json:"log"`
+	Username string    `json:"username"`
+	ClientIP string    `json:"client_ip"`
+	Target   string    `json:"target"`
+	Command  string    `json:"command"`
+	// administrator who typed the command into a joined session
+	TypedBy string `json:"typed_by,omitempty"`
+	// rating given to the command by live analysis, if it was flagged
+	Risk string `json:"risk,omitempty"`
+	// rating of the whole session from its summary, once there is one
+	SessionRisk string `json:"session_risk,omitempty"`
+}
+
+// Index is an append-only JSON lines file of commands, with an inverted
+// index over their words built in memory when it is first searched.
+// Summary ratings arrive after a session's commands and are appended as
+// lines with only Log and SessionRisk set.
+type Index struct {
+	path        string
+	records     []Record
+	words       map[string][]int
+	sessionRisk map[string]string
+	loaded      bool
+	mu          sync.Mutex
+}
+
+var (
+	indexes   = make(map[string]*Index)
+	indexesMu sync.Mutex
+)
+
+// OpenIndex returns the shared index for path, so that the sessions of one
+// process and the admin API see each other's additions
+func OpenIndex(path string) *Index {
+	indexesMu.Lock()
+	defer indexesMu.Unlock()
+	if idx, ok := indexes[path]; ok {
+		return idx
+	}
+	idx := &Index{path: path}
+	indexes[path] = idx
+	return idx
+}
+
+// IndexPath is the configured index file, defaulting to the log directory
+func IndexPath(cfg *config.Config) string {
+	if cfg.Search.Index != "" {
+		return cfg.Search.Index
+	}
+	return filepath.Join(cfg.Logging.Directory, "search_index.jsonl")
+}
+
+func (idx *Index) load() error {
+	if idx.loaded {
+		return nil
+	}
+	idx.words = make(map[string][]int)
+	idx.sessionRisk = make(map[string]string)
+	file, err := os.Open(idx.path)
+	if os.IsNotExist(err) {
+		idx.loaded = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open search index: %w", err)
+	}
+	defer file.Close()
+
+	// a damaged or oversized line only loses its own record
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for {
+		line, err := readLine(reader)
+		var rec Record
+		if line != nil && json.Unmarshal(line, &rec) == nil {
+			idx.add(rec)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read search index: %w", err)
+		}
+	}
+	idx.loaded = true
+	return nil
+}
+
+// maxLineSize bounds one line of the index file
+const maxLineSize = 1 << 20
+
+// readLine returns the next line without its newline, or nil if the line
+// is longer than maxLineSize, in which case the rest of it is skipped
+func readLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong {
+			line = append(line, chunk...)
+			if len(bytes.TrimSuffix(line, []byte("\n"))) > maxLineSize {
+				tooLong, line = true, nil
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if tooLong {
+			return nil, err
+		}
+		return bytes.TrimSuffix(line, []byte("\n")), err
+	}
+}
+
+func (idx *Index) add(rec Record) {
+	if rec.Command == "" {
+		if rec.SessionRisk != "" {
+			idx.sessionRisk[rec.Log] = rec.SessionRisk
+		}
+		return
+	}
+	n := len(idx.records)
+	idx.records = append(idx.records, rec)
+	for _, word := range uniqueWords(rec.Command) {
+		idx.words[word] = append(idx.words[word], n)
+	}
+}
+
+// Add indexes the commands of a finished session
+func (idx *Index) Add(records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	lines := make([]byte, 0, 256*len(records))
+	for _, rec := range records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("failed to marshal search record: %w", err)
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.append(lines); err != nil {
+		return err
+	}
+	// records are only kept in memory once the index has been searched
+	if idx.loaded {
+		for _, rec := range records {
+			idx.add(rec)
+		}
+	}
+	return nil
+}
+
+// SetSessionRisk records the summary rating of the session written to log
+func (idx *Index) SetSessionRisk(log, risk string) error {
+	rec := Record{Log: log, SessionRisk: risk}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.append(append(line, '\n')); err != nil {
+		return err
+	}
+	if idx.loaded {
+		idx.add(rec)
+	}
+	return nil
+}
+
+func (idx *Index) append(lines []byte) error {
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0755); err != nil {
+		return fmt.Errorf("failed to create search index directory: %w", err)
+	}
+	file, err := os.OpenFile(idx.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open search index: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(lines); err != nil {
+		return fmt.Errorf("failed to write search index: %w", err)
+	}
+	return nil
+}
+
+// Query selects commands; zero fields match everything
+type Query struct {
+	// words that must all appear in the command, in any order
+	Text string
+	// exact username
+	User string
+	// part of the upstream target, e.g. a host name
+	Target string
+	// minimum rating of the command or of its session
+	Risk  llm.RiskLevel
+	Since time.Time
+	Until time.Time
+	// most results to return, newest first; 0 means all
+	Limit int
+}
+
+// Search returns the commands matching q, newest first
+func (idx *Index) Search(q Query) ([]Record, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.load(); err != nil {
+		return nil, err
+	}
+
+	candidates := idx.candidates(uniqueWords(q.Text))
+	var results []Record
+	for i := len(candidates) - 1; i >= 0; i-- {
+		rec := idx.records[candidates[i]]
+		rec.SessionRisk = idx.sessionRisk[rec.Log]
+		if !q.matches(rec) {
+			continue
+		}
+		results = append(results, rec)
+	}
+	// records are appended per session, so sort by when commands ran
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Time.After(results[j].Time) })
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, nil
+}
+
+// candidates returns the positions of the records containing every word,
+// in ascending order
+func (idx *Index) candidates(words []string) []int {
+	if len(words) == 0 {
+		all := make([]int, len(idx.records))
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+	// start from the rarest word
+	sort.Slice(words, func(i, j int) bool { return len(idx.words[words[i]]) < len(idx.words[words[j]]) })
+	result := idx.words[words[0]]
+	for _, word := range words[1:] {
+		result = intersect(result, idx.words[word])
+		if len(result) == 0 {
+			break
+		}
+	}
+	return result
+}
+
+func intersect(a, b []int) []int {
+	var out []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+func (q Query) matches(rec Record) bool {
+	if q.User != "" && rec.Username != q.User {
+		return false
+	}
+	if q.Target != "" && !strings.Contains(strings.ToLower(rec.Target), strings.ToLower(q.Target)) {
+		return false
+	}
+	if !q.Since.IsZero() && rec.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !rec.Time.Before(q.Until) {
+		return false
+	}
+	if q.Risk > llm.RiskUnknown {
+		command, _ := llm.ParseRiskLevel(rec.Risk)
+		session, _ := llm.ParseRiskLevel(rec.SessionRisk)
+		if max(command, session) < q.Risk {
+			return false
+		}
+	}
+	return true
+}
+
+// uniqueWords splits a command into lower-case words on whitespace and
+// shell punctuation. Paths are also indexed by their last element, so
+// "iptables" finds "/sbin/iptables".
+func uniqueWords(s string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return r <= ' ' || strings.ContainsRune(";|&<>()'\"`$={},", r)
+	})
+	seen := make(map[string]bool, len(fields))
+	var words []string
+	for _, field := range fields {
+		for _, word := range []string{field, filepath.Base(field)} {
+			if word != "" && word != "/" && word != "." && !seen[word] {
+				seen[word] = true
+				words = append(words, word)
+			}
+		}
+	}
+	return words
+}
@@ -0,0 +1,170 @@
+package search
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devashar13/ssh-proxy/internal/llm"
+)
+
+func TestUniqueWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"ls -la /tmp", "ls -la /tmp tmp"},
+		{"sudo /sbin/iptables -F", "sudo /sbin/iptables iptables -f"},
+		{"cat /etc/passwd | grep root", "cat /etc/passwd passwd grep root"},
+		{"echo $HOME; echo done", "echo home done"},
+		{`FOO="a b" ./run.sh`, "foo a b ./run.sh run.sh"},
+		{"cd / && cd .", "cd"},
+		{"   ", ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(uniqueWords(tt.in), " "); got != tt.want {
+			t.Errorf("uniqueWords(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	got := intersect([]int{1, 3, 5, 7}, []int{2, 3, 4, 7, 9})
+	if len(got) != 2 || got[0] != 3 || got[1] != 7 {
+		t.Errorf("intersect() = %v, want [3 7]", got)
+	}
+	if got := intersect([]int{1}, nil); len(got) != 0 {
+		t.Errorf("intersect() with an empty list = %v", got)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	start := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	idx := &Index{path: path}
+
+	// a session of bob's is written before alice's, though it ran later
+	if err := idx.Add([]Record{
+		{Time: at(30), Log: "b.log", Username: "bob", Target: "web.internal:22", Command: "sudo systemctl restart nginx"},
+		{Time: at(31), Log: "b.log", Username: "bob", Target: "web.internal:22", Command: "rm -rf /var/cache/nginx", Risk: "high"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Add([]Record{
+		{Time: at(0), Log: "a.log", Username: "alice", Target: "db.internal:22", Command: "psql -c 'select 1'"},
+		{Time: at(5), Log: "a.log", Username: "alice", Target: "db.internal:22", Command: "sudo /sbin/iptables -F"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.SetSessionRisk("a.log", "medium"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{name: "everything, newest first", query: Query{}, want: []string{"rm", "sudo systemctl", "sudo /sbin", "psql"}},
+		{name: "one word", query: Query{Text: "sudo"}, want: []string{"sudo systemctl", "sudo /sbin"}},
+		{name: "all words", query: Query{Text: "SUDO nginx"}, want: []string{"sudo systemctl"}},
+		{name: "words in any order", query: Query{Text: "nginx rm"}, want: []string{"rm"}},
+		{name: "last path element", query: Query{Text: "iptables"}, want: []string{"sudo /sbin"}},
+		{name: "no match", query: Query{Text: "shutdown"}},
+		{name: "user", query: Query{User: "alice"}, want: []string{"sudo /sbin", "psql"}},
+		{name: "target", query: Query{Target: "WEB"}, want: []string{"rm", "sudo systemctl"}},
+		{name: "since", query: Query{Since: at(5)}, want: []string{"rm", "sudo systemctl", "sudo /sbin"}},
+		{name: "until", query: Query{Until: at(5)}, want: []string{"psql"}},
+		{name: "command risk", query: Query{Risk: llm.RiskHigh}, want: []string{"rm"}},
+		{name: "session risk", query: Query{Risk: llm.RiskMedium}, want: []string{"rm", "sudo /sbin", "psql"}},
+		{name: "limit", query: Query{Limit: 1}, want: []string{"rm"}},
+	}
+	check := func(t *testing.T, idx *Index, q Query, want []string) {
+		t.Helper()
+		results, err := idx.Search(q)
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+		var got []string
+		for _, rec := range results {
+			got = append(got, rec.Command)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("Search() = %q, want commands starting %q", got, want)
+		}
+		for i := range got {
+			if !strings.HasPrefix(got[i], want[i]) {
+				t.Errorf("result %d = %q, want one starting %q", i, got[i], want[i])
+			}
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check(t, idx, tt.query, tt.want)
+			// a fresh index loads the same from the file
+			check(t, &Index{path: path}, tt.query, tt.want)
+		})
+	}
+
+	results, _ := idx.Search(Query{User: "alice", Limit: 1})
+	if results[0].SessionRisk != "medium" {
+		t.Errorf("session risk = %q, want medium", results[0].SessionRisk)
+	}
+}
+
+func TestSearchMissingIndex(t *testing.T) {
+	idx := &Index{path: filepath.Join(t.TempDir(), "missing.jsonl")}
+	results, err := idx.Search(Query{Text: "ls"})
+	if err != nil || len(results) != 0 {
+		t.Errorf("Search() = %v, %v, want nothing", results, err)
+	}
+	// adding after a search keeps the loaded index up to date
+	idx.Add([]Record{{Time: time.Now(), Command: "ls"}})
+	if results, _ := idx.Search(Query{Text: "ls"}); len(results) != 1 {
+		t.Errorf("Search() after Add = %v", results)
+	}
+}
+
+func TestSearchDamagedIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	var data []byte
+	for _, rec := range []Record{
+		{Time: time.Now(), Command: "ls -la"},
+		{Time: time.Now(), Command: "cat " + strings.Repeat("x", maxLineSize)},
+		{Time: time.Now(), Command: "uptime"},
+	} {
+		line, _ := json.Marshal(rec)
+		data = append(append(data, line...), '\n')
+	}
+	data = append(data, "{\"command\": \"truncat\n"...)
+	// the last line may be missing its newline after a crash
+	last, _ := json.Marshal(Record{Time: time.Now(), Command: "id"})
+	data = append(data, last...)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	idx := &Index{path: path}
+	results, err := idx.Search(Query{})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	var commands []string
+	for _, rec := range results {
+		commands = append(commands, rec.Command)
+	}
+	if len(commands) != 3 {
+		t.Errorf("Search() = %q, want the three intact commands", commands)
+	}
+}
+
+func TestOpenIndexShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	if OpenIndex(path) != OpenIndex(path) {
+		t.Error("OpenIndex() returned different indexes for one path")
+	}
+}